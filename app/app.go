@@ -1,13 +1,20 @@
 package app
 
 import (
+	"context"
 	"csi-api/app/constant"
+	"csi-api/app/env"
 	"csi-api/app/handler"
 	"csi-api/app/router"
 	"fmt"
 	"io"
 	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"text/template"
 	"time"
 
@@ -16,7 +23,6 @@ import (
 	"github.com/casbin/casbin/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	casbinmw "github.com/reedom/echo-middleware-casbin"
 )
 
 // Template struct
@@ -40,23 +46,92 @@ func setUserMiddleware(h *handler.Handler) echo.MiddlewareFunc {
 
 // GetSubject gets a subject from echo.Context.
 // In this sample, it expects other middleware has set a user's role at "role".
+// Scopes of the user are appended to the role as role#scope1,scope2.
 func (r *casbinDataSource) GetSubject(c echo.Context) string {
-	return c.Get("role").(string)
+	role := c.Get("role").(string)
+	if scopes, ok := c.Get("scopes").([]string); ok && len(scopes) > 0 {
+		return role + "#" + strings.Join(scopes, ",")
+	}
+	return role
+}
+
+// enforce : check the subject, path and method of the request against the casbin policy. The policy can be
+// reloaded while requests are checked, so it goes through the synced enforcer.
+func enforce(ce *casbin.SyncedEnforcer, ds *casbinDataSource) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ok, err := ce.Enforce(ds.GetSubject(c), c.Request().URL.Path, c.Request().Method)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			if !ok {
+				return echo.ErrForbidden
+			}
+			return next(c)
+		}
+	}
+}
+
+// subjectRole : casbin function, role of a subject
+func subjectRole(args ...interface{}) (interface{}, error) {
+	return strings.SplitN(args[0].(string), "#", 2)[0], nil
+}
+
+// subjectHasScope : casbin function, whether a policy subject scope:X is one of the scopes of the subject
+func subjectHasScope(args ...interface{}) (interface{}, error) {
+	parts := strings.SplitN(args[0].(string), "#", 2)
+	if len(parts) < 2 {
+		return false, nil
+	}
+	for _, scope := range strings.Split(parts[1], ",") {
+		if "scope:"+scope == args[1].(string) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ipExtractor : address of the client, read from X-Forwarded-For only when the request came through one of the
+// trusted proxy ranges and from the connection otherwise
+func ipExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		if strings.TrimSpace(proxy) == "" {
+			continue
+		}
+		_, ipRange, err := net.ParseCIDR(strings.TrimSpace(proxy))
+		if err != nil {
+			panic(fmt.Errorf("TRUSTED_PROXIES: %v", err))
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
 }
 
 // Start :
 func Start(port string) {
 	bs := bs.New()
 	h := handler.New(bs)
+
+	// background jobs stop when the server shuts down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	h.StartCampaignReminders(ctx)
+
 	e := echo.New()
+	// the login throttle keys on the client address, so only our own proxies may forward it
+	e.IPExtractor = ipExtractor(env.Config.App.TrustedProxies)
 
 	e.Validator = bs.Validator
-	ce, err := casbin.NewEnforcer("app/casbin/rbac_model.conf", "app/casbin/rbac_policy.csv")
-	if err != nil {
-		e.Logger.Fatal(err)
-	}
+	ce := bs.Enforcer
+	ce.AddFunction("subjectRole", subjectRole)
+	ce.AddFunction("subjectHasScope", subjectHasScope)
 	e.Use(setUserMiddleware(h))
-	e.Use(casbinmw.Middleware(ce, &casbinDataSource{}))
+	e.Use(enforce(ce, &casbinDataSource{}))
 
 	e.Use(
 		middleware.Recover(),
@@ -88,5 +163,17 @@ func Start(port string) {
 
 	router.V1(e, h)
 
-	e.Logger.Fatal(e.Start(":" + port))
+	go func() {
+		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// let the requests in flight finish before exiting
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Fatal(err)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"csi-api/app/kit/validator"
 	"csi-api/app/repository"
 
+	"github.com/casbin/casbin/v2"
 	storage "github.com/myussufz/cloud-storage"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -15,6 +16,7 @@ type Bootstrap struct {
 	Storage    *storage.Builder
 	MongoDB    *mongo.Client
 	Validator  *validator.CustomValidator
+	Enforcer   *casbin.SyncedEnforcer
 }
 
 // New :
@@ -28,5 +30,7 @@ func New() *Bootstrap {
 
 	bs.Repository = repo
 
+	bs.initEnforcer()
+
 	return bs
 }
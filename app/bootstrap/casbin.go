@@ -0,0 +1,175 @@
+package bootstrap
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/repository"
+	"encoding/csv"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	casbinModelPath         = "app/casbin/rbac_model.conf"
+	casbinPolicyPath        = "app/casbin/rbac_policy.csv"
+	casbinRetiredPolicyPath = "app/casbin/rbac_policy_retired.csv" // default rules taken out of the policy file
+
+	// how often an instance checks for policy changes of the other instances
+	policyPollInterval = 10 * time.Second
+)
+
+func (bs *Bootstrap) initEnforcer() *Bootstrap {
+	adapter := repository.NewCasbinAdapter(bs.Repository)
+	if err := seedPolicy(bs.Repository, adapter); err != nil {
+		panic(err)
+	}
+
+	enforcer, err := casbin.NewSyncedEnforcer(casbinModelPath, adapter)
+	if err != nil {
+		panic(err)
+	}
+
+	watcher, err := repository.NewPolicyWatcher(bs.Repository, policyPollInterval)
+	if err != nil {
+		panic(err)
+	}
+	if err := enforcer.SetWatcher(watcher); err != nil {
+		panic(err)
+	}
+
+	bs.Enforcer = enforcer
+
+	return bs
+}
+
+// seedPolicy : import the rules of the default policy file which have not been imported before, and remove the
+// retired default rules which have not been removed before. New and retired default rules reach existing databases,
+// while rules removed or added by an admin stay that way.
+func seedPolicy(r *repository.Repository, adapter *repository.CasbinAdapter) error {
+	ctx := context.Background()
+
+	records, err := readPolicyFile(casbinPolicyPath)
+	if err != nil {
+		return err
+	}
+	retiredRecords, err := readPolicyFile(casbinRetiredPolicyPath)
+	if err != nil {
+		return err
+	}
+
+	state, err := r.FindPolicyState(ctx)
+	if err != nil {
+		return err
+	}
+	seeded := make(map[string]bool, len(state.Seeded))
+	for _, key := range state.Seeded {
+		seeded[key] = true
+	}
+	retired := make(map[string]bool, len(state.Retired))
+	for _, key := range state.Retired {
+		retired[key] = true
+	}
+
+	defaults := make(map[string]bool, len(records))
+	keys := make([]string, 0)
+	for _, record := range records {
+		key := strings.Join(record, ", ")
+		defaults[key] = true
+		if seeded[key] {
+			continue
+		}
+
+		ptype := record[0]
+		if err := adapter.AddPolicy(ptype[:1], ptype, record[1:]); err != nil {
+			return err
+		}
+
+		changeID := primitive.NewObjectID()
+		if _, err := r.CreatePolicyChange(ctx, entity.PolicyChange{
+			ID:     &changeID,
+			Action: entity.PolicyChangeActionSeed,
+			PType:  ptype,
+			Rule:   record[1:],
+			At:     time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	// a rule back in the default file is not retired
+	retiredKeys := make([]string, 0)
+	for _, record := range retiredRecords {
+		key := strings.Join(record, ", ")
+		if retired[key] || defaults[key] {
+			continue
+		}
+
+		ptype := record[0]
+		if err := adapter.RemovePolicy(ptype[:1], ptype, record[1:]); err != nil {
+			return err
+		}
+
+		changeID := primitive.NewObjectID()
+		if _, err := r.CreatePolicyChange(ctx, entity.PolicyChange{
+			ID:     &changeID,
+			Action: entity.PolicyChangeActionRetire,
+			PType:  ptype,
+			Rule:   record[1:],
+			At:     time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
+		retiredKeys = append(retiredKeys, key)
+	}
+
+	if len(keys) == 0 && len(retiredKeys) == 0 {
+		return nil
+	}
+
+	if len(keys) > 0 {
+		if _, err := r.AddSeededPolicies(ctx, keys); err != nil {
+			return err
+		}
+	}
+	if len(retiredKeys) > 0 {
+		if _, err := r.AddRetiredPolicies(ctx, retiredKeys); err != nil {
+			return err
+		}
+	}
+
+	// running instances pick up the new rules
+	_, err = r.IncrementPolicyVersion(ctx)
+	return err
+}
+
+// readPolicyFile : rules of a policy file, lines starting with # are comments
+func readPolicyFile(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([][]string, 0, len(records))
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		rules = append(rules, record)
+	}
+	return rules, nil
+}
@@ -12,6 +12,17 @@ var (
 		"*"}
 )
 
+// BenchmarkMinPeers : minimum number of peer companies before a benchmark group is disclosed
+const BenchmarkMinPeers = 5
+
+// SMEProfileFields : SME attributes used to group benchmarks and in question conditions
+var SMEProfileFields = []string{
+	"msic",
+	"state",
+	"businessEntity",
+	"registeredInEastMY",
+}
+
 var UserDesignations = []entity.UserDesignation{
 	entity.DesignationManager,
 	entity.DesignationCEO,
@@ -1,6 +1,10 @@
 package entity
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // Admin :
 type Admin struct {
@@ -13,9 +17,21 @@ type Admin struct {
 	PasswordHash string              `bson:"passwordHash" json:"-"`
 	PasswordSalt string              `bson:"passwordSalt" json:"-"`
 	Role         UserRole            `bson:"role" json:"role"`
+	Scopes       []Scope             `bson:"scopes" json:"scopes"` // limits an admin with role USER to these scopes, none means full access
 	CompanyName  string              `bson:"companyName" json:"companyName"`
 	Position     string              `bson:"position" json:"position"`
 	ApprovedBy   *primitive.ObjectID `bson:"approvedBy" json:"approvedBy"`
 	Status       UserStatus          `bson:"status" json:"status"`
+	TwoFactor    TwoFactor           `bson:"twoFactor" json:"twoFactor"`
 	Model        `bson:",inline"`
 }
+
+// TwoFactor : TOTP second step of the login
+type TwoFactor struct {
+	Enabled       bool      `bson:"enabled" json:"enabled"`
+	EnabledAt     time.Time `bson:"enabledAt" json:"enabledAt"`
+	Secret        string    `bson:"secret" json:"-"`
+	PendingSecret string    `bson:"pendingSecret" json:"-"` // enrolled but not yet confirmed with a code
+	RecoveryCodes []string  `bson:"recoveryCodes" json:"-"` // hashed, each can be used once
+	LastUsedStep  int64     `bson:"lastUsedStep" json:"-"`  // time step of the last code, a code cannot be used twice
+}
@@ -11,15 +11,101 @@ type Assessment struct {
 	ID             *primitive.ObjectID `bson:"_id" json:"id"`
 	SMEID          *primitive.ObjectID `bson:"smeID" json:"smeID"`
 	QuestionSetID  *primitive.ObjectID `bson:"questionSetID" json:"questionSetID"`
-	SharedWiths    []LinkCorporate     `bson:"sharedWiths" json:"sharedWiths"`
+	Revision       int                 `bson:"revision" json:"revision"`     // pinned question set revision
+	CampaignID     *primitive.ObjectID `bson:"campaignID" json:"campaignID"` // set when sent by a corporate campaign
+	SharedWiths    []AssessmentShare   `bson:"sharedWiths" json:"sharedWiths"`
 	SerialNo       string              `bson:"serialNo" json:"serialNo"`
+	PeriodStart    time.Time           `bson:"periodStart" json:"periodStart"` // reporting period assessed
+	PeriodEnd      time.Time           `bson:"periodEnd" json:"periodEnd"`
 	CompletionDate time.Time           `bson:"completionDate" json:"completionDate"`
 	Report         string              `bson:"report" json:"report"`
 	ISODocs        []string            `bson:"isoDocs" json:"isoDocs"`
+	Score          *AssessmentScore    `bson:"score" json:"score"`
+	ReviewStatus   ReviewStatus        `bson:"reviewStatus" json:"reviewStatus"`
+	FinalizedAt    time.Time           `bson:"finalizedAt" json:"finalizedAt"`
+	FinalizedBy    *primitive.ObjectID `bson:"finalizedBy" json:"finalizedBy"`
+	History        []ReviewStep        `bson:"history" json:"history"`
 	Status         Status              `bson:"status" json:"status"`
 	Model          `bson:",inline"`
 }
 
+// ShareScope : part of an assessment a corporate may see
+type ShareScope string
+
+var (
+	ShareScopeScore    ShareScope = "SCORE"
+	ShareScopeAnswers  ShareScope = "ANSWERS"
+	ShareScopeEvidence ShareScope = "EVIDENCE"
+)
+
+// AssessmentShare : consent of the SME for a corporate to see the scopes of an assessment until ExpiresAt
+type AssessmentShare struct {
+	CorporateID *primitive.ObjectID `bson:"corporateID" json:"corporateID"`
+	LinkDate    time.Time           `bson:"linkDate" json:"linkDate"` // granted at
+	Status      Status              `bson:"status" json:"status"`
+	Scopes      []ShareScope        `bson:"scopes" json:"scopes"`
+	ExpiresAt   time.Time           `bson:"expiresAt" json:"expiresAt"`
+	GrantedBy   *primitive.ObjectID `bson:"grantedBy" json:"grantedBy"`
+	RevokedBy   *primitive.ObjectID `bson:"revokedBy" json:"revokedBy"`
+	RevokedAt   time.Time           `bson:"revokedAt" json:"revokedAt"`
+}
+
+// ShareAccessLog : a corporate user viewing an assessment shared with the corporate
+type ShareAccessLog struct {
+	ID           *primitive.ObjectID `bson:"_id" json:"id"`
+	AssessmentID *primitive.ObjectID `bson:"assessmentID" json:"assessmentID"`
+	SMEID        *primitive.ObjectID `bson:"smeID" json:"smeID"`
+	CorporateID  *primitive.ObjectID `bson:"corporateID" json:"corporateID"`
+	UserID       *primitive.ObjectID `bson:"userID" json:"userID"`
+	Scopes       []ShareScope        `bson:"scopes" json:"scopes"`         // scopes of the data returned
+	EvidenceID   *primitive.ObjectID `bson:"evidenceID" json:"evidenceID"` // set for evidence downloads
+	IPAddress    string              `bson:"ipAddress" json:"ipAddress"`
+	AccessedAt   time.Time           `bson:"accessedAt" json:"accessedAt"`
+}
+
+// ReviewStatus : progress of an assessment through review
+type ReviewStatus string
+
+var (
+	ReviewStatusInReview  ReviewStatus = "IN_REVIEW"
+	ReviewStatusReturned  ReviewStatus = "RETURNED"
+	ReviewStatusFinalized ReviewStatus = "FINALIZED"
+)
+
+// ReviewAction :
+type ReviewAction string
+
+var (
+	ReviewActionSubmitted ReviewAction = "SUBMITTED"
+	ReviewActionAccepted  ReviewAction = "ACCEPTED"
+	ReviewActionReturned  ReviewAction = "RETURNED"
+	ReviewActionFinalized ReviewAction = "FINALIZED"
+)
+
+// ReviewStep : who did what in the review of an assessment and when
+type ReviewStep struct {
+	Action  ReviewAction        `bson:"action" json:"action"`
+	Comment string              `bson:"comment" json:"comment"`
+	By      *primitive.ObjectID `bson:"by" json:"by"`
+	Role    string              `bson:"role" json:"role"`
+	At      time.Time           `bson:"at" json:"at"`
+}
+
+// AssessmentScore :
+type AssessmentScore struct {
+	Dimensions []DimensionScore `bson:"dimensions" json:"dimensions"`
+	Overall    float64          `bson:"overall" json:"overall"`
+	ScoredAt   time.Time        `bson:"scoredAt" json:"scoredAt"`
+}
+
+// DimensionScore : score of a dimension is a percentage (0 - 100)
+type DimensionScore struct {
+	Dimension string  `bson:"dimension" json:"dimension"`
+	Score     float64 `bson:"score" json:"score"`
+	Weight    float64 `bson:"weight" json:"weight"`
+	Scored    int     `bson:"scored" json:"scored"`
+}
+
 // AssessmentEntry :
 type AssessmentEntry struct {
 	ID                *primitive.ObjectID `bson:"_id" json:"id"`
@@ -30,7 +116,10 @@ type AssessmentEntry struct {
 	Question          *Question           `bson:"question" json:"question"`
 	QuestionType      QuestionType        `bson:"questionType" json:"questionType"`
 	Answer            Answer              `bson:"answer" json:"answer"`
+	Skipped           bool                `bson:"skipped" json:"skipped"` // display conditions of the question do not hold
 	SubmittedDateTime time.Time           `bson:"submittedAt" json:"submittedAt"`
 	RespondStatus     RespondStatus       `bson:"respondStatus" json:"respondStatus"`
+	Comment           string              `bson:"comment" json:"comment"` // latest reviewer comment
+	History           []ReviewStep        `bson:"history" json:"history"`
 	Model             `bson:",inline"`
 }
@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Campaign : a question set a corporate sends to a batch of its connected SMEs, every participant gets an assessment
+// to complete by the deadline
+type Campaign struct {
+	ID            *primitive.ObjectID   `bson:"_id" json:"id"`
+	CorporateID   *primitive.ObjectID   `bson:"corporateID" json:"corporateID"`
+	Name          string                `bson:"name" json:"name"`
+	QuestionSetID *primitive.ObjectID   `bson:"questionSetID" json:"questionSetID"`
+	Revision      int                   `bson:"revision" json:"revision"`
+	PeriodStart   time.Time             `bson:"periodStart" json:"periodStart"`
+	PeriodEnd     time.Time             `bson:"periodEnd" json:"periodEnd"`
+	Deadline      time.Time             `bson:"deadline" json:"deadline"`
+	ReminderDays  []int                 `bson:"reminderDays" json:"reminderDays"` // days before the deadline a reminder goes out
+	Participants  []CampaignParticipant `bson:"participants" json:"participants"`
+	CreatedBy     *primitive.ObjectID   `bson:"createdBy" json:"createdBy"`
+	Status        Status                `bson:"status" json:"status"`
+	Model         `bson:",inline"`
+}
+
+// CampaignParticipant : an SME of a campaign and the assessment created for it
+type CampaignParticipant struct {
+	SMEID          *primitive.ObjectID `bson:"smeID" json:"smeID"`
+	AssessmentID   *primitive.ObjectID `bson:"assessmentID" json:"assessmentID"`
+	RemindersSent  []int               `bson:"remindersSent" json:"remindersSent"` // reminder days already sent
+	LastRemindedAt time.Time           `bson:"lastRemindedAt" json:"lastRemindedAt"`
+}
+
+// CampaignProgress : how far a participant is with the assessment of a campaign
+type CampaignProgress string
+
+var (
+	CampaignProgressNotStarted CampaignProgress = "NOT_STARTED"
+	CampaignProgressInProgress CampaignProgress = "IN_PROGRESS"
+	CampaignProgressSubmitted  CampaignProgress = "SUBMITTED" // waiting for review
+	CampaignProgressReturned   CampaignProgress = "RETURNED"
+	CampaignProgressCompleted  CampaignProgress = "COMPLETED"
+)
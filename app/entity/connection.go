@@ -6,11 +6,17 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Connection :
+// Connection : invitation of an SME to the supply chain of a corporate, RequestCompanyID is the corporate and
+// ReceivedCompanyID the SME. An accepted connection is mirrored in SME.LinkedWiths.
 type Connection struct {
 	ID                *primitive.ObjectID `bson:"_id" json:"id"`
 	RequestCompanyID  *primitive.ObjectID `bson:"requestCompanyID" json:"requestCompanyID"`
 	ReceivedCompanyID *primitive.ObjectID `bson:"receivedCompanyID" json:"receivedCompanyID"`
 	LinkDate          time.Time           `bson:"linkDate" json:"linkDate"`
-	Status            Status              `bson:"status" json:"status" validate:"eq=INVITED|eq=ACTIVE"`
+	Status            Status              `bson:"status" json:"status" validate:"eq=INVITED|eq=ACTIVE|eq=REJECTED|eq=INACTIVE"`
+	InvitedEmail      string              `bson:"invitedEmail" json:"invitedEmail"`
+	InvitedBy         *primitive.ObjectID `bson:"invitedBy" json:"invitedBy"`
+	InvitedAt         time.Time           `bson:"invitedAt" json:"invitedAt"`
+	RespondedBy       *primitive.ObjectID `bson:"respondedBy" json:"respondedBy"`
+	RespondedAt       time.Time           `bson:"respondedAt" json:"respondedAt"`
 }
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Corporate : a supply chain owner, SMEs link with it as its vendors
+type Corporate struct {
+	ID             *primitive.ObjectID `bson:"_id" json:"id"`
+	CompanyName    string              `bson:"companyName" json:"companyName"`
+	SSMNumber      string              `bson:"ssmNumber" json:"ssmNumber"`
+	BusinessEntity BusinessEntity      `bson:"businessEntity" json:"businessEntity"`
+	State          string              `bson:"state" json:"state"`
+	PostCode       string              `bson:"postCode" json:"postCode"`
+	MSIC           string              `bson:"msic" json:"msic"`
+	SSMDoc         string              `bson:"ssmDoc" json:"ssmDoc"`
+	ProfilePicture string              `bson:"profilePicture" json:"profilePicture"`
+	Status         Status              `bson:"status" json:"status"`
+	ApprovedBy     *primitive.ObjectID `bson:"approvedBy" json:"approvedBy"`
+	Model          `bson:",inline"`
+}
+
+// CorporateUser : a user of a corporate, role ADMIN manages the corporate and its users
+type CorporateUser struct {
+	ID             *primitive.ObjectID `bson:"_id" json:"id"`
+	CompanyID      *primitive.ObjectID `bson:"companyID" json:"companyID"`
+	FirstName      string              `bson:"firstName" json:"firstName"`
+	LastName       string              `bson:"lastName" json:"lastName"`
+	Title          UserTitle           `bson:"title" json:"title"`
+	Email          string              `bson:"email" json:"email"`
+	Contact        string              `bson:"contact" json:"contact"`
+	MobileContact  string              `bson:"mobileContact" json:"mobileContact"`
+	Position       string              `bson:"position" json:"position"`
+	ProfilePicture string              `bson:"profilePicture" json:"profilePicture"`
+	PasswordHash   string              `bson:"passwordHash" json:"-"`
+	PasswordSalt   string              `bson:"passwordSalt" json:"-"`
+	Status         UserStatus          `bson:"status" json:"status"`
+	Role           UserRole            `bson:"role" json:"role"`
+	LastLoginAt    time.Time           `bson:"lastLoginAt" json:"lastLoginAt"`
+	Model          `bson:",inline"`
+}
@@ -0,0 +1,93 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmissionScope : GHG protocol scope
+type EmissionScope string
+
+var (
+	EmissionScope1 EmissionScope = "SCOPE_1" // direct emissions, e.g. fuel burnt on site and company vehicles
+	EmissionScope2 EmissionScope = "SCOPE_2" // purchased electricity
+	EmissionScope3 EmissionScope = "SCOPE_3" // other indirect emissions, e.g. business travel and waste
+)
+
+// GridRegion : Malaysian electricity grids
+type GridRegion string
+
+var (
+	GridRegionPeninsular GridRegion = "PENINSULAR"
+	GridRegionSabah      GridRegion = "SABAH"
+	GridRegionSarawak    GridRegion = "SARAWAK"
+)
+
+// EmissionFactorTableState :
+type EmissionFactorTableState string
+
+var (
+	EmissionFactorTableStateDraft     EmissionFactorTableState = "DRAFT"
+	EmissionFactorTableStatePublished EmissionFactorTableState = "PUBLISHED"
+	EmissionFactorTableStateRetired   EmissionFactorTableState = "RETIRED"
+)
+
+// EmissionFactor : kgCO2e emitted per unit of an activity
+type EmissionFactor struct {
+	Activity string        `bson:"activity" json:"activity" form:"activity" validate:"required"`
+	Label    string        `bson:"label" json:"label" form:"label"`
+	Scope    EmissionScope `bson:"scope" json:"scope" form:"scope" validate:"required,eq=SCOPE_1|eq=SCOPE_2|eq=SCOPE_3"`
+	Region   GridRegion    `bson:"region" json:"region" form:"region"` // empty when the factor applies everywhere
+	Unit     string        `bson:"unit" json:"unit" form:"unit" validate:"required"`
+	Factor   float64       `bson:"factor" json:"factor" form:"factor" validate:"gte=0"`
+	Source   string        `bson:"source" json:"source" form:"source"`
+}
+
+// EmissionFactorTable : a version of the emission factors, only published tables are used in calculation
+type EmissionFactorTable struct {
+	ID          *primitive.ObjectID      `bson:"_id" json:"id"`
+	Version     int                      `bson:"version" json:"version"`
+	Label       string                   `bson:"label" json:"label"`
+	Factors     []EmissionFactor         `bson:"factors" json:"factors"`
+	State       EmissionFactorTableState `bson:"state" json:"state"`
+	PublishedAt time.Time                `bson:"publishedAt" json:"publishedAt"`
+	PublishedBy *primitive.ObjectID      `bson:"publishedBy" json:"publishedBy"`
+	RetiredAt   time.Time                `bson:"retiredAt" json:"retiredAt"`
+	Status      Status                   `bson:"status" json:"status"`
+	Model       `bson:",inline"`
+}
+
+// EmissionActivity : activity data entered by the SME and the emission calculated from it
+type EmissionActivity struct {
+	Activity string        `bson:"activity" json:"activity" form:"activity" validate:"required"`
+	Quantity float64       `bson:"quantity" json:"quantity" form:"quantity" validate:"gte=0"`
+	Region   GridRegion    `bson:"region" json:"region" form:"region"`
+	Unit     string        `bson:"unit" json:"unit"`
+	Scope    EmissionScope `bson:"scope" json:"scope"`
+	Factor   float64       `bson:"factor" json:"factor"`
+	Emission float64       `bson:"emission" json:"emission"` // tCO2e
+}
+
+// EmissionResult : tCO2e per scope
+type EmissionResult struct {
+	Scope1 float64 `bson:"scope1" json:"scope1"`
+	Scope2 float64 `bson:"scope2" json:"scope2"`
+	Scope3 float64 `bson:"scope3" json:"scope3"`
+	Total  float64 `bson:"total" json:"total"`
+}
+
+// EmissionInventory : emissions of an SME over a reporting period
+type EmissionInventory struct {
+	ID            *primitive.ObjectID `bson:"_id" json:"id"`
+	SMEID         *primitive.ObjectID `bson:"smeID" json:"smeID"`
+	PeriodStart   time.Time           `bson:"periodStart" json:"periodStart"`
+	PeriodEnd     time.Time           `bson:"periodEnd" json:"periodEnd"`
+	FactorTableID *primitive.ObjectID `bson:"factorTableID" json:"factorTableID"`
+	FactorVersion int                 `bson:"factorVersion" json:"factorVersion"`
+	Activities    []EmissionActivity  `bson:"activities" json:"activities"`
+	Result        EmissionResult      `bson:"result" json:"result"`
+	CalculatedAt  time.Time           `bson:"calculatedAt" json:"calculatedAt"`
+	Status        Status              `bson:"status" json:"status"`
+	Model         `bson:",inline"`
+}
@@ -19,6 +19,22 @@ const (
 	CollectionNews             Collection = "news"
 	CollectionSubscription     Collection = "subscription"
 	CollectionConnection       Collection = "connection"
+	CollectionEmissionFactor   Collection = "emissionFactorTable"
+	CollectionEmission         Collection = "emissionInventory"
+	CollectionEvidence         Collection = "evidence"
+	CollectionRefreshToken     Collection = "refreshToken"
+	CollectionSession          Collection = "session"
+	CollectionPasswordReset    Collection = "passwordReset"
+	CollectionLoginThrottle    Collection = "loginThrottle"
+	CollectionLockoutEvent     Collection = "lockoutEvent"
+	CollectionCasbinRule       Collection = "casbinRule"
+	CollectionPolicyChange     Collection = "policyChange"
+	CollectionPolicyState      Collection = "policyState"
+	CollectionOIDCProvider     Collection = "oidcProvider"
+	CollectionOIDCLogin        Collection = "oidcLogin"
+	CollectionOIDCIdentity     Collection = "oidcIdentity"
+	CollectionShareAccessLog   Collection = "shareAccessLog"
+	CollectionCampaign         Collection = "campaign"
 )
 
 // Model :
@@ -32,12 +48,13 @@ type Model struct {
 type UserStatus string
 
 var (
-	UserStatusActive    UserStatus = "ACTIVE"
-	UserStatusInActive  UserStatus = "INACTIVE"
-	UserStatusSuspended UserStatus = "SUSPENDED"
-	UserStatusInvited   UserStatus = "INVITED"
-	UserStatusExpired   UserStatus = "EXPIRED"
-	UserStatusDeleted   UserStatus = "DELETED"
+	UserStatusActive     UserStatus = "ACTIVE"
+	UserStatusInActive   UserStatus = "INACTIVE"
+	UserStatusSuspended  UserStatus = "SUSPENDED"
+	UserStatusInvited    UserStatus = "INVITED"
+	UserStatusUnverified UserStatus = "UNVERIFIED" // self registered, waiting for email verification
+	UserStatusExpired    UserStatus = "EXPIRED"
+	UserStatusDeleted    UserStatus = "DELETED"
 )
 
 // Status :
@@ -65,6 +82,8 @@ var (
 	ResponseStatusInProgress  RespondStatus = "IN_PROGRESS"
 	ResponseStatusToReview    RespondStatus = "TO_REVIEW"
 	ResponseStatusToSubmitted RespondStatus = "SUBMITTED"
+	ResponseStatusAccepted    RespondStatus = "ACCEPTED"
+	ResponseStatusReturned    RespondStatus = "RETURNED"
 	ResponseStatusDeleted     RespondStatus = "DELETED"
 )
 
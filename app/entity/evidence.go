@@ -0,0 +1,26 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Evidence : document backing the answer of an assessment entry
+type Evidence struct {
+	ID                *primitive.ObjectID `bson:"_id" json:"id"`
+	AssessmentID      *primitive.ObjectID `bson:"assessmentID" json:"assessmentID"`
+	AssessmentEntryID *primitive.ObjectID `bson:"assessmentEntryID" json:"assessmentEntryID"`
+	SMEID             *primitive.ObjectID `bson:"smeID" json:"smeID"`
+	QuestionID        *primitive.ObjectID `bson:"questionID" json:"questionID"`
+	FileName          string              `bson:"fileName" json:"fileName"` // name of the file uploaded
+	Path              string              `bson:"path" json:"path"`
+	ContentType       string              `bson:"contentType" json:"contentType"`
+	Size              int64               `bson:"size" json:"size"`
+	SHA256            string              `bson:"sha256" json:"sha256"`
+	UploadedBy        *primitive.ObjectID `bson:"uploadedBy" json:"uploadedBy"`
+	UploadedByRole    string              `bson:"uploadedByRole" json:"uploadedByRole"`
+	UploadedAt        time.Time           `bson:"uploadedAt" json:"uploadedAt"`
+	Status            Status              `bson:"status" json:"status"`
+	Model             `bson:",inline"`
+}
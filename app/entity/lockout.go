@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginThrottleKind :
+type LoginThrottleKind string
+
+var (
+	LoginThrottleKindAccount LoginThrottleKind = "ACCOUNT"
+	LoginThrottleKindIP      LoginThrottleKind = "IP"
+)
+
+// LoginThrottle : failed logins of an account or an ip address, the id is the kind and value e.g. IP:10.0.0.1
+type LoginThrottle struct {
+	ID            string            `bson:"_id" json:"id"`
+	Kind          LoginThrottleKind `bson:"kind" json:"kind"`
+	Failures      int               `bson:"failures" json:"failures"` // consecutive failures within the failure window
+	LastFailureAt time.Time         `bson:"lastFailureAt" json:"lastFailureAt"`
+	LockedUntil   time.Time         `bson:"lockedUntil" json:"lockedUntil"`
+	UpdatedAt     time.Time         `bson:"updatedAt" json:"updatedAt"`
+}
+
+// LockoutEventType :
+type LockoutEventType string
+
+var (
+	LockoutEventTypeLocked   LockoutEventType = "LOCKED"
+	LockoutEventTypeUnlocked LockoutEventType = "UNLOCKED"
+)
+
+// LockoutEvent : audit record of an account or ip address being locked or unlocked
+type LockoutEvent struct {
+	ID          *primitive.ObjectID `bson:"_id" json:"id"`
+	Type        LockoutEventType    `bson:"type" json:"type"`
+	Kind        LoginThrottleKind   `bson:"kind" json:"kind"`
+	Key         string              `bson:"key" json:"key"`
+	Failures    int                 `bson:"failures" json:"failures"`
+	LockedUntil time.Time           `bson:"lockedUntil" json:"lockedUntil"`
+	IPAddress   string              `bson:"ipAddress" json:"ipAddress"` // ip of the request which caused the event
+	By          *primitive.ObjectID `bson:"by" json:"by"`               // admin who unlocked
+	At          time.Time           `bson:"at" json:"at"`
+}
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OIDCProvider : an OpenID Connect identity provider users can sign in with
+type OIDCProvider struct {
+	ID             *primitive.ObjectID `bson:"_id" json:"id"`
+	Name           string              `bson:"name" json:"name"`
+	Issuer         string              `bson:"issuer" json:"issuer"`
+	ClientID       string              `bson:"clientID" json:"clientID"`
+	ClientSecret   string              `bson:"clientSecret" json:"-"` // empty for public clients, PKCE protects the code
+	Scopes         []string            `bson:"scopes" json:"scopes"`
+	RedirectURIs   []string            `bson:"redirectURIs" json:"redirectURIs"`
+	AccountType    AccountType         `bson:"accountType" json:"accountType"`
+	CompanyID      *primitive.ObjectID `bson:"companyID" json:"companyID"`           // SME of provisioned SME users
+	AllowedDomains []string            `bson:"allowedDomains" json:"allowedDomains"` // email domains which can sign in, none means any, required for admin providers and SME providers without a company
+	Provision      bool                `bson:"provision" json:"provision"`           // create an account on the first login when no account has the email
+	DefaultRole    UserRole            `bson:"defaultRole" json:"defaultRole"`       // role of provisioned accounts
+	DefaultScopes  []Scope             `bson:"defaultScopes" json:"defaultScopes"`   // scopes of provisioned admins
+	Status         Status              `bson:"status" json:"status"`
+	Model          `bson:",inline"`
+}
+
+// OIDCLogin : a started authorization code flow, waiting for the callback
+type OIDCLogin struct {
+	ID           *primitive.ObjectID `bson:"_id" json:"id"`
+	ProviderID   *primitive.ObjectID `bson:"providerID" json:"providerID"`
+	StateHash    string              `bson:"stateHash" json:"-"`
+	Nonce        string              `bson:"nonce" json:"-"`
+	CodeVerifier string              `bson:"codeVerifier" json:"-"`
+	RedirectURI  string              `bson:"redirectURI" json:"redirectURI"`
+	IPAddress    string              `bson:"ipAddress" json:"ipAddress"`
+	ExpiresAt    time.Time           `bson:"expiresAt" json:"expiresAt"`
+	UsedAt       time.Time           `bson:"usedAt" json:"usedAt"`
+	Model        `bson:",inline"`
+}
+
+// OIDCIdentity : an account linked to the subject of an identity provider
+type OIDCIdentity struct {
+	ID          *primitive.ObjectID `bson:"_id" json:"id"`
+	ProviderID  *primitive.ObjectID `bson:"providerID" json:"providerID"`
+	Subject     string              `bson:"subject" json:"subject"`
+	AccountType AccountType         `bson:"accountType" json:"accountType"`
+	UserID      *primitive.ObjectID `bson:"userID" json:"userID"`
+	Email       string              `bson:"email" json:"email"`
+	LastLoginAt time.Time           `bson:"lastLoginAt" json:"lastLoginAt"`
+	Model       `bson:",inline"`
+}
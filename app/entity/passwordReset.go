@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccountType : collection a login account is stored in
+type AccountType string
+
+var (
+	AccountTypeAdmin         AccountType = "ADMIN" // admins and vendors
+	AccountTypeSMEUser       AccountType = "SME_USER"
+	AccountTypeCorporateUser AccountType = "CORPORATE_USER"
+)
+
+// PasswordResetStatus :
+type PasswordResetStatus string
+
+var (
+	PasswordResetStatusActive    PasswordResetStatus = "ACTIVE"
+	PasswordResetStatusUsed      PasswordResetStatus = "USED"
+	PasswordResetStatusCancelled PasswordResetStatus = "CANCELLED" // replaced by a newer request
+	PasswordResetStatusRequested PasswordResetStatus = "REQUESTED" // no active account has the email
+)
+
+// PasswordReset : a forgot password request, only the hash of the emailed token is stored
+type PasswordReset struct {
+	ID          *primitive.ObjectID `bson:"_id" json:"id"`
+	UserID      *primitive.ObjectID `bson:"userID" json:"userID"`
+	AccountType AccountType         `bson:"accountType" json:"accountType"`
+	Email       string              `bson:"email" json:"email"`
+	TokenHash   string              `bson:"tokenHash" json:"-"`
+	ExpiresAt   time.Time           `bson:"expiresAt" json:"expiresAt"`
+	UsedAt      time.Time           `bson:"usedAt" json:"usedAt"`
+	IPAddress   string              `bson:"ipAddress" json:"ipAddress"`
+	Status      PasswordResetStatus `bson:"status" json:"status"`
+	Model       `bson:",inline"`
+}
@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CasbinRule : a policy (p) or role grouping (g) line of the casbin policy
+type CasbinRule struct {
+	ID    *primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PType string              `bson:"ptype" json:"ptype"`
+	V0    string              `bson:"v0" json:"v0"`
+	V1    string              `bson:"v1" json:"v1"`
+	V2    string              `bson:"v2" json:"v2"`
+	V3    string              `bson:"v3" json:"v3"`
+	V4    string              `bson:"v4" json:"v4"`
+	V5    string              `bson:"v5" json:"v5"`
+}
+
+// PolicyRule :
+type PolicyRule struct {
+	PType string   `json:"ptype"`
+	Rule  []string `json:"rule"`
+}
+
+// PolicyChangeAction :
+type PolicyChangeAction string
+
+var (
+	PolicyChangeActionAdd    PolicyChangeAction = "ADD"
+	PolicyChangeActionRemove PolicyChangeAction = "REMOVE"
+	PolicyChangeActionSeed   PolicyChangeAction = "SEED"   // imported from the default policy file on start up
+	PolicyChangeActionRetire PolicyChangeAction = "RETIRE" // default rule taken out of the policy file, removed on start up
+)
+
+// PolicyChange : audit log of policy edits
+type PolicyChange struct {
+	ID     *primitive.ObjectID `bson:"_id" json:"id"`
+	Action PolicyChangeAction  `bson:"action" json:"action"`
+	PType  string              `bson:"ptype" json:"ptype"`
+	Rule   []string            `bson:"rule" json:"rule"`
+	By     *primitive.ObjectID `bson:"by" json:"by"`
+	At     time.Time           `bson:"at" json:"at"`
+}
+
+// PolicyState : version of the stored policy, every instance reloads the policy when it changes
+type PolicyState struct {
+	ID        string    `bson:"_id" json:"id"`
+	Version   int64     `bson:"version" json:"version"`
+	Seeded    []string  `bson:"seeded" json:"seeded"`   // default rules already imported, removed ones are not imported again
+	Retired   []string  `bson:"retired" json:"retired"` // retired default rules already removed, added again ones stay
+	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+}
@@ -1,6 +1,10 @@
 package entity
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // QuestionType :
 type QuestionType string
@@ -9,32 +13,90 @@ var (
 	QuestionTypePsychographic QuestionType = "PSYCHOGRAPHIC"
 	QuestionTypeDemographic   QuestionType = "DEMOGRAPHIC"
 	QuestionTypeUpload        QuestionType = "UPLOAD"
+	QuestionTypeNumeric       QuestionType = "NUMERIC"
+	QuestionTypeSingleChoice  QuestionType = "SINGLE_CHOICE"
+	QuestionTypeMultiChoice   QuestionType = "MULTI_CHOICE"
+	QuestionTypeDate          QuestionType = "DATE"
+	QuestionTypePercentage    QuestionType = "PERCENTAGE"
+	QuestionTypeMatrix        QuestionType = "MATRIX"
+)
+
+// QuestionSetState : lifecycle of a question set revision
+type QuestionSetState string
+
+var (
+	QuestionSetStateDraft     QuestionSetState = "DRAFT"
+	QuestionSetStatePublished QuestionSetState = "PUBLISHED"
+	QuestionSetStateRetired   QuestionSetState = "RETIRED"
+)
+
+// ConditionSource :
+type ConditionSource string
+
+var (
+	ConditionSourceAnswer ConditionSource = "ANSWER"
+	ConditionSourceSME    ConditionSource = "SME"
+)
+
+// ConditionOperator :
+type ConditionOperator string
+
+var (
+	ConditionOperatorIn     ConditionOperator = "IN"
+	ConditionOperatorNotIn  ConditionOperator = "NOT_IN"
+	ConditionOperatorPrefix ConditionOperator = "PREFIX"
 )
 
+// Condition : a question is only shown when all of its conditions hold
+type Condition struct {
+	Source     ConditionSource     `bson:"source" json:"source" form:"source"`
+	QuestionID *primitive.ObjectID `bson:"questionID" json:"questionID" form:"questionID"` // origin id of the question answered
+	Field      string              `bson:"field" json:"field" form:"field"`                // SME profile field
+	Operator   ConditionOperator   `bson:"operator" json:"operator" form:"operator"`
+	Values     []string            `bson:"values" json:"values" form:"values"`
+}
+
 // Answer :
 type Answer struct {
-	Bool bool     `bson:"scalar" json:"scalar" form:"scalar"`
-	Text []string `bson:"text" json:"text" form:"text"`
+	Bool   bool              `bson:"scalar" json:"scalar" form:"scalar"`
+	Text   []string          `bson:"text" json:"text" form:"text"`
+	Number *float64          `bson:"number" json:"number" form:"number"` // numeric and percentage questions
+	Date   *time.Time        `bson:"date" json:"date" form:"date"`
+	Matrix map[string]string `bson:"matrix" json:"matrix" form:"matrix"` // chosen option of each matrix row
 }
 
 // Question :
 type Question struct {
 	ID            *primitive.ObjectID `bson:"_id" json:"id"`
 	QuestionSetID *primitive.ObjectID `bson:"questionSetID" json:"questionSetID"`
+	OriginID      *primitive.ObjectID `bson:"originID" json:"originID"` // same question across revisions
 	Dimension     string              `bson:"dimension" json:"dimension"`
 	// SubCategory   string              `bson:"subCategory" json:"subCategory"`
 	// Indicator     string              `bson:"indicator" json:"indicator"`
 	QuestionLabel string       `bson:"questionLabel" json:"questionLabel"`
 	QuestionType  QuestionType `bson:"questionType" json:"questionType"`
 	Options       []string     `bson:"options" json:"options"`
+	Rows          []string     `bson:"rows" json:"rows"` // matrix rows, options are the columns
+	Unit          string       `bson:"unit" json:"unit"`
+	Min           *float64     `bson:"min" json:"min"`
+	Max           *float64     `bson:"max" json:"max"`
+	Weight        float64      `bson:"weight" json:"weight"`
+	Conditions    []Condition  `bson:"conditions" json:"conditions"`
 	Status        Status       `bson:"status" json:"status"`
 	Model         `bson:",inline"`
 }
 
 // QuestionSet :
 type QuestionSet struct {
-	ID     *primitive.ObjectID `bson:"_id" json:"id"`
-	Label  string              `bson:"label" json:"label"`
-	Status Status              `bson:"status" json:"status"`
-	Model  `bson:",inline"`
+	ID          *primitive.ObjectID `bson:"_id" json:"id"`
+	RevisionOf  *primitive.ObjectID `bson:"revisionOf" json:"revisionOf"` // first revision of the question set
+	Revision    int                 `bson:"revision" json:"revision"`
+	Label       string              `bson:"label" json:"label"`
+	Weights     map[string]float64  `bson:"weights" json:"weights"` // dimension weights used in overall score
+	State       QuestionSetState    `bson:"state" json:"state"`
+	PublishedAt time.Time           `bson:"publishedAt" json:"publishedAt"`
+	PublishedBy *primitive.ObjectID `bson:"publishedBy" json:"publishedBy"`
+	RetiredAt   time.Time           `bson:"retiredAt" json:"retiredAt"`
+	Status      Status              `bson:"status" json:"status"`
+	Model       `bson:",inline"`
 }
@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshTokenStatus :
+type RefreshTokenStatus string
+
+var (
+	RefreshTokenStatusActive  RefreshTokenStatus = "ACTIVE"
+	RefreshTokenStatusUsed    RefreshTokenStatus = "USED" // exchanged for a new pair, refresh tokens are single use
+	RefreshTokenStatusRevoked RefreshTokenStatus = "REVOKED"
+)
+
+// RefreshToken : server side record of an issued refresh token, the id is the jti claim of the token
+type RefreshToken struct {
+	ID         *primitive.ObjectID `bson:"_id" json:"id"`
+	UserID     *primitive.ObjectID `bson:"userID" json:"userID"`
+	SessionID  *primitive.ObjectID `bson:"sessionID" json:"sessionID"` // login the token belongs to, kept by every rotated token
+	ExpiresAt  time.Time           `bson:"expiresAt" json:"expiresAt"`
+	UsedAt     time.Time           `bson:"usedAt" json:"usedAt"`
+	ReplacedBy *primitive.ObjectID `bson:"replacedBy" json:"replacedBy"`
+	RevokedAt  time.Time           `bson:"revokedAt" json:"revokedAt"`
+	Status     RefreshTokenStatus  `bson:"status" json:"status"`
+	Model      `bson:",inline"`
+}
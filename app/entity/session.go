@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionStatus :
+type SessionStatus string
+
+var (
+	SessionStatusActive  SessionStatus = "ACTIVE"
+	SessionStatusRevoked SessionStatus = "REVOKED"
+)
+
+// Session : a login of a user on one device, the id is the jti claim of its access tokens
+type Session struct {
+	ID         *primitive.ObjectID `bson:"_id" json:"id"`
+	UserID     *primitive.ObjectID `bson:"userID" json:"userID"`
+	UserAgent  string              `bson:"userAgent" json:"userAgent"`
+	IPAddress  string              `bson:"ipAddress" json:"ipAddress"`
+	ExpiresAt  time.Time           `bson:"expiresAt" json:"expiresAt"` // expiry of the latest refresh token
+	LastUsedAt time.Time           `bson:"lastUsedAt" json:"lastUsedAt"`
+	RevokedAt  time.Time           `bson:"revokedAt" json:"revokedAt"`
+	RevokedBy  *primitive.ObjectID `bson:"revokedBy" json:"revokedBy"`
+	Status     SessionStatus       `bson:"status" json:"status"`
+	Model      `bson:",inline"`
+}
@@ -9,10 +9,11 @@ import (
 // Config :
 var Config = struct {
 	App struct {
-		SystemPath      string `env:"SYSTEM_HOST_PATH,required"`
-		AdminPortalPath string `env:"ADMIN_PORTAL_PATH,required"`
-		UserPortalPath  string `env:"USER_PORTAL_PATH,required"`
-		Env             string `env:"ENV,required"`
+		SystemPath      string   `env:"SYSTEM_HOST_PATH,required"`
+		AdminPortalPath string   `env:"ADMIN_PORTAL_PATH,required"`
+		UserPortalPath  string   `env:"USER_PORTAL_PATH,required"`
+		Env             string   `env:"ENV,required"`
+		TrustedProxies  []string `env:"TRUSTED_PROXIES" envSeparator:","` // ip ranges of the proxies in front of the api, none means clients connect directly
 	}
 	Storage struct {
 		Path string `env:"STORAGE_PATH,required"`
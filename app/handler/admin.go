@@ -9,7 +9,6 @@ import (
 
 	"csi-api/app/entity"
 	"csi-api/app/env"
-	"csi-api/app/kit/jwt"
 	"csi-api/app/kit/password"
 	"csi-api/app/repository"
 	"csi-api/app/response"
@@ -51,17 +50,18 @@ func (h Handler) GetAdmins(c echo.Context) error {
 func (h Handler) UpdateAdmin(c echo.Context) error {
 	adminId := c.QueryParam("id")
 	var i struct {
-		FirstName   string `json:"firstName" form:"firstName" validate:"max=50"`
-		LastName    string `json:"lastName" form:"lastName" validate:"max=50"`
-		IC          string `json:"ic" form:"ic" validate:"max=12"`
-		Email       string `json:"email" form:"email" validate:"max=100"`
-		Contact     string `json:"contact" form:"contact" validate:"max=12"`
-		CompanyName string `json:"companyName" form:"companyName" validate:"max=50"`
-		Position    string `json:"position" form:"position" validate:"max=50"`
-		ApprovedBy  string `json:"approvedBy" form:"approvedBy" validate:"max=50"`
-		Password    string `json:"password" form:"password" validate:"max=20"`
-		Role        string `json:"role" form:"role" validate:"max=20"`
-		Status      string `json:"status" form:"status" validate:"max=10"`
+		FirstName   string         `json:"firstName" form:"firstName" validate:"max=50"`
+		LastName    string         `json:"lastName" form:"lastName" validate:"max=50"`
+		IC          string         `json:"ic" form:"ic" validate:"max=12"`
+		Email       string         `json:"email" form:"email" validate:"max=100"`
+		Contact     string         `json:"contact" form:"contact" validate:"max=12"`
+		CompanyName string         `json:"companyName" form:"companyName" validate:"max=50"`
+		Position    string         `json:"position" form:"position" validate:"max=50"`
+		ApprovedBy  string         `json:"approvedBy" form:"approvedBy" validate:"max=50"`
+		Password    string         `json:"password" form:"password" validate:"max=20"`
+		Role        string         `json:"role" form:"role" validate:"max=20"`
+		Scopes      []entity.Scope `json:"scopes" form:"scopes" validate:"scope"`
+		Status      string         `json:"status" form:"status" validate:"max=10"`
 	}
 
 	// bind req input
@@ -140,6 +140,11 @@ func (h Handler) UpdateAdmin(c echo.Context) error {
 		admin.Role = entity.UserRole(i.Role)
 	}
 
+	// an empty list clears the scopes
+	if i.Scopes != nil {
+		admin.Scopes = i.Scopes
+	}
+
 	if i.Status != "" {
 		admin.Status = entity.UserStatus(i.Status)
 	}
@@ -168,16 +173,17 @@ func (h Handler) UpdateAdmin(c echo.Context) error {
 // CreateAdmin :
 func (h Handler) CreateAdmin(c echo.Context) error {
 	var i struct {
-		FirstName   string `json:"firstName" form:"firstName" validate:"required,max=50"`
-		LastName    string `json:"lastName" form:"lastName" validate:"required,max=50"`
-		IC          string `json:"ic" form:"ic" validate:"max=12"`
-		Email       string `json:"email" form:"email" validate:"required,email,min=10,max=100"`
-		Contact     string `json:"contact" form:"contact" validate:"required,min=10,max=12"`
-		CompanyName string `json:"companyName" form:"companyName" validate:"required,max=100"`
-		Position    string `json:"position" form:"position" validate:"required,max=50"`
-		ApprovedBy  string `json:"approvedBy" form:"approvedBy" validate:"required,max=50"`
-		Password    string `json:"password" form:"password" validate:"required,min=6,max=20"`
-		Role        string `json:"role" form:"role" validate:"required,eq=USER|eq=SME_VENDOR|eq=CORPORATE_VENDOR"`
+		FirstName   string         `json:"firstName" form:"firstName" validate:"required,max=50"`
+		LastName    string         `json:"lastName" form:"lastName" validate:"required,max=50"`
+		IC          string         `json:"ic" form:"ic" validate:"max=12"`
+		Email       string         `json:"email" form:"email" validate:"required,email,min=10,max=100"`
+		Contact     string         `json:"contact" form:"contact" validate:"required,min=10,max=12"`
+		CompanyName string         `json:"companyName" form:"companyName" validate:"required,max=100"`
+		Position    string         `json:"position" form:"position" validate:"required,max=50"`
+		ApprovedBy  string         `json:"approvedBy" form:"approvedBy" validate:"required,max=50"`
+		Password    string         `json:"password" form:"password" validate:"required,min=6,max=20"`
+		Role        string         `json:"role" form:"role" validate:"required,eq=USER|eq=SME_VENDOR|eq=CORPORATE_VENDOR"`
+		Scopes      []entity.Scope `json:"scopes" form:"scopes" validate:"scope"`
 	}
 
 	// bind req input
@@ -254,6 +260,7 @@ func (h Handler) CreateAdmin(c echo.Context) error {
 		PasswordHash: passwordHash,
 		PasswordSalt: salt,
 		Role:         entity.UserRole(i.Role),
+		Scopes:       i.Scopes,
 		Status:       entity.UserStatusActive,
 		ApprovedBy:   &approvedBy,
 		Model: entity.Model{
@@ -294,9 +301,16 @@ func (h Handler) AdminLogin(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
 
+	if httpStatus, exception := checkLogin(c, h, entity.AccountTypeAdmin, i.Email); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	// check if admin exists
 	admin, err := h.repository.FindAdminByEmail(c.Request().Context(), i.Email)
 	if err != nil {
+		if err := loginFailed(c, h, entity.AccountTypeAdmin, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
 		return c.JSON(http.StatusBadRequest, response.Exception{
 			Code:  errcode.AdminNotFound,
 			Error: err,
@@ -309,22 +323,25 @@ func (h Handler) AdminLogin(c echo.Context) error {
 	// compare password & return error if password is not same
 	salt, pepper := admin.PasswordSalt, env.Config.Jwt.Secret
 	if isSame := password.Compare(i.Password, salt, pepper, admin.PasswordHash); !isSame {
+		if err := loginFailed(c, h, entity.AccountTypeAdmin, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
 		return c.JSON(http.StatusBadRequest, response.Exception{
 			Code: errcode.AuthenticationError,
 		})
 	}
 
-	// convert to string array
-	scopes := []string{}
-	s := fmt.Sprintf("%v", admin.Role)
-	scopes = append(scopes, s)
+	// tokens are only issued after the TOTP code when two factor authentication is on
+	if twoFactorRequired(admin) {
+		return twoFactorChallenge(c, admin)
+	}
+
+	if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeAdmin, i.Email); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
 
 	// generate token pair
-	tokens, err := jwt.GenerateTokens(env.Config.Jwt.Secret, map[string]string{
-		"sub":    admin.ID.Hex(),
-		"aud":    admin.ID.Hex(),
-		"scopes": strings.Join(scopes, ","),
-	})
+	tokens, err := issueTokens(c, h, admin.ID, nil, nil, adminTokenClaims(admin))
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{
 			Code:  errcode.ServerError,
@@ -358,9 +375,16 @@ func (h Handler) VendorLogin(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
 
+	if httpStatus, exception := checkLogin(c, h, entity.AccountTypeAdmin, i.Email); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	// check if admin exists
 	admin, err := h.repository.FindAdminByEmail(c.Request().Context(), i.Email)
 	if err != nil {
+		if err := loginFailed(c, h, entity.AccountTypeAdmin, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
 		return c.JSON(http.StatusBadRequest, response.Exception{
 			Code:  errcode.AdminNotFound,
 			Error: err,
@@ -373,6 +397,9 @@ func (h Handler) VendorLogin(c echo.Context) error {
 	// compare password & return error if password is not same
 	salt, pepper := admin.PasswordSalt, env.Config.Jwt.Secret
 	if isSame := password.Compare(i.Password, salt, pepper, admin.PasswordHash); !isSame {
+		if err := loginFailed(c, h, entity.AccountTypeAdmin, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
 		return c.JSON(http.StatusBadRequest, response.Exception{
 			Code: errcode.AuthenticationError,
 		})
@@ -397,17 +424,17 @@ func (h Handler) VendorLogin(c echo.Context) error {
 		})
 	}
 
-	// convert to string array
-	scopes := []string{}
-	s := fmt.Sprintf("%v", admin.Role)
-	scopes = append(scopes, s)
+	// tokens are only issued after the TOTP code when two factor authentication is on
+	if twoFactorRequired(admin) {
+		return twoFactorChallenge(c, admin)
+	}
+
+	if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeAdmin, i.Email); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
 
 	// generate token pair
-	tokens, err := jwt.GenerateTokens(env.Config.Jwt.Secret, map[string]string{
-		"sub":    admin.ID.Hex(),
-		"aud":    admin.ID.Hex(),
-		"scopes": strings.Join(scopes, ","),
-	})
+	tokens, err := issueTokens(c, h, admin.ID, nil, nil, adminTokenClaims(admin))
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{
 			Code:  errcode.ServerError,
@@ -0,0 +1,461 @@
+package handler
+
+import (
+	"csi-api/app/constant"
+	"csi-api/app/entity"
+	"csi-api/app/kit/answer"
+	"csi-api/app/kit/benchmark"
+	"csi-api/app/kit/condition"
+	"csi-api/app/kit/random"
+	"csi-api/app/kit/scoring"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BenchmarkScore : where a score stands among its peers
+type BenchmarkScore struct {
+	Dimension      string             `json:"dimension"`
+	Score          float64            `json:"score"`
+	PercentileRank float64            `json:"percentileRank"`
+	Quartile       int                `json:"quartile"`
+	Peers          *benchmark.Summary `json:"peers"`
+	Suppressed     bool               `json:"suppressed"`
+}
+
+// Benchmark :
+type Benchmark struct {
+	AssessmentID string            `json:"assessmentID"`
+	Group        map[string]string `json:"group"`
+	PeerCount    int               `json:"peerCount"`
+	Suppressed   bool              `json:"suppressed"`
+	Overall      BenchmarkScore    `json:"overall"`
+	Dimensions   []BenchmarkScore  `json:"dimensions"`
+	Emissions    []BenchmarkScore  `json:"emissions"` // tCO2e, lower is better
+}
+
+// GetBenchmark : compare an assessment score with the latest scores of peer SMEs in the same group
+func (h Handler) GetBenchmark(c echo.Context) error {
+	assessmentID := c.QueryParam("assessmentId")
+	groupBy := c.Request().URL.Query()["groupBy"]
+	if len(groupBy) == 0 {
+		groupBy = []string{"msic"}
+	}
+	for _, g := range groupBy {
+		if !random.Contains(constant.SMEProfileFields, g) {
+			return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("invalid groupBy %s", g)})
+		}
+	}
+
+	assessment, httpStatus, exception := ValidateAssessment(h, c.Request().Context(), assessmentID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// sme users can only benchmark their own assessment
+	if httpStatus, exception := checkTenant(c, assessment.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if assessment.Score == nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.AssessmentNotSubmitted, Error: fmt.Errorf("assessment %s has not been submitted", assessmentID)})
+	}
+
+	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), assessment.SMEID.Hex())
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// find the peer group
+	group := map[string]string{}
+	filter := repository.FindSMEFilter{Status: entity.StatusActive}
+	for _, g := range groupBy {
+		switch g {
+		case "msic":
+			filter.MSIC = sme.MSIC
+			group[g] = sme.MSIC
+		case "state":
+			filter.State = sme.State
+			group[g] = sme.State
+		case "businessEntity":
+			filter.BusinessEntity = sme.BusinessEntity
+			group[g] = string(sme.BusinessEntity)
+		case "registeredInEastMY":
+			filter.RegisteredInEastMY = &sme.RegisteredInEastMY
+			group[g] = fmt.Sprintf("%t", sme.RegisteredInEastMY)
+		}
+	}
+
+	peers, err := findAllSMEs(c.Request().Context(), h, filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	peerIDs := make([]string, 0)
+	for _, peer := range peers {
+		if peer.ID.Hex() != sme.ID.Hex() {
+			peerIDs = append(peerIDs, peer.ID.Hex())
+		}
+	}
+
+	// only the latest scored assessment of each peer is counted
+	latest := map[string]*entity.Assessment{}
+	if len(peerIDs) > 0 {
+		assessments, err := findAllAssessments(c.Request().Context(), h, repository.FindAssessmentFilter{
+			SMEIDs: peerIDs,
+			Scored: true,
+			Status: entity.StatusActive,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		for _, a := range assessments {
+			if l, ok := latest[a.SMEID.Hex()]; !ok || a.CompletionDate.After(l.CompletionDate) {
+				latest[a.SMEID.Hex()] = a
+			}
+		}
+	}
+
+	result := Benchmark{
+		AssessmentID: assessment.ID.Hex(),
+		Group:        group,
+		PeerCount:    len(latest),
+		Suppressed:   len(latest) < constant.BenchmarkMinPeers,
+		Dimensions:   []BenchmarkScore{},
+		Emissions:    []BenchmarkScore{},
+	}
+
+	// collect peer scores per dimension
+	overallScores := make([]float64, 0, len(latest))
+	dimensionScores := map[string][]float64{}
+	for _, a := range latest {
+		overallScores = append(overallScores, a.Score.Overall)
+		for _, d := range a.Score.Dimensions {
+			dimensionScores[d.Dimension] = append(dimensionScores[d.Dimension], d.Score)
+		}
+	}
+
+	result.Overall = benchmarkScore("OVERALL", assessment.Score.Overall, overallScores, result.Suppressed)
+	for _, d := range assessment.Score.Dimensions {
+		result.Dimensions = append(result.Dimensions, benchmarkScore(d.Dimension, d.Score, dimensionScores[d.Dimension], result.Suppressed))
+	}
+	sort.Slice(result.Dimensions, func(i, j int) bool {
+		return result.Dimensions[i].Dimension < result.Dimensions[j].Dimension
+	})
+
+	// compare the latest emissions with the latest emissions of the same peers
+	own, err := latestEmission(c.Request().Context(), h, sme.ID.Hex(), time.Now().UTC())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if own != nil {
+		latestEmissions := map[string]*entity.EmissionInventory{}
+		if len(peerIDs) > 0 {
+			inventories, err := findAllEmissionInventories(c.Request().Context(), h, repository.FindEmissionInventoryFilter{
+				SMEIDs: peerIDs,
+				Status: entity.StatusActive,
+			})
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+			for _, inventory := range inventories {
+				if l, ok := latestEmissions[inventory.SMEID.Hex()]; !ok || inventory.PeriodEnd.After(l.PeriodEnd) {
+					latestEmissions[inventory.SMEID.Hex()] = inventory
+				}
+			}
+		}
+
+		peerEmissions := map[entity.EmissionScope][]float64{}
+		var peerTotals []float64
+		for _, inventory := range latestEmissions {
+			peerEmissions[entity.EmissionScope1] = append(peerEmissions[entity.EmissionScope1], inventory.Result.Scope1)
+			peerEmissions[entity.EmissionScope2] = append(peerEmissions[entity.EmissionScope2], inventory.Result.Scope2)
+			peerEmissions[entity.EmissionScope3] = append(peerEmissions[entity.EmissionScope3], inventory.Result.Scope3)
+			peerTotals = append(peerTotals, inventory.Result.Total)
+		}
+
+		result.Emissions = append(result.Emissions,
+			benchmarkScore(string(entity.EmissionScope1), own.Result.Scope1, peerEmissions[entity.EmissionScope1], false),
+			benchmarkScore(string(entity.EmissionScope2), own.Result.Scope2, peerEmissions[entity.EmissionScope2], false),
+			benchmarkScore(string(entity.EmissionScope3), own.Result.Scope3, peerEmissions[entity.EmissionScope3], false),
+			benchmarkScore("TOTAL", own.Result.Total, peerTotals, false),
+		)
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: result})
+}
+
+// benchmarkScore : position of a score among peer scores, peer figures are hidden when the group is too small
+func benchmarkScore(dimension string, score float64, peerScores []float64, suppressed bool) BenchmarkScore {
+	result := BenchmarkScore{
+		Dimension: dimension,
+		Score:     score,
+	}
+	if suppressed || len(peerScores) < constant.BenchmarkMinPeers {
+		result.Suppressed = true
+		return result
+	}
+
+	result.Peers = benchmark.Summarize(peerScores)
+	result.PercentileRank = benchmark.PercentileRank(peerScores, score)
+	result.Quartile = benchmark.Quartile(result.Peers, score)
+	return result
+}
+
+// TrendDirection :
+type TrendDirection string
+
+var (
+	TrendImproved  TrendDirection = "IMPROVED"
+	TrendRegressed TrendDirection = "REGRESSED"
+	TrendUnchanged TrendDirection = "UNCHANGED"
+	TrendChanged   TrendDirection = "CHANGED" // answer changed but carries no score
+)
+
+// TrendPeriod : score of the assessment representing a reporting period
+type TrendPeriod struct {
+	AssessmentID string                  `json:"assessmentID"`
+	PeriodStart  time.Time               `json:"periodStart"`
+	PeriodEnd    time.Time               `json:"periodEnd"`
+	Score        *entity.AssessmentScore `json:"score"`
+}
+
+// ScoreChange :
+type ScoreChange struct {
+	Dimension string         `json:"dimension"`
+	From      float64        `json:"from"`
+	To        float64        `json:"to"`
+	Change    float64        `json:"change"`
+	Direction TrendDirection `json:"direction"`
+}
+
+// AnswerChange :
+type AnswerChange struct {
+	OriginID      string         `json:"originID"`
+	Dimension     string         `json:"dimension"`
+	QuestionLabel string         `json:"questionLabel"`
+	From          []string       `json:"from"`
+	To            []string       `json:"to"`
+	Direction     TrendDirection `json:"direction"`
+}
+
+// TrendStep : changes from one period to the next
+type TrendStep struct {
+	FromAssessmentID string         `json:"fromAssessmentID"`
+	ToAssessmentID   string         `json:"toAssessmentID"`
+	Scores           []ScoreChange  `json:"scores"`
+	Answers          []AnswerChange `json:"answers"`
+}
+
+// Trend :
+type Trend struct {
+	SMEID   string        `json:"smeID"`
+	Periods []TrendPeriod `json:"periods"`
+	Steps   []TrendStep   `json:"steps"`
+}
+
+// GetTrend : scores and answer changes of an SME across reporting periods, corporates only see
+// the assessments shared with them
+func (h Handler) GetTrend(c echo.Context) error {
+	smeID := c.QueryParam("smeId")
+
+	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), smeID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	if httpStatus, exception := checkTenant(c, sme.ID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	assessments, err := findAllAssessments(c.Request().Context(), h, repository.FindAssessmentFilter{
+		SMEID:  sme.ID.Hex(),
+		Scored: true,
+		Status: entity.StatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	// corporates see the scores shared with them, and answer changes where the answers are shared too
+	hiddenAnswers := map[string]bool{}
+	if corporateID := corporateTenantID(c); corporateID != nil {
+		shared := make([]*entity.Assessment, 0)
+		timeNow := time.Now().UTC()
+		for _, a := range assessments {
+			share := activeShare(a, corporateID.Hex(), timeNow)
+			if share == nil || !random.Contains(share.Scopes, entity.ShareScopeScore) {
+				continue
+			}
+			shared = append(shared, a)
+			if !random.Contains(share.Scopes, entity.ShareScopeAnswers) {
+				hiddenAnswers[a.ID.Hex()] = true
+			}
+		}
+		if len(shared) == 0 {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.AssessmentNotShared, Error: fmt.Errorf("no assessment of sme %s is shared", smeID)})
+		}
+		assessments = shared
+	}
+
+	// one assessment per period, the latest completed one wins
+	byPeriod := map[string]*entity.Assessment{}
+	for _, a := range assessments {
+		start, end := assessmentPeriod(a)
+		key := start.Format(time.RFC3339) + end.Format(time.RFC3339)
+		if l, ok := byPeriod[key]; !ok || a.CompletionDate.After(l.CompletionDate) {
+			byPeriod[key] = a
+		}
+	}
+	periods := make([]*entity.Assessment, 0, len(byPeriod))
+	for _, a := range byPeriod {
+		periods = append(periods, a)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		_, a := assessmentPeriod(periods[i])
+		_, b := assessmentPeriod(periods[j])
+		return a.Before(b)
+	})
+
+	result := Trend{
+		SMEID:   sme.ID.Hex(),
+		Periods: []TrendPeriod{},
+		Steps:   []TrendStep{},
+	}
+
+	var previous []*entity.AssessmentEntry
+	for n, a := range periods {
+		start, end := assessmentPeriod(a)
+		result.Periods = append(result.Periods, TrendPeriod{
+			AssessmentID: a.ID.Hex(),
+			PeriodStart:  start,
+			PeriodEnd:    end,
+			Score:        a.Score,
+		})
+
+		entries, err := findAllAssessmentEntries(c.Request().Context(), h, repository.FindAssessmentEntryFilter{
+			AssessmentID: a.ID.Hex(),
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		if n > 0 {
+			step := TrendStep{
+				FromAssessmentID: periods[n-1].ID.Hex(),
+				ToAssessmentID:   a.ID.Hex(),
+				Scores:           scoreChanges(periods[n-1].Score, a.Score),
+				Answers:          answerChanges(previous, entries),
+			}
+			if hiddenAnswers[periods[n-1].ID.Hex()] || hiddenAnswers[a.ID.Hex()] {
+				step.Answers = []AnswerChange{}
+			}
+			result.Steps = append(result.Steps, step)
+		}
+		previous = entries
+	}
+
+	if corporateTenantID(c) != nil {
+		for _, a := range periods {
+			scopes := []entity.ShareScope{entity.ShareScopeScore}
+			if !hiddenAnswers[a.ID.Hex()] && len(periods) > 1 {
+				scopes = append(scopes, entity.ShareScopeAnswers)
+			}
+			if err := logShareAccess(c, h, a, scopes, nil); err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: result})
+}
+
+// scoreChanges : overall and per dimension score change between two assessments
+func scoreChanges(from, to *entity.AssessmentScore) []ScoreChange {
+	changes := []ScoreChange{scoreChange("OVERALL", from.Overall, to.Overall)}
+
+	fromDimensions := map[string]float64{}
+	for _, d := range from.Dimensions {
+		fromDimensions[d.Dimension] = d.Score
+	}
+	for _, d := range to.Dimensions {
+		if score, ok := fromDimensions[d.Dimension]; ok {
+			changes = append(changes, scoreChange(d.Dimension, score, d.Score))
+		}
+	}
+	return changes
+}
+
+func scoreChange(dimension string, from, to float64) ScoreChange {
+	return ScoreChange{
+		Dimension: dimension,
+		From:      from,
+		To:        to,
+		Change:    math.Round((to-from)*100) / 100,
+		Direction: direction(from, to),
+	}
+}
+
+// answerChanges : answers of the same question which changed between two assessments
+func answerChanges(from, to []*entity.AssessmentEntry) []AnswerChange {
+	fromEntries := map[string]*entity.AssessmentEntry{}
+	for _, e := range from {
+		fromEntries[condition.EntryOrigin(e)] = e
+	}
+
+	changes := []AnswerChange{}
+	for _, e := range to {
+		previous, ok := fromEntries[condition.EntryOrigin(e)]
+		if !ok {
+			continue
+		}
+
+		fromValues, toValues := entryValues(previous), entryValues(e)
+		if strings.Join(fromValues, "\x00") == strings.Join(toValues, "\x00") {
+			continue
+		}
+
+		change := AnswerChange{
+			OriginID:  condition.EntryOrigin(e),
+			From:      fromValues,
+			To:        toValues,
+			Direction: TrendChanged,
+		}
+		if e.Question != nil {
+			change.Dimension = e.Question.Dimension
+			change.QuestionLabel = e.Question.QuestionLabel
+		}
+		fromScore, fromScored := scoring.AnswerScore(previous)
+		toScore, toScored := scoring.AnswerScore(e)
+		if fromScored && toScored && !previous.Skipped && !e.Skipped {
+			change.Direction = direction(fromScore, toScore)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// entryValues : answer of an entry as text, skipped entries have no answer
+func entryValues(entry *entity.AssessmentEntry) []string {
+	if entry.Skipped || entry.RespondStatus == entity.ResponseStatusToStart {
+		return []string{}
+	}
+	return answer.Values(entry.QuestionType, entry.Answer)
+}
+
+func direction(from, to float64) TrendDirection {
+	switch {
+	case to > from:
+		return TrendImproved
+	case to < from:
+		return TrendRegressed
+	}
+	return TrendUnchanged
+}
@@ -19,11 +19,31 @@ import (
 
 // GetAssessments :
 func (h Handler) GetAssessments(c echo.Context) error {
+	smeID := c.QueryParam("smeId")
+	sharedWiths := c.Request().URL.Query()["sharedWith"]
+
+	// sme users see their own assessments, or the ones shared with their company
+	var httpStatus int
+	var exception *response.Exception
+	if len(sharedWiths) > 0 {
+		sharedWiths, httpStatus, exception = tenantFilterIDs(c, sharedWiths)
+	} else {
+		smeID, httpStatus, exception = tenantFilter(c, smeID)
+	}
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// corporate users go through the shared assessment endpoints, which enforce the shares
+	if corporateTenantID(c) != nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("corporate users fetch assessments through /sharedAssessments")})
+	}
+
 	assessments, cursor, err := h.repository.FindAssessments(c.Request().Context(), repository.FindAssessmentFilter{
 		Cursor:      c.QueryParam("cursor"),
 		IDs:         c.Request().URL.Query()["id"],
-		SMEID:       c.QueryParam("smeId"),
-		SharedWiths: c.Request().URL.Query()["sharedWith"],
+		SMEID:       smeID,
+		SharedWiths: sharedWiths,
 		Status:      entity.Status(c.QueryParam("status")),
 	})
 	if err != nil {
@@ -57,17 +77,14 @@ func (h Handler) DeleteAssessment(c echo.Context) error {
 	return c.JSON(http.StatusOK, nil)
 }
 
-// UpdateAssessment :
+// UpdateAssessment : admins only, the report and the period are what corporates see through shares
 func (h Handler) UpdateAssessment(c echo.Context) error {
 	assessmentId := c.QueryParam("id")
 	var i struct {
-		SerialNo    string `json:"serialNo" form:"serialNo"`
-		SharedWiths []struct {
-			CorporateID string        `json:"corporateID" form:"corporateID" validate:"max=50"`
-			LinkDate    time.Time     `json:"linkDate" form:"linkDate"`
-			Status      entity.Status `json:"status" form:"status" validate:"eq=INVITED|eq=ACTIVE"`
-		} `json:"sharedWiths" form:"sharedWiths" validate:"dive,max=50"`
+		SerialNo       string        `json:"serialNo" form:"serialNo"`
 		CompletionDate time.Time     `json:"completionDate" form:"completionDate"`
+		PeriodStart    time.Time     `json:"periodStart" form:"periodStart"`
+		PeriodEnd      time.Time     `json:"periodEnd" form:"periodEnd"`
 		Status         entity.Status `json:"status" form:"status"`
 	}
 
@@ -99,29 +116,17 @@ func (h Handler) UpdateAssessment(c echo.Context) error {
 		assessment.CompletionDate = i.CompletionDate
 	}
 
-	sharedWiths := []entity.LinkCorporate{}
-	if len(i.SharedWiths) > 0 {
-		for _, sharedWith := range i.SharedWiths {
-			_, httpStatus, exception := ValidateSME(h, c.Request().Context(), sharedWith.CorporateID)
-			if exception != nil {
-				return c.JSON(httpStatus, exception)
-			}
+	if !i.PeriodStart.IsZero() {
+		assessment.PeriodStart = i.PeriodStart.UTC()
+	}
 
-			corporateID, err := primitive.ObjectIDFromHex(sharedWith.CorporateID)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, response.Exception{
-					Code:  errcode.ServerError,
-					Error: err,
-				})
-			}
-			sharedWiths = append(sharedWiths, entity.LinkCorporate{
-				CorporateID: &corporateID,
-				LinkDate:    sharedWith.LinkDate,
-				Status:      sharedWith.Status,
-			})
-		}
+	if !i.PeriodEnd.IsZero() {
+		assessment.PeriodEnd = i.PeriodEnd.UTC()
+	}
+
+	if !assessment.PeriodStart.IsZero() && !assessment.PeriodEnd.After(assessment.PeriodStart) {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("periodEnd must be after periodStart")})
 	}
-	assessment.SharedWiths = sharedWiths
 
 	// check if report document is uploaded
 	if report, _ := c.FormFile("report"); report != nil {
@@ -181,6 +186,9 @@ func (h Handler) CreateAssessment(c echo.Context) error {
 		SMEID         string `json:"smeID" form:"smeID" validate:"required,max=50"`
 		QuestionSetID string `json:"questionSetID" form:"questionSetID" validate:"required,max=50"`
 		SerialNo      string `json:"serialNo" form:"serialNo" validate:""`
+		// reporting period, defaults to the current calendar year
+		PeriodStart time.Time `json:"periodStart" form:"periodStart"`
+		PeriodEnd   time.Time `json:"periodEnd" form:"periodEnd"`
 	}
 
 	// bind req input
@@ -193,11 +201,25 @@ func (h Handler) CreateAssessment(c echo.Context) error {
 	i.SerialNo = strings.TrimSpace(i.SerialNo)
 	i.QuestionSetID = strings.TrimSpace(i.QuestionSetID)
 
+	// sme users assess their own company
+	companyID, httpStatus, exception := tenantFilter(c, i.SMEID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	i.SMEID = companyID
+
 	// validate
 	if err := c.Validate(&i); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
 
+	if i.PeriodStart.IsZero() && i.PeriodEnd.IsZero() {
+		i.PeriodStart, i.PeriodEnd = calendarYear(time.Now().UTC().Year())
+	}
+	if !i.PeriodEnd.After(i.PeriodStart) {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("periodEnd must be after periodStart")})
+	}
+
 	// check if sme exists
 	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), i.SMEID)
 	if exception != nil {
@@ -210,32 +232,44 @@ func (h Handler) CreateAssessment(c echo.Context) error {
 		return c.JSON(httpStatus, exception)
 	}
 
-	// create time object
-	timeNow := time.Now().UTC()
-
-	// create assessment object
-	assessmentID := primitive.NewObjectID()
-	smeID, err := primitive.ObjectIDFromHex(i.SMEID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+	// only published revisions can be assessed
+	if questionSetState(questionSet) != entity.QuestionSetStatePublished {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.QuestionSetNotPublished, Error: fmt.Errorf("questionSet %s is not published", i.QuestionSetID)})
 	}
 
-	questionSetID, err := primitive.ObjectIDFromHex(i.QuestionSetID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+	assessment, httpStatus, exception := createAssessment(c.Request().Context(), h, sme, questionSet, AssessmentInput{
+		SerialNo:    i.SerialNo,
+		PeriodStart: i.PeriodStart,
+		PeriodEnd:   i.PeriodEnd,
+	})
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
 	}
+	return c.JSON(http.StatusOK, response.Item{Item: assessment.ID})
+}
+
+// AssessmentInput : optional details of an assessment created for an sme
+type AssessmentInput struct {
+	SerialNo    string
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	CampaignID  *primitive.ObjectID
+}
 
+// createAssessment : create an assessment of the published question set for the sme together with its entries
+func createAssessment(ctx context.Context, h Handler, sme *entity.SME, questionSet *entity.QuestionSet, i AssessmentInput) (*entity.Assessment, int, *response.Exception) {
+	timeNow := time.Now().UTC()
+
+	assessmentID := primitive.NewObjectID()
 	assessment := entity.Assessment{
 		ID:             &assessmentID,
-		SMEID:          &smeID,
-		QuestionSetID:  &questionSetID,
+		SMEID:          sme.ID,
+		QuestionSetID:  questionSet.ID,
+		Revision:       questionSet.Revision,
+		CampaignID:     i.CampaignID,
 		SerialNo:       i.SerialNo,
+		PeriodStart:    i.PeriodStart.UTC(),
+		PeriodEnd:      i.PeriodEnd.UTC(),
 		CompletionDate: time.Time{},
 		Status:         entity.StatusActive,
 		Model: entity.Model{
@@ -244,31 +278,24 @@ func (h Handler) CreateAssessment(c echo.Context) error {
 		},
 	}
 
-	if _, err = h.repository.CreateAssessment(c.Request().Context(), assessment); err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+	if _, err := h.repository.CreateAssessment(ctx, assessment); err != nil {
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
 	}
 
-	assessmentEntries, httpStatus, exception := generateAssessmentEntries(c.Request().Context(), h, AssessmentEntryInput{
+	assessmentEntries, httpStatus, exception := generateAssessmentEntries(ctx, h, AssessmentEntryInput{
 		AssessmentID:  assessment.ID,
 		QuestionSetID: questionSet.ID,
 		SMEID:         sme.ID,
 	})
 	if exception != nil {
-		return c.JSON(httpStatus, exception)
+		return nil, httpStatus, exception
 	}
 
 	// bulk insert entries
-	_, err = h.repository.BulkInsertAssessmentEntries(c.Request().Context(), assessmentEntries)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+	if _, err := h.repository.BulkInsertAssessmentEntries(ctx, assessmentEntries); err != nil {
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
 	}
-	return c.JSON(http.StatusOK, response.Item{Item: assessment.ID})
+	return &assessment, http.StatusOK, nil
 }
 
 // ValidateAssessment :
@@ -287,3 +314,40 @@ func ValidateAssessment(h Handler, ctx context.Context, ID string) (*entity.Asse
 	}
 	return assessment, http.StatusOK, nil
 }
+
+// findAllAssessments : walk through every page of assessments matching the filter
+func findAllAssessments(c context.Context, h Handler, filter repository.FindAssessmentFilter) ([]*entity.Assessment, error) {
+	var assessments []*entity.Assessment
+	for {
+		result, nextCursor, err := h.repository.FindAssessments(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		assessments = append(assessments, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return assessments, nil
+}
+
+// calendarYear : first and last moment of a year
+func calendarYear(year int) (time.Time, time.Time) {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(1, 0, 0).Add(-time.Nanosecond)
+}
+
+// assessmentPeriod : reporting period of an assessment, assessments made before periods were recorded
+// cover the calendar year they were completed in
+func assessmentPeriod(assessment *entity.Assessment) (time.Time, time.Time) {
+	if !assessment.PeriodStart.IsZero() {
+		return assessment.PeriodStart, assessment.PeriodEnd
+	}
+	date := assessment.CompletionDate
+	if date.IsZero() {
+		date = assessment.CreatedAt
+	}
+	return calendarYear(date.Year())
+}
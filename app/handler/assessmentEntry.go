@@ -3,11 +3,17 @@ package handler
 import (
 	"context"
 	"csi-api/app/entity"
+	"csi-api/app/kit/answer"
+	"csi-api/app/kit/condition"
+	"csi-api/app/kit/general"
+	"csi-api/app/kit/report"
+	"csi-api/app/kit/scoring"
 	"csi-api/app/repository"
 	"csi-api/app/response"
 	"csi-api/app/response/errcode"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -24,12 +30,18 @@ type AssessmentEntryInput struct {
 
 // GetAssessmentEntries :
 func (h Handler) GetAssessmentEntries(c echo.Context) error {
+	smeID, httpStatus, exception := tenantFilter(c, c.QueryParam("smeId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	assessmentEntries, cursor, err := h.repository.FindAssessmentEntries(c.Request().Context(), repository.FindAssessmentEntryFilter{
 		Cursor:        c.QueryParam("cursor"),
 		IDs:           c.Request().URL.Query()["id"],
 		QuestionType:  c.QueryParam("questionType"),
 		QuestionSetID: c.QueryParam("questionSetId"),
 		AssessmentID:  c.QueryParam("assessmentId"),
+		SMEID:         smeID,
 		RespondStatus: entity.RespondStatus(c.QueryParam("respondStatus")),
 	})
 	if err != nil {
@@ -42,7 +54,7 @@ func (h Handler) GetAssessmentEntries(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.Items{Items: assessmentEntries, Cursor: cursor, Count: len(assessmentEntries)})
 }
 
-// SubmitAssessment : switch question status to SUBMITTED
+// SubmitAssessment : send the answered entries to review, the assessment is finalized once every entry is accepted
 func (h Handler) SubmitAssessment(c echo.Context) error {
 	smeUserData := c.Get("SME_ADMIN")
 	smeUser := smeUserData.(entity.SMEUser)
@@ -59,6 +71,40 @@ func (h Handler) SubmitAssessment(c echo.Context) error {
 		return c.JSON(httpStatus, exception)
 	}
 
+	if httpStatus, exception := checkTenant(c, assessment.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if assessment.ReviewStatus == entity.ReviewStatusFinalized {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.AssessmentFinalized, Error: fmt.Errorf("assessment %s is finalized", assessmentID)})
+	}
+
+	// every applicable entry must be answered before submission
+	entries, err := findAllAssessmentEntries(c.Request().Context(), h, repository.FindAssessmentEntryFilter{
+		AssessmentID: assessmentID,
+		SMEID:        smeUser.CompanyID.Hex(),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	unanswered := make([]string, 0)
+	toReview := 0
+	for _, entry := range entries {
+		if entry.Skipped {
+			continue
+		}
+		// returned entries must be answered again
+		if entry.RespondStatus == entity.ResponseStatusToStart || entry.RespondStatus == entity.ResponseStatusReturned {
+			unanswered = append(unanswered, entry.ID.Hex())
+		}
+		if entry.RespondStatus != entity.ResponseStatusAccepted {
+			toReview++
+		}
+	}
+	if len(unanswered) > 0 {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.AssessmentIncomplete, Error: fmt.Errorf("assessment entries %s are not answered", strings.Join(unanswered, ","))})
+	}
+
 	if _, err := h.repository.SubmitAssessment(c.Request().Context(), repository.SubmitAssessmentFilter{
 		AssessmentID: assessmentOID.Hex(),
 		SMEIDs:       []string{smeUser.CompanyID.Hex()},
@@ -66,9 +112,30 @@ func (h Handler) SubmitAssessment(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
-	// update assessment completion date
-	assessment.CompletionDate = time.Now().UTC()
-	assessment.Model.UpdatedAt = time.Now().UTC()
+	timeNow := time.Now().UTC()
+	role := fmt.Sprintf("%v", c.Get("role"))
+	assessment.History = append(assessment.History, entity.ReviewStep{
+		Action: entity.ReviewActionSubmitted,
+		By:     smeUser.ID,
+		Role:   role,
+		At:     timeNow,
+	})
+
+	// nothing is left for a reviewer, e.g. every entry is skipped by its conditions
+	if toReview == 0 {
+		if httpStatus, exception := finalizeAssessment(c.Request().Context(), h, assessment, entity.ReviewStep{
+			Action: entity.ReviewActionFinalized,
+			By:     smeUser.ID,
+			Role:   role,
+			At:     timeNow,
+		}); exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+		return c.JSON(http.StatusOK, nil)
+	}
+
+	assessment.ReviewStatus = entity.ReviewStatusInReview
+	assessment.Model.UpdatedAt = timeNow
 
 	if _, err := h.repository.UpsertAssessment(assessment); err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
@@ -79,9 +146,6 @@ func (h Handler) SubmitAssessment(c echo.Context) error {
 
 // SubmitResponse :
 func (h Handler) SubmitResponse(c echo.Context) error {
-	smeUserData := c.Get("SME_ADMIN")
-	smeUser := smeUserData.(entity.SMEUser)
-
 	var i struct {
 		Responses []struct {
 			AssessmentEntryID *primitive.ObjectID `json:"assessmentEntryID" form:"assessmentEntryID" validate:"required,max=50"`
@@ -101,6 +165,7 @@ func (h Handler) SubmitResponse(c echo.Context) error {
 
 	timeNow := time.Now()
 	entries := make([]*entity.AssessmentEntry, 0)
+	answerErrors := make(map[string]string)
 	for _, res := range i.Responses {
 		entry, err := h.repository.FindAssessmentEntryByID(c.Request().Context(), res.AssessmentEntryID.Hex())
 		if err != nil {
@@ -109,11 +174,20 @@ func (h Handler) SubmitResponse(c echo.Context) error {
 			}
 			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 		}
-		if entry.SMEID.Hex() != smeUser.CompanyID.Hex() {
-			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.MismatchSME, Error: fmt.Errorf("mismatch sme id")})
+		if httpStatus, exception := checkTenant(c, entry.SMEID); exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+
+		// answer must fit the question type and options
+		if entry.Question != nil {
+			if err := answer.Validate(entry.Question, res.Answer); err != nil {
+				answerErrors[entry.ID.Hex()] = err.Error()
+				continue
+			}
 		}
 
-		if entry.RespondStatus != entity.ResponseStatusToSubmitted {
+		// entries are locked while in review or once accepted, returned entries reopen
+		if entryEditable(entry) {
 			entry.Answer = res.Answer
 			entry.RespondStatus = entity.ResponseStatusInProgress
 			entry.SubmittedDateTime = timeNow
@@ -121,6 +195,20 @@ func (h Handler) SubmitResponse(c echo.Context) error {
 		}
 	}
 
+	if len(answerErrors) > 0 {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{
+			Code:    errcode.InvalidAnswer,
+			Error:   fmt.Errorf("%d answers are invalid", len(answerErrors)),
+			Details: answerErrors,
+		})
+	}
+
+	// answers may change which entries apply
+	entries, httpStatus, exception := resolveSkippedEntries(c.Request().Context(), h, entries)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	var updateResult interface{}
 	var err error
 	if len(entries) != 0 {
@@ -182,28 +270,22 @@ func generateAssessmentEntries(c context.Context, h Handler, i AssessmentEntryIn
 	}
 
 	// get all questions in question set
-	cursor := ""
-	var assessmentQuestions []*entity.Question
-	for {
-		questions, nextCursor, err := h.repository.FindQuestions(c, repository.FindQuestionFilter{
-			Cursor:        cursor,
-			QuestionSetID: questionSet.ID.Hex(),
-			Status:        entity.StatusActive,
-		})
-		if err != nil {
-			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
-		}
-		assessmentQuestions = append(assessmentQuestions, questions...)
-		if nextCursor == "0" {
-			break
-		} else {
-			cursor = nextCursor
-		}
+	assessmentQuestions, err := findAllQuestions(c, h, repository.FindQuestionFilter{
+		QuestionSetID: questionSet.ID.Hex(),
+		Status:        entity.StatusActive,
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
 	}
 
 	// make assessment entry
 	var entires []*entity.AssessmentEntry
 	for _, question := range assessmentQuestions {
+		// skip questions which do not apply to the SME profile
+		if !condition.ProfileApplicable(question, sme) {
+			continue
+		}
+
 		oid := primitive.NewObjectID()
 		entry := &entity.AssessmentEntry{
 			ID:                &oid,
@@ -220,5 +302,305 @@ func generateAssessmentEntries(c context.Context, h Handler, i AssessmentEntryIn
 		entires = append(entires, entry)
 	}
 
+	// questions depending on answers stay hidden until they are answered
+	skipped := condition.Resolve(entires, sme)
+	for _, entry := range entires {
+		entry.Skipped = skipped[entry.ID.Hex()]
+	}
+
 	return entires, http.StatusOK, nil
 }
+
+// resolveSkippedEntries : re-evaluate the display conditions of every entry in the assessments of the
+// updated entries, return the updated entries together with entries whose skipped flag changed
+func resolveSkippedEntries(c context.Context, h Handler, updated []*entity.AssessmentEntry) ([]*entity.AssessmentEntry, int, *response.Exception) {
+	changes := make(map[string]*entity.AssessmentEntry)
+	assessments := make(map[string]*entity.AssessmentEntry)
+	for _, entry := range updated {
+		changes[entry.ID.Hex()] = entry
+		assessments[entry.AssessmentID.Hex()] = entry
+	}
+
+	for assessmentID, entry := range assessments {
+		sme, err := h.repository.FindSMEByID(c, entry.SMEID.Hex())
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("SME %s not found", entry.SMEID.Hex())}
+			}
+			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		}
+
+		entries, err := findAllAssessmentEntries(c, h, repository.FindAssessmentEntryFilter{
+			AssessmentID: assessmentID,
+		})
+		if err != nil {
+			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		}
+
+		// use the new answers
+		for n, e := range entries {
+			if change, ok := changes[e.ID.Hex()]; ok {
+				entries[n] = change
+			}
+		}
+
+		skipped := condition.Resolve(entries, sme)
+		for _, e := range entries {
+			if e.Skipped != skipped[e.ID.Hex()] {
+				e.Skipped = skipped[e.ID.Hex()]
+				changes[e.ID.Hex()] = e
+			}
+		}
+	}
+
+	result := make([]*entity.AssessmentEntry, 0, len(changes))
+	for _, entry := range changes {
+		result = append(result, entry)
+	}
+	return result, http.StatusOK, nil
+}
+
+// findAllAssessmentEntries : walk through every page of assessment entries matching the filter
+func findAllAssessmentEntries(c context.Context, h Handler, filter repository.FindAssessmentEntryFilter) ([]*entity.AssessmentEntry, error) {
+	var entries []*entity.AssessmentEntry
+	for {
+		result, nextCursor, err := h.repository.FindAssessmentEntries(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return entries, nil
+}
+
+// scoreAssessment : compute the ESG score of an assessment using the weights of its question set
+func scoreAssessment(c context.Context, h Handler, assessment *entity.Assessment) (*entity.AssessmentScore, int, *response.Exception) {
+	questionSet, err := h.repository.FindQuestionSetByID(c, assessment.QuestionSetID.Hex())
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("questionSet %s not found", assessment.QuestionSetID.Hex())}
+		}
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	entries, err := findAllAssessmentEntries(c, h, repository.FindAssessmentEntryFilter{
+		AssessmentID: assessment.ID.Hex(),
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	return scoring.Compute(entries, questionSet.Weights), http.StatusOK, nil
+}
+
+// generateAssessmentReport : render the assessment report PDF into the SME report folder and return its path
+func generateAssessmentReport(c context.Context, h Handler, assessment *entity.Assessment) (string, int, *response.Exception) {
+	sme, err := h.repository.FindSMEByID(c, assessment.SMEID.Hex())
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("SME %s not found", assessment.SMEID.Hex())}
+		}
+		return "", http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	entries, err := findAllAssessmentEntries(c, h, repository.FindAssessmentEntryFilter{
+		AssessmentID: assessment.ID.Hex(),
+	})
+	if err != nil {
+		return "", http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	// emissions of the period assessed
+	_, periodEnd := assessmentPeriod(assessment)
+	inventory, err := latestEmission(c, h, sme.ID.Hex(), periodEnd)
+	if err != nil {
+		return "", http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	content, err := report.Generate(report.Data{
+		SME:        sme,
+		Assessment: assessment,
+		Entries:    entries,
+		Emission:   inventory,
+	})
+	if err != nil {
+		return "", http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	// create path
+	path := fmt.Sprintf("esg/%s/report/", strings.TrimSpace(assessment.SMEID.Hex()))
+	filename := fmt.Sprintf("%s.pdf", assessment.ID.Hex())
+
+	if err := general.SaveFile(content, path, filename); err != nil {
+		return "", http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+	return path + filename, http.StatusOK, nil
+}
+
+// ReviewAssessmentEntries : accept or return submitted entries, returned entries reopen for the SME and the
+// assessment is finalized once every applicable entry is accepted
+func (h Handler) ReviewAssessmentEntries(c echo.Context) error {
+	reviewer := c.Get("ADMIN").(entity.Admin)
+	role := fmt.Sprintf("%v", c.Get("role"))
+
+	var i struct {
+		Reviews []struct {
+			AssessmentEntryID *primitive.ObjectID  `json:"assessmentEntryID" form:"assessmentEntryID" validate:"required"`
+			Decision          entity.RespondStatus `json:"decision" form:"decision" validate:"required,eq=ACCEPTED|eq=RETURNED"`
+			Comment           string               `json:"comment" form:"comment"`
+		} `json:"reviews" form:"reviews" validate:"gt=0,dive,required"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	entries := make([]*entity.AssessmentEntry, 0)
+	assessmentIDs := make(map[string]bool)
+	for _, review := range i.Reviews {
+		review.Comment = strings.TrimSpace(review.Comment)
+		if review.Decision == entity.ResponseStatusReturned && review.Comment == "" {
+			return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("comment is required to return assessment entry %s", review.AssessmentEntryID.Hex())})
+		}
+
+		entry, err := h.repository.FindAssessmentEntryByID(c.Request().Context(), review.AssessmentEntryID.Hex())
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("assessment entry %s not found", review.AssessmentEntryID.Hex())})
+			}
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		if entry.RespondStatus != entity.ResponseStatusToReview {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EntryNotInReview, Error: fmt.Errorf("assessment entry %s is not in review", entry.ID.Hex())})
+		}
+
+		action := entity.ReviewActionAccepted
+		if review.Decision == entity.ResponseStatusReturned {
+			action = entity.ReviewActionReturned
+		}
+		entry.RespondStatus = review.Decision
+		entry.Comment = review.Comment
+		entry.History = append(entry.History, entity.ReviewStep{
+			Action:  action,
+			Comment: review.Comment,
+			By:      reviewer.ID,
+			Role:    role,
+			At:      timeNow,
+		})
+		entry.Model.UpdatedAt = timeNow
+		entries = append(entries, entry)
+		assessmentIDs[entry.AssessmentID.Hex()] = true
+	}
+
+	if _, err := h.repository.BulkWriteAssessmentEntries(c.Request().Context(), entries); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	// move each assessment on once its entries are reviewed
+	assessments := make([]*entity.Assessment, 0, len(assessmentIDs))
+	for assessmentID := range assessmentIDs {
+		assessment, httpStatus, exception := ValidateAssessment(h, c.Request().Context(), assessmentID)
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+
+		assessmentEntries, err := findAllAssessmentEntries(c.Request().Context(), h, repository.FindAssessmentEntryFilter{
+			AssessmentID: assessmentID,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		returned, accepted := false, true
+		for _, entry := range assessmentEntries {
+			if entry.Skipped {
+				continue
+			}
+			switch entry.RespondStatus {
+			case entity.ResponseStatusReturned:
+				returned = true
+				accepted = false
+			case entity.ResponseStatusAccepted:
+			default:
+				accepted = false
+			}
+		}
+
+		switch {
+		case accepted:
+			if httpStatus, exception := finalizeAssessment(c.Request().Context(), h, assessment, entity.ReviewStep{
+				Action: entity.ReviewActionFinalized,
+				By:     reviewer.ID,
+				Role:   role,
+				At:     timeNow,
+			}); exception != nil {
+				return c.JSON(httpStatus, exception)
+			}
+		case returned && assessment.ReviewStatus != entity.ReviewStatusReturned:
+			assessment.ReviewStatus = entity.ReviewStatusReturned
+			assessment.History = append(assessment.History, entity.ReviewStep{
+				Action: entity.ReviewActionReturned,
+				By:     reviewer.ID,
+				Role:   role,
+				At:     timeNow,
+			})
+			assessment.Model.UpdatedAt = timeNow
+			if _, err := h.repository.UpsertAssessment(assessment); err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+		}
+		assessments = append(assessments, assessment)
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: assessments, Count: len(assessments)})
+}
+
+// finalizeAssessment : score the accepted answers, build the report and close the assessment
+func finalizeAssessment(c context.Context, h Handler, assessment *entity.Assessment, step entity.ReviewStep) (int, *response.Exception) {
+	score, httpStatus, exception := scoreAssessment(c, h, assessment)
+	if exception != nil {
+		return httpStatus, exception
+	}
+
+	assessment.Score = score
+	assessment.CompletionDate = step.At
+	assessment.ReviewStatus = entity.ReviewStatusFinalized
+	assessment.FinalizedAt = step.At
+	assessment.FinalizedBy = step.By
+	assessment.History = append(assessment.History, step)
+	assessment.Model.UpdatedAt = step.At
+
+	// build the ESG report for the SME
+	reportPath, httpStatus, exception := generateAssessmentReport(c, h, assessment)
+	if exception != nil {
+		return httpStatus, exception
+	}
+	assessment.Report = reportPath
+
+	if _, err := h.repository.UpsertAssessment(assessment); err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+	return http.StatusOK, nil
+}
+
+// entryEditable : whether the SME can still change the answer of an entry
+func entryEditable(entry *entity.AssessmentEntry) bool {
+	switch entry.RespondStatus {
+	case entity.ResponseStatusToStart, entity.ResponseStatusInProgress, entity.ResponseStatusReturned:
+		return true
+	}
+	return false
+}
@@ -6,10 +6,14 @@ import (
 	"csi-api/app/kit/jwt"
 	"csi-api/app/response"
 	"csi-api/app/response/errcode"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // AuthenticatedUser:
@@ -25,12 +29,18 @@ func (h Handler) AuthenticatedUser(next echo.HandlerFunc) echo.HandlerFunc {
 			if exception != nil {
 				return c.JSON(httpStatus, exception)
 			}
+
+			// tokens stop working as soon as their session is revoked
+			session, httpStatus, exception := ValidateSession(h, c.Request().Context(), reqClaims.ID, reqClaims.Audience)
+			if exception != nil {
+				return c.JSON(httpStatus, exception)
+			}
+			c.Set("SESSION", *session)
+
 			admin, _, _ := ValidateAdmin(h, c.Request().Context(), reqClaims.Audience)
 
 			smeUser, _, _ := ValidateSMEUser(h, c.Request().Context(), reqClaims.Audience)
 
-			// corporateUser, _, _ := ValidateCorporateUser(h, c.Request().Context(), reqClaims.Audience)
-
 			if admin.ID != nil {
 				if admin.Role == entity.UserRoleAdmin {
 					role = "superAdmin"
@@ -38,6 +48,10 @@ func (h Handler) AuthenticatedUser(next echo.HandlerFunc) echo.HandlerFunc {
 					role = "smeVendor"
 				} else if admin.Role == entity.UserRoleCorporateVendor {
 					role = "corporateVendor"
+				} else if len(admin.Scopes) > 0 {
+					// the scopes of the token which the admin still has, new scopes apply from the next token
+					role = "scopedAdmin"
+					c.Set("scopes", tokenScopes(reqClaims.Scopes, admin.Scopes))
 				} else {
 					role = "admin"
 				}
@@ -52,22 +66,34 @@ func (h Handler) AuthenticatedUser(next echo.HandlerFunc) echo.HandlerFunc {
 				// 	role = "smeUser"
 				// 	c.Set("SME_USER", *smeUser)
 				// }
+			} else if corporateUser, _, _ := ValidateCorporateUser(h, c.Request().Context(), reqClaims.Audience); corporateUser.ID != nil {
+				if corporateUser.Role == entity.UserRoleAdmin {
+					role = "corporateAdmin"
+				} else {
+					role = "corporateUser"
+				}
+				c.Set("CORPORATE_USER", *corporateUser)
 			}
-			// else if corporateUser.ID != nil {
-			// 	if corporateUser.Role == entity.UserRoleAdmin {
-			// 		role = "corporateAdmin"
-			// 		c.Set("CORPORATE_ADMIN", *corporateUser)
-			// 	} else {
-			// 		role = "corporateUser"
-			// 		c.Set("CORPORATE_USER", *corporateUser)
-			// 	}
-			// }
 		}
 		c.Set("role", role)
 		return next(c)
 	}
 }
 
+// tokenScopes : scopes of the token claim which are in the assigned scopes
+func tokenScopes(claim string, assigned []entity.Scope) []string {
+	scopes := make([]string, 0, len(assigned))
+	for _, s := range strings.Split(claim, ",") {
+		for _, a := range assigned {
+			if strings.TrimSpace(s) == string(a) {
+				scopes = append(scopes, s)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
 // VerifyToken :
 func VerifyToken(tokenArr []string) (string, *jwt.ExtractedClaims, int, *response.Exception) {
 	if len(tokenArr) != 2 {
@@ -105,5 +131,178 @@ func VerifyToken(tokenArr []string) (string, *jwt.ExtractedClaims, int, *respons
 		return "", nil, http.StatusUnauthorized, &response.Exception{Code: errcode.InvalidToken, Error: err}
 	}
 
+	// refresh tokens can only be exchanged at the refresh endpoint, tokens issued before the typ claim are rejected too
+	if reqClaims.Type != jwt.TokenTypeAccess {
+		return "", nil, http.StatusUnauthorized, &response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("not an access token")}
+	}
+
 	return token, reqClaims, http.StatusOK, nil
 }
+
+// RefreshToken : exchange a refresh token for a new token pair. Each refresh token can be used once, reusing one
+// revokes every token of the login.
+func (h Handler) RefreshToken(c echo.Context) error {
+	var i struct {
+		RefreshToken string `json:"refreshToken" form:"refreshToken" validate:"required"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	claims, err := jwt.Validate(i.RefreshToken)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: err})
+	}
+
+	if ok := claims.VerifyIssuer(env.Config.Jwt.Issuer, true); !ok {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken})
+	}
+
+	reqClaims, err := jwt.ExtractClaims(claims)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: err})
+	}
+
+	if reqClaims.Type != jwt.TokenTypeRefresh || reqClaims.ID == "" {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("not a refresh token")})
+	}
+
+	if isExpired, err := jwt.IsTokenExpired(reqClaims.Exp); err != nil || isExpired {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("refresh token expired")})
+	}
+
+	record, err := h.repository.FindRefreshTokenByID(c.Request().Context(), reqClaims.ID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("refresh token not found")})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if record.UserID.Hex() != reqClaims.Audience {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("refresh token user mismatch")})
+	}
+
+	if record.Status != entity.RefreshTokenStatusActive {
+		// a used token presented again means it was stolen, end the whole session
+		if record.Status == entity.RefreshTokenStatusUsed {
+			if _, err := h.repository.RevokeSessions(c.Request().Context(), record.UserID, record.SessionID, nil); err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+		}
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("refresh token is %s", strings.ToLower(string(record.Status)))})
+	}
+
+	session, httpStatus, exception := ValidateSession(h, c.Request().Context(), record.SessionID.Hex(), reqClaims.Audience)
+	if exception != nil {
+		return c.JSON(httpStatus, response.Exception{Code: errcode.InvalidRefreshToken, Error: exception.Error})
+	}
+
+	// the user could be deactivated or have a new role or scopes since the last login
+	var tokenClaims map[string]string
+	if admin, _, _ := ValidateAdmin(h, c.Request().Context(), reqClaims.Audience); admin.ID != nil {
+		tokenClaims = adminTokenClaims(admin)
+	} else if smeUser, _, _ := ValidateSMEUser(h, c.Request().Context(), reqClaims.Audience); smeUser.ID != nil {
+		tokenClaims = map[string]string{
+			"sub":    reqClaims.Audience,
+			"aud":    reqClaims.Audience,
+			"scopes": fmt.Sprintf("%v", smeUser.Role),
+		}
+	} else if corporateUser, _, _ := ValidateCorporateUser(h, c.Request().Context(), reqClaims.Audience); corporateUser.ID != nil {
+		tokenClaims = map[string]string{
+			"sub":    reqClaims.Audience,
+			"aud":    reqClaims.Audience,
+			"scopes": fmt.Sprintf("%v", corporateUser.Role),
+		}
+	} else {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("user %s not found or inactive", reqClaims.Audience)})
+	}
+
+	// mark the token used before issuing, so concurrent requests with the same token only get one pair
+	tokenID := primitive.NewObjectID()
+	used, err := h.repository.UseRefreshToken(c.Request().Context(), record.ID, &tokenID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if !used {
+		if _, err := h.repository.RevokeSessions(c.Request().Context(), record.UserID, record.SessionID, nil); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidRefreshToken, Error: fmt.Errorf("refresh token already used")})
+	}
+
+	tokens, err := issueTokens(c, h, record.UserID, session, &tokenID, tokenClaims)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: tokens})
+}
+
+// issueTokens : generate a token pair and store the refresh token. A login starts a new session, rotated tokens
+// stay in the session of the token they replace.
+func issueTokens(c echo.Context, h Handler, userID *primitive.ObjectID, session *entity.Session, tokenID *primitive.ObjectID, claims map[string]string) (map[string]interface{}, error) {
+	if tokenID == nil {
+		id := primitive.NewObjectID()
+		tokenID = &id
+	}
+
+	timeNow := time.Now().UTC()
+	newSession := session == nil
+	if newSession {
+		sessionID := primitive.NewObjectID()
+		session = &entity.Session{
+			ID:        &sessionID,
+			UserID:    userID,
+			UserAgent: c.Request().UserAgent(),
+			IPAddress: c.RealIP(),
+			Status:    entity.SessionStatusActive,
+			Model: entity.Model{
+				CreatedAt: timeNow,
+			},
+		}
+	}
+
+	// the access token carries the session id so it can be revoked, the refresh token carries its own id
+	claims["jti"] = session.ID.Hex()
+	tokens, err := jwt.GenerateTokens(env.Config.Jwt.Secret, tokenID.Hex(), claims)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", tokens["refreshTokenExpiresAt"]))
+	if err != nil {
+		return nil, err
+	}
+
+	session.ExpiresAt = expiresAt.UTC()
+	session.LastUsedAt = timeNow
+	session.UpdatedAt = timeNow
+	if newSession {
+		if _, err := h.repository.CreateSession(c.Request().Context(), *session); err != nil {
+			return nil, err
+		}
+	} else if _, err := h.repository.UpsertSession(session); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.repository.CreateRefreshToken(c.Request().Context(), entity.RefreshToken{
+		ID:        tokenID,
+		UserID:    userID,
+		SessionID: session.ID,
+		ExpiresAt: expiresAt.UTC(),
+		Status:    entity.RefreshTokenStatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,573 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/env"
+	"csi-api/app/kit/aws"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// how often due campaign reminders are sent
+	campaignReminderInterval = time.Hour
+	// most SMEs a campaign can be sent to at once
+	campaignMaxParticipants = 200
+)
+
+// default days before the deadline the participants are reminded
+var campaignReminderDays = []int{7, 1}
+
+// CampaignParticipantReport : progress of a participant of a campaign
+type CampaignParticipantReport struct {
+	*repository.CampaignParticipantProgress
+	Progress       entity.CampaignProgress `json:"progress"`
+	RemindersSent  []int                   `json:"remindersSent"`
+	LastRemindedAt time.Time               `json:"lastRemindedAt"`
+}
+
+// CampaignReport : progress of every participant of a campaign and how many are at each stage
+type CampaignReport struct {
+	Campaign       *entity.Campaign                `json:"campaign"`
+	Participants   []CampaignParticipantReport     `json:"participants"`
+	Totals         map[entity.CampaignProgress]int `json:"totals"`
+	CompletionRate float64                         `json:"completionRate"` // percent of participants completed
+}
+
+// GetCampaigns : corporate users see the campaigns of their corporate, sme users the campaigns their company takes
+// part in
+func (h Handler) GetCampaigns(c echo.Context) error {
+	corporateID, httpStatus, exception := corporateTenantFilter(c, c.QueryParam("corporateId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	smeID, httpStatus, exception := tenantFilter(c, c.QueryParam("smeId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	campaigns, cursor, err := h.repository.FindCampaigns(c.Request().Context(), repository.FindCampaignFilter{
+		Cursor:      c.QueryParam("cursor"),
+		IDs:         c.Request().URL.Query()["id"],
+		CorporateID: corporateID,
+		SMEID:       smeID,
+		Status:      entity.Status(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	// the other suppliers of a corporate are not shown to an sme
+	if tenant := tenantID(c); tenant != nil {
+		for _, campaign := range campaigns {
+			participants := make([]entity.CampaignParticipant, 0, 1)
+			for _, participant := range campaign.Participants {
+				if participant.SMEID != nil && participant.SMEID.Hex() == tenant.Hex() {
+					participants = append(participants, participant)
+				}
+			}
+			campaign.Participants = participants
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: campaigns, Cursor: cursor, Count: len(campaigns)})
+}
+
+// CreateCampaign : send a published question set to connected SMEs of a corporate, every SME gets an assessment
+// to complete by the deadline and is reminded before it
+func (h Handler) CreateCampaign(c echo.Context) error {
+	var i struct {
+		CorporateID   string    `json:"corporateID" form:"corporateID" validate:"required,max=50"`
+		Name          string    `json:"name" form:"name" validate:"required,max=150"`
+		QuestionSetID string    `json:"questionSetID" form:"questionSetID" validate:"required,max=50"`
+		SMEIDs        []string  `json:"smeIDs" form:"smeIDs" validate:"required,min=1,dive,max=50"`
+		Deadline      time.Time `json:"deadline" form:"deadline"`
+		ReminderDays  []int     `json:"reminderDays" form:"reminderDays" validate:"max=5,dive,min=1,max=90"`
+		// reporting period, defaults to the current calendar year
+		PeriodStart time.Time `json:"periodStart" form:"periodStart"`
+		PeriodEnd   time.Time `json:"periodEnd" form:"periodEnd"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// cleanup
+	i.CorporateID = strings.TrimSpace(i.CorporateID)
+	i.Name = strings.TrimSpace(i.Name)
+	i.QuestionSetID = strings.TrimSpace(i.QuestionSetID)
+	smeIDs := make([]string, 0, len(i.SMEIDs))
+	seen := make(map[string]bool, len(i.SMEIDs))
+	for _, id := range i.SMEIDs {
+		id = strings.TrimSpace(id)
+		if !seen[id] {
+			seen[id] = true
+			smeIDs = append(smeIDs, id)
+		}
+	}
+	i.SMEIDs = smeIDs
+
+	// campaigns come from the corporate side
+	if tenantID(c) != nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only corporates can send a campaign")})
+	}
+
+	// corporate users send campaigns of their own corporate
+	corporateID, httpStatus, exception := corporateTenantFilter(c, i.CorporateID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	i.CorporateID = corporateID
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+	if len(i.SMEIDs) > campaignMaxParticipants {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("a campaign can be sent to at most %d smes", campaignMaxParticipants)})
+	}
+
+	timeNow := time.Now().UTC()
+	if !i.Deadline.After(timeNow) {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("deadline must be in the future")})
+	}
+	if i.ReminderDays == nil {
+		i.ReminderDays = campaignReminderDays
+	}
+
+	if i.PeriodStart.IsZero() && i.PeriodEnd.IsZero() {
+		i.PeriodStart, i.PeriodEnd = calendarYear(timeNow.Year())
+	}
+	if !i.PeriodEnd.After(i.PeriodStart) {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("periodEnd must be after periodStart")})
+	}
+
+	corporate, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), i.CorporateID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// check if question set exists
+	questionSet, httpStatus, exception := ValidateQuestionSet(h, c.Request().Context(), i.QuestionSetID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// only published revisions can be assessed
+	if questionSetState(questionSet) != entity.QuestionSetStatePublished {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.QuestionSetNotPublished, Error: fmt.Errorf("questionSet %s is not published", i.QuestionSetID)})
+	}
+
+	// every sme has to be in the supply chain of the corporate before any assessment is created
+	smes := make([]*entity.SME, 0, len(i.SMEIDs))
+	for _, smeID := range i.SMEIDs {
+		sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), smeID)
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+
+		connections, _, err := h.repository.FindConnections(c.Request().Context(), repository.FindConnectionFilter{
+			RequestCompanyID:  corporate.ID.Hex(),
+			ReceivedCompanyID: sme.ID.Hex(),
+			Status:            entity.StatusActive,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if len(connections) == 0 {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.CorporateNotConnected, Error: fmt.Errorf("sme %s is not connected with corporate %s", smeID, corporate.ID.Hex())})
+		}
+		smes = append(smes, sme)
+	}
+
+	campaignID := primitive.NewObjectID()
+	campaign := entity.Campaign{
+		ID:            &campaignID,
+		CorporateID:   corporate.ID,
+		Name:          i.Name,
+		QuestionSetID: questionSet.ID,
+		Revision:      questionSet.Revision,
+		PeriodStart:   i.PeriodStart.UTC(),
+		PeriodEnd:     i.PeriodEnd.UTC(),
+		Deadline:      i.Deadline.UTC(),
+		ReminderDays:  i.ReminderDays,
+		Participants:  make([]entity.CampaignParticipant, 0, len(smes)),
+		CreatedBy:     actingUserID(c),
+		Status:        entity.StatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+
+	// reminders already due are covered by the invitation
+	remindersSent := dueReminderDays(&campaign, timeNow)
+	// a campaign which fails partway takes the assessments created so far with it
+	assessments := make([]*entity.Assessment, 0, len(smes))
+	for _, sme := range smes {
+		assessment, httpStatus, exception := createAssessment(c.Request().Context(), h, sme, questionSet, AssessmentInput{
+			PeriodStart: i.PeriodStart,
+			PeriodEnd:   i.PeriodEnd,
+			CampaignID:  campaign.ID,
+		})
+		if exception != nil {
+			discardAssessments(c.Request().Context(), h, assessments)
+			return c.JSON(httpStatus, exception)
+		}
+		assessments = append(assessments, assessment)
+		campaign.Participants = append(campaign.Participants, entity.CampaignParticipant{
+			SMEID:         sme.ID,
+			AssessmentID:  assessment.ID,
+			RemindersSent: remindersSent,
+		})
+	}
+
+	if _, err := h.repository.CreateCampaign(c.Request().Context(), campaign); err != nil {
+		discardAssessments(c.Request().Context(), h, assessments)
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	// the campaign stands when an email fails, the sme still gets the reminders
+	for idx, sme := range smes {
+		if _, exception := sendCampaignEmail(c.Request().Context(), h, &campaign, corporate, sme.ID, sme.CompanyName, campaign.Participants[idx].AssessmentID, false); exception != nil {
+			log.Printf("campaign %s: invitation to sme %s not sent: %v", campaign.ID.Hex(), sme.ID.Hex(), exception.Error)
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: campaign})
+}
+
+// UpdateCampaign : rename a campaign, move its deadline, change its reminders or close it. Assessments already
+// sent stay with the SMEs.
+func (h Handler) UpdateCampaign(c echo.Context) error {
+	campaignID := c.QueryParam("id")
+	var i struct {
+		Name         string        `json:"name" form:"name" validate:"max=150"`
+		Deadline     time.Time     `json:"deadline" form:"deadline"`
+		ReminderDays []int         `json:"reminderDays" form:"reminderDays" validate:"max=5,dive,min=1,max=90"`
+		Status       entity.Status `json:"status" form:"status" validate:"omitempty,oneof=ACTIVE INACTIVE"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// cleanup
+	i.Name = strings.TrimSpace(i.Name)
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	campaign, httpStatus, exception := findCampaign(c, h, campaignID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	remindersChanged := false
+	if i.Name != "" {
+		campaign.Name = i.Name
+	}
+	if !i.Deadline.IsZero() && !i.Deadline.Equal(campaign.Deadline) {
+		if !i.Deadline.After(timeNow) {
+			return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("deadline must be in the future")})
+		}
+		campaign.Deadline = i.Deadline.UTC()
+		remindersChanged = true
+	}
+	if i.ReminderDays != nil {
+		campaign.ReminderDays = i.ReminderDays
+		remindersChanged = true
+	}
+	if i.Status != "" {
+		campaign.Status = i.Status
+	}
+	campaign.UpdatedAt = timeNow
+
+	// reminders start over from the new schedule, without the ones already due
+	var remindersSent []int
+	if remindersChanged {
+		remindersSent = dueReminderDays(campaign, timeNow)
+	}
+
+	if _, err := h.repository.UpdateCampaign(c.Request().Context(), campaign, remindersSent); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+	if remindersSent != nil {
+		for idx := range campaign.Participants {
+			campaign.Participants[idx].RemindersSent = remindersSent
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: campaign})
+}
+
+// GetCampaignProgress : where every participant of a campaign is with its assessment
+func (h Handler) GetCampaignProgress(c echo.Context) error {
+	campaign, httpStatus, exception := findCampaign(c, h, c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	progress, err := h.repository.CampaignProgress(c.Request().Context(), campaign.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	byAssessment := make(map[string]*repository.CampaignParticipantProgress, len(progress))
+	for _, p := range progress {
+		byAssessment[p.AssessmentID.Hex()] = p
+	}
+
+	report := CampaignReport{
+		Campaign:     campaign,
+		Participants: make([]CampaignParticipantReport, 0, len(campaign.Participants)),
+		Totals: map[entity.CampaignProgress]int{
+			entity.CampaignProgressNotStarted: 0,
+			entity.CampaignProgressInProgress: 0,
+			entity.CampaignProgressSubmitted:  0,
+			entity.CampaignProgressReturned:   0,
+			entity.CampaignProgressCompleted:  0,
+		},
+	}
+	for _, participant := range campaign.Participants {
+		// the assessment may have been removed by the sme since
+		p, ok := byAssessment[participant.AssessmentID.Hex()]
+		if !ok {
+			p = &repository.CampaignParticipantProgress{AssessmentID: participant.AssessmentID, SMEID: participant.SMEID}
+		}
+		state := participantProgress(p)
+		report.Totals[state]++
+		report.Participants = append(report.Participants, CampaignParticipantReport{
+			CampaignParticipantProgress: p,
+			Progress:                    state,
+			RemindersSent:               participant.RemindersSent,
+			LastRemindedAt:              participant.LastRemindedAt,
+		})
+	}
+	if len(campaign.Participants) > 0 {
+		report.CompletionRate = float64(report.Totals[entity.CampaignProgressCompleted]) * 100 / float64(len(campaign.Participants))
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: report})
+}
+
+// StartCampaignReminders : send the due reminders of running campaigns in the background, right away and then on
+// every tick until ctx is cancelled. A failed round is retried on the next tick.
+func (h Handler) StartCampaignReminders(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(campaignReminderInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := sendCampaignReminders(ctx, h, time.Now().UTC()); err != nil {
+				log.Printf("campaign reminders: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sendCampaignReminders : remind the participants who have not submitted yet of the latest reminder due of every
+// running campaign. A reminder is claimed before it is sent so every instance can run this, a failed email is not
+// sent again. A campaign which fails is logged and skipped, the others still get their reminders.
+func sendCampaignReminders(ctx context.Context, h Handler, at time.Time) error {
+	campaigns, err := findAllCampaigns(ctx, h, repository.FindCampaignFilter{
+		Status:        entity.StatusActive,
+		DeadlineAfter: at,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, campaign := range campaigns {
+		due := dueReminderDays(campaign, at)
+		if len(due) == 0 {
+			continue
+		}
+		day := due[len(due)-1]
+
+		// inactive corporates send no reminders
+		corporate, _, exception := ValidateCorporate(h, ctx, campaign.CorporateID.Hex())
+		if exception != nil {
+			continue
+		}
+
+		progress, err := h.repository.CampaignProgress(ctx, campaign.ID)
+		if err != nil {
+			log.Printf("campaign %s: progress not loaded: %v", campaign.ID.Hex(), err)
+			continue
+		}
+		for _, p := range progress {
+			switch participantProgress(p) {
+			case entity.CampaignProgressSubmitted, entity.CampaignProgressCompleted:
+				continue
+			}
+
+			claimed, err := h.repository.ClaimCampaignReminder(ctx, campaign.ID, p.SMEID, day, at)
+			if err != nil {
+				log.Printf("campaign %s: reminder to sme %s not claimed: %v", campaign.ID.Hex(), p.SMEID.Hex(), err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			if _, exception := sendCampaignEmail(ctx, h, campaign, corporate, p.SMEID, p.CompanyName, p.AssessmentID, true); exception != nil {
+				log.Printf("campaign %s: reminder to sme %s not sent: %v", campaign.ID.Hex(), p.SMEID.Hex(), exception.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// discardAssessments : delete the assessments of a campaign which could not be created, with their entries. The
+// campaign already failed, so a failed delete is only logged.
+func discardAssessments(ctx context.Context, h Handler, assessments []*entity.Assessment) {
+	for _, assessment := range assessments {
+		if _, err := h.repository.DeleteAssessmentByID(assessment); err != nil {
+			log.Printf("assessment %s of a failed campaign not deleted: %v", assessment.ID.Hex(), err)
+			continue
+		}
+		if _, err := h.repository.BulkDeleteAssessmentEntries(ctx, []string{assessment.ID.Hex()}); err != nil {
+			log.Printf("entries of assessment %s of a failed campaign not deleted: %v", assessment.ID.Hex(), err)
+		}
+	}
+}
+
+// findCampaign : campaign the current user can see, corporate users only see the campaigns of their corporate
+func findCampaign(c echo.Context, h Handler, campaignID string) (*entity.Campaign, int, *response.Exception) {
+	if tenantID(c) != nil {
+		return nil, http.StatusForbidden, &response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("campaigns are managed by corporates")}
+	}
+
+	campaign, err := h.repository.FindCampaignByID(c.Request().Context(), campaignID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("campaign %s not found", campaignID)}
+		}
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if httpStatus, exception := checkCorporateTenant(c, campaign.CorporateID); exception != nil {
+		return nil, httpStatus, exception
+	}
+	return campaign, http.StatusOK, nil
+}
+
+// findAllCampaigns : walk through every page of campaigns matching the filter
+func findAllCampaigns(c context.Context, h Handler, filter repository.FindCampaignFilter) ([]*entity.Campaign, error) {
+	var campaigns []*entity.Campaign
+	for {
+		result, nextCursor, err := h.repository.FindCampaigns(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return campaigns, nil
+}
+
+// dueReminderDays : reminder days of the campaign whose time has come at the given time, most days first
+func dueReminderDays(campaign *entity.Campaign, at time.Time) []int {
+	due := make([]int, 0, len(campaign.ReminderDays))
+	for _, day := range campaign.ReminderDays {
+		if !at.Before(campaign.Deadline.AddDate(0, 0, -day)) {
+			due = append(due, day)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(due)))
+	return due
+}
+
+// participantProgress : stage of a participant, from the review status of its assessment and its answered entries
+func participantProgress(p *repository.CampaignParticipantProgress) entity.CampaignProgress {
+	switch p.ReviewStatus {
+	case entity.ReviewStatusFinalized:
+		return entity.CampaignProgressCompleted
+	case entity.ReviewStatusInReview:
+		return entity.CampaignProgressSubmitted
+	case entity.ReviewStatusReturned:
+		return entity.CampaignProgressReturned
+	}
+	if p.Answered > 0 {
+		return entity.CampaignProgressInProgress
+	}
+	return entity.CampaignProgressNotStarted
+}
+
+// sendCampaignEmail : tell the active users of a participant about the assessment of a campaign, or remind them
+// of the deadline
+func sendCampaignEmail(ctx context.Context, h Handler, campaign *entity.Campaign, corporate *entity.Corporate, smeID *primitive.ObjectID, companyName string, assessmentID *primitive.ObjectID, reminder bool) (int, *response.Exception) {
+	users, _, err := h.repository.FindSMEUsers(ctx, repository.FindSMEUserFilter{
+		CompanyID: smeID.Hex(),
+		Status:    entity.UserStatusActive,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+	if len(users) == 0 {
+		return http.StatusOK, nil
+	}
+
+	recipients := make([]*string, 0, len(users))
+	for _, user := range users {
+		email := user.Email
+		recipients = append(recipients, &email)
+	}
+
+	content := `<p>Hi,</p>
+<p>{CorporateName} has asked {CompanyName} to complete the assessment "{CampaignName}" on CSI by {Deadline}.</p>
+<p><a href='{Link}'>Open assessment</a></p>
+<p>Best regards,<br>SDM Team</p>`
+	subject := fmt.Sprintf("%s asked you to complete an assessment on CSI", corporate.CompanyName)
+	if reminder {
+		content = `<p>Hi,</p>
+<p>This is a reminder that the assessment "{CampaignName}" {CorporateName} asked {CompanyName} to complete is due on {Deadline}.</p>
+<p><a href='{Link}'>Continue assessment</a></p>
+<p>Best regards,<br>SDM Team</p>`
+		subject = fmt.Sprintf("Reminder: assessment for %s due on %s", corporate.CompanyName, campaign.Deadline.Format("2 January 2006"))
+	}
+	content = strings.Replace(content, "{CorporateName}", html.EscapeString(corporate.CompanyName), 1)
+	content = strings.Replace(content, "{CompanyName}", html.EscapeString(companyName), 1)
+	content = strings.Replace(content, "{CampaignName}", html.EscapeString(campaign.Name), 1)
+	content = strings.Replace(content, "{Deadline}", campaign.Deadline.Format("2 January 2006"), 1)
+	content = strings.Replace(content, "{Link}", fmt.Sprintf("%s/assessments?id=%s", strings.TrimRight(env.Config.App.UserPortalPath, "/"), assessmentID.Hex()), 1)
+
+	return aws.SendEmails(recipients, subject, content, "", env.Config.AWS.Sender)
+}
@@ -3,11 +3,15 @@ package handler
 import (
 	"context"
 	"csi-api/app/entity"
+	"csi-api/app/env"
+	"csi-api/app/kit/aws"
 	"csi-api/app/repository"
 	"csi-api/app/response"
 	"csi-api/app/response/errcode"
 	"fmt"
+	"html"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -17,11 +21,24 @@ import (
 
 // GetConnections :
 func (h Handler) GetConnections(c echo.Context) error {
+	// sme users see the connections their company is part of
+	var companyID string
+	if tenant := tenantID(c); tenant != nil {
+		companyID = tenant.Hex()
+	}
+
+	// corporate users see the invitations of their corporate
+	requestCompanyID, httpStatus, exception := corporateTenantFilter(c, c.QueryParam("requestCompanyID"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	connections, cursor, err := h.repository.FindConnections(c.Request().Context(), repository.FindConnectionFilter{
 		Cursor:            c.QueryParam("cursor"),
 		IDs:               c.Request().URL.Query()["id"],
-		RequestCompanyID:  c.QueryParam("requestCompanyID"),
+		RequestCompanyID:  requestCompanyID,
 		ReceivedCompanyID: c.QueryParam("receivedCompanyID"),
+		CompanyID:         companyID,
 		Status:            entity.Status(c.QueryParam("status")),
 	})
 	if err != nil {
@@ -34,14 +51,13 @@ func (h Handler) GetConnections(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.Items{Items: connections, Cursor: cursor, Count: len(connections)})
 }
 
-// UpdateConnection :
-func (h Handler) UpdateConnection(c echo.Context) error {
-	connectionId := c.QueryParam("id")
+// CreateConnection : a corporate invites an SME to its supply chain, the SME is found by its SSM number or by the
+// email of one of its users and accepts or declines the emailed invitation
+func (h Handler) CreateConnection(c echo.Context) error {
 	var i struct {
-		RequestCompanyID  string        `bson:"requestCompanyID" json:"requestCompanyID" form:"requestCompanyID" validate:"max=50"`
-		ReceivedCompanyID string        `bson:"receivedCompanyID" json:"receivedCompanyID" form:"receivedCompanyID" validate:"max=50"`
-		LinkDate          time.Time     `bson:"linkDate" json:"linkDate" form:"linkDate"`
-		Status            entity.Status `bson:"status" json:"status" form:"status" validate:"eq=INVITED|eq=ACTIVE|eq=INACTIVE"`
+		CorporateID string `json:"corporateId" form:"corporateId" validate:"required,max=50"`
+		SSMNumber   string `json:"ssmNumber" form:"ssmNumber" validate:"max=24"`
+		Email       string `json:"email" form:"email" validate:"omitempty,email,max=100"`
 	}
 
 	// bind req input
@@ -49,65 +65,165 @@ func (h Handler) UpdateConnection(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
 	}
 
+	// cleanup
+	i.CorporateID = strings.TrimSpace(i.CorporateID)
+	i.SSMNumber = strings.TrimSpace(i.SSMNumber)
+	i.Email = strings.ToLower(strings.TrimSpace(i.Email))
+
+	// invitations come from the corporate side
+	if tenantID(c) != nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only corporates can invite an sme")})
+	}
+
+	// corporate users invite to their own corporate
+	corporateID, httpStatus, exception := corporateTenantFilter(c, i.CorporateID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	i.CorporateID = corporateID
+
 	// validate
 	if err := c.Validate(&i); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
+	if i.SSMNumber == "" && i.Email == "" {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("ssmNumber or email is required")})
+	}
 
-	// check if Connection exists
-	connection, err := h.repository.FindConnectionByID(c.Request().Context(), connectionId)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("Connection %s not found", connectionId)})
-		}
-		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	corporate, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), i.CorporateID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
 	}
 
-	if i.RequestCompanyID != "" {
-		reqIds, err := primitive.ObjectIDFromHex(i.RequestCompanyID)
+	// find the invited sme
+	var smeID string
+	if i.SSMNumber != "" {
+		smes, _, err := h.repository.FindSMEs(c.Request().Context(), repository.FindSMEFilter{
+			SSMNumbers: []string{i.SSMNumber},
+		})
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, response.Exception{
-				Code:  errcode.ServerError,
-				Error: err,
-			})
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if len(smes) == 0 {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.SSMNumberNotFound, Error: fmt.Errorf("sme with ssm number %s not found", i.SSMNumber)})
 		}
-		connection.RequestCompanyID = &reqIds
+		smeID = smes[0].ID.Hex()
 	}
-
-	if i.ReceivedCompanyID != "" {
-		recIds, err := primitive.ObjectIDFromHex(i.ReceivedCompanyID)
+	if i.Email != "" {
+		user, err := h.repository.FindSMEUserByEmail(c.Request().Context(), i.Email)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, response.Exception{
-				Code:  errcode.ServerError,
-				Error: err,
-			})
+			if err == mongo.ErrNoDocuments {
+				return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.EmailNotFound, Error: fmt.Errorf("sme user %s not found", i.Email)})
+			}
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if smeID != "" && smeID != user.CompanyID.Hex() {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.MismatchSME, Error: fmt.Errorf("sme user %s does not belong to sme %s", i.Email, i.SSMNumber)})
 		}
-		connection.ReceivedCompanyID = &recIds
+		smeID = user.CompanyID.Hex()
 	}
 
-	if i.Status != "" {
-		connection.Status = i.Status
+	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), smeID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
 	}
 
-	connection.LinkDate = time.Now().UTC()
+	// one pending or active connection between a corporate and an sme
+	connections, _, err := h.repository.FindConnections(c.Request().Context(), repository.FindConnectionFilter{
+		RequestCompanyID:  corporate.ID.Hex(),
+		ReceivedCompanyID: sme.ID.Hex(),
+		Statuses:          []entity.Status{entity.StatusInvited, entity.StatusActive},
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if len(connections) > 0 {
+		return c.JSON(http.StatusBadRequest, response.Exception{
+			Code:  errcode.ConnectionExists,
+			Error: fmt.Errorf("sme %s is already %s with corporate %s", sme.ID.Hex(), strings.ToLower(string(connections[0].Status)), corporate.ID.Hex()),
+		})
+	}
 
-	if _, err := h.repository.UpsertConnection(connection); err != nil {
+	connectionID := primitive.NewObjectID()
+	connection := entity.Connection{
+		ID:                &connectionID,
+		RequestCompanyID:  corporate.ID,
+		ReceivedCompanyID: sme.ID,
+		Status:            entity.StatusInvited,
+		InvitedEmail:      i.Email,
+		InvitedAt:         time.Now().UTC(),
+	}
+	if corporateUserData := c.Get("CORPORATE_USER"); corporateUserData != nil {
+		connection.InvitedBy = corporateUserData.(entity.CorporateUser).ID
+	} else if adminData := c.Get("ADMIN"); adminData != nil {
+		connection.InvitedBy = adminData.(entity.Admin).ID
+	}
+
+	if _, err = h.repository.CreateConnection(c.Request().Context(), connection); err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{
 			Code:  errcode.ServerError,
 			Error: err,
 		})
 	}
 
+	if httpStatus, exception := sendConnectionEmail(c.Request().Context(), h, &connection, corporate, sme); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	return c.JSON(http.StatusOK, response.Item{Item: connection})
 }
 
-// CreateConnection :
-func (h Handler) CreateConnection(c echo.Context) error {
+// AcceptConnection : the invited sme joins the supply chain of the corporate
+func (h Handler) AcceptConnection(c echo.Context) error {
+	connection, httpStatus, exception := pendingConnection(c, h, c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), connection.RequestCompanyID.Hex()); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	connection.Status = entity.StatusActive
+	connection.LinkDate = timeNow
+	connection.RespondedBy = actingUserID(c)
+	connection.RespondedAt = timeNow
+
+	if err := h.repository.AcceptConnection(c.Request().Context(), connection); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.ConnectionNotPending, Error: fmt.Errorf("connection %s is no longer pending", connection.ID.Hex())})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: connection})
+}
+
+// DeclineConnection : the invited sme turns the invitation down
+func (h Handler) DeclineConnection(c echo.Context) error {
+	connection, httpStatus, exception := pendingConnection(c, h, c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	connection.Status = entity.StatusRejected
+	connection.RespondedBy = actingUserID(c)
+	connection.RespondedAt = timeNow
+
+	if _, err := h.repository.UpsertConnection(connection); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: connection})
+}
+
+// UpdateConnection : withdraw a pending invitation or end an active connection, either side can end it
+func (h Handler) UpdateConnection(c echo.Context) error {
+	connectionId := c.QueryParam("id")
 	var i struct {
-		RequestCompanyID  string        `bson:"requestCompanyID" json:"requestCompanyID" form:"requestCompanyID" validate:"required,max=50"`
-		ReceivedCompanyID string        `bson:"receivedCompanyID" json:"receivedCompanyID" form:"receivedCompanyID" validate:"required,max=50"`
-		LinkDate          time.Time     `bson:"linkDate" json:"linkDate" form:"linkDate"`
-		Status            entity.Status `bson:"status" json:"status" form:"status" validate:"eq=INVITED|eq=ACTIVE|eq=INACTIVE"`
+		Status entity.Status `json:"status" form:"status" validate:"required,eq=INACTIVE"`
 	}
 
 	// bind req input
@@ -120,42 +236,28 @@ func (h Handler) CreateConnection(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
 
-	// create time object
-	timeNow := time.Now().UTC()
-
-	// create connection object
-	connectionID := primitive.NewObjectID()
-
-	reqIds, err := primitive.ObjectIDFromHex(i.RequestCompanyID)
+	// check if Connection exists
+	connection, err := h.repository.FindConnectionByID(c.Request().Context(), connectionId)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("Connection %s not found", connectionId)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
-	recIds, err := primitive.ObjectIDFromHex(i.ReceivedCompanyID)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+	if httpStatus, exception := checkConnectionTenant(c, connection); exception != nil {
+		return c.JSON(httpStatus, exception)
 	}
 
-	connection := entity.Connection{
-		ID:                &connectionID,
-		RequestCompanyID:  &reqIds,
-		ReceivedCompanyID: &recIds,
-		LinkDate:          timeNow,
-		Status:            i.Status,
+	if connection.Status != entity.StatusInvited && connection.Status != entity.StatusActive {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("connection %s already ended", connectionId)})
 	}
 
-	if _, err = h.repository.CreateConnection(c.Request().Context(), connection); err != nil {
-		return c.JSON(http.StatusInternalServerError, response.Exception{
-			Code:  errcode.ServerError,
-			Error: err,
-		})
+	// the link of the sme goes together with the connection
+	if _, err := h.repository.UnlinkSMECorporate(c.Request().Context(), connection.ReceivedCompanyID, connection.RequestCompanyID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
+	connection.Status = i.Status
 
 	return c.JSON(http.StatusOK, response.Item{Item: connection})
 }
@@ -176,3 +278,82 @@ func ValidateConnection(h Handler, ctx context.Context, companyID string) (*enti
 	}
 	return connection, http.StatusOK, nil
 }
+
+// pendingConnection : invitation the current user can respond to, only the invited sme and admins respond
+func pendingConnection(c echo.Context, h Handler, connectionID string) (*entity.Connection, int, *response.Exception) {
+	if corporateTenantID(c) != nil {
+		return nil, http.StatusForbidden, &response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only the invited sme can respond to an invitation")}
+	}
+
+	connection, err := h.repository.FindConnectionByID(c.Request().Context(), connectionID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("connection %s not found", connectionID)}
+		}
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if httpStatus, exception := checkTenant(c, connection.ReceivedCompanyID); exception != nil {
+		return nil, httpStatus, exception
+	}
+
+	if connection.Status != entity.StatusInvited {
+		return nil, http.StatusBadRequest, &response.Exception{Code: errcode.ConnectionNotPending, Error: fmt.Errorf("connection %s is no longer pending", connectionID)}
+	}
+	return connection, http.StatusOK, nil
+}
+
+// actingUserID : sme user or admin acting on an invitation or a share
+func actingUserID(c echo.Context) *primitive.ObjectID {
+	if smeUserData := c.Get("SME_ADMIN"); smeUserData != nil {
+		return smeUserData.(entity.SMEUser).ID
+	}
+	if adminData := c.Get("ADMIN"); adminData != nil {
+		return adminData.(entity.Admin).ID
+	}
+	return nil
+}
+
+// checkConnectionTenant : sme users can only reach connections of their company, corporate users the ones of
+// their corporate
+func checkConnectionTenant(c echo.Context, connection *entity.Connection) (int, *response.Exception) {
+	if httpStatus, exception := checkCorporateTenant(c, connection.RequestCompanyID); exception != nil {
+		return httpStatus, exception
+	}
+	return checkTenant(c, connection.ReceivedCompanyID)
+}
+
+// sendConnectionEmail : invitation to the invited user, or to every active user of the sme when it was invited by
+// SSM number
+func sendConnectionEmail(ctx context.Context, h Handler, connection *entity.Connection, corporate *entity.Corporate, sme *entity.SME) (int, *response.Exception) {
+	filter := repository.FindSMEUserFilter{
+		CompanyID: sme.ID.Hex(),
+		Status:    entity.UserStatusActive,
+	}
+	if connection.InvitedEmail != "" {
+		filter.Emails = []string{connection.InvitedEmail}
+	}
+	users, _, err := h.repository.FindSMEUsers(ctx, filter)
+	if err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+	if len(users) == 0 {
+		return http.StatusOK, nil
+	}
+
+	recipients := make([]*string, 0, len(users))
+	for _, user := range users {
+		email := user.Email
+		recipients = append(recipients, &email)
+	}
+
+	content := `<p>Hi,</p>
+<p>{CorporateName} has invited {CompanyName} to join its supply chain on CSI. Once accepted, {CorporateName} can see the assessments you share with it.</p>
+<p><a href='{Link}'>Review invitation</a></p>
+<p>Best regards,<br>SDM Team</p>`
+	content = strings.Replace(content, "{CorporateName}", html.EscapeString(corporate.CompanyName), -1)
+	content = strings.Replace(content, "{CompanyName}", html.EscapeString(sme.CompanyName), 1)
+	content = strings.Replace(content, "{Link}", fmt.Sprintf("%s/connections?id=%s", strings.TrimRight(env.Config.App.UserPortalPath, "/"), connection.ID.Hex()), 1)
+
+	return aws.SendEmails(recipients, fmt.Sprintf("%s invited you to its supply chain on CSI", corporate.CompanyName), content, "", env.Config.AWS.Sender)
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/kit/general"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetCorporates :
+func (h Handler) GetCorporates(c echo.Context) error {
+	// corporate users see their own corporate
+	ids, httpStatus, exception := corporateTenantFilterIDs(c, c.Request().URL.Query()["id"])
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	corporates, cursor, err := h.repository.FindCorporates(c.Request().Context(), repository.FindCorporateFilter{
+		Cursor:      c.QueryParam("cursor"),
+		IDs:         ids,
+		SSMNumbers:  c.Request().URL.Query()["ssmNumber"],
+		CompanyName: c.QueryParam("companyName"),
+		Status:      entity.Status(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: corporates, Cursor: cursor, Count: len(corporates)})
+}
+
+// CreateCorporate : corporates are onboarded by admins, their users are added through /admin/corporateUser
+func (h Handler) CreateCorporate(c echo.Context) error {
+	var i struct {
+		CompanyName    string `json:"companyName" form:"companyName" validate:"required,max=50"`
+		SSMNumber      string `json:"ssmNumber" form:"ssmNumber" validate:"required,max=24"`
+		BusinessEntity string `json:"businessEntity" form:"businessEntity"`
+		State          string `json:"state" form:"state" validate:"required,max=40"`
+		PostCode       string `json:"postCode" form:"postCode" validate:"required,max=5"`
+		MSIC           string `json:"msic" form:"msic" validate:"msic,max=10"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// cleanup
+	i.PostCode = strings.TrimSpace(i.PostCode)
+	i.SSMNumber = strings.TrimSpace(i.SSMNumber)
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	// check if corporate exists
+	corporates, _, err := h.repository.FindCorporates(c.Request().Context(), repository.FindCorporateFilter{
+		SSMNumbers: []string{i.SSMNumber},
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if len(corporates) > 0 {
+		return c.JSON(http.StatusBadRequest, response.Exception{
+			Code:  errcode.SSMNumberFound,
+			Error: fmt.Errorf("corporate with ssm number %s already exists", i.SSMNumber),
+		})
+	}
+
+	// create time object
+	timeNow := time.Now().UTC()
+
+	// create corporate object
+	corporateID := primitive.NewObjectID()
+
+	corporate := entity.Corporate{
+		ID:             &corporateID,
+		CompanyName:    i.CompanyName,
+		SSMNumber:      i.SSMNumber,
+		BusinessEntity: entity.BusinessEntity(i.BusinessEntity),
+		State:          i.State,
+		PostCode:       i.PostCode,
+		MSIC:           i.MSIC,
+		Status:         entity.StatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+
+	if adminData := c.Get("ADMIN"); adminData != nil {
+		corporate.ApprovedBy = adminData.(entity.Admin).ID
+	}
+
+	// check if SSM document is uploaded
+	if ssmDoc, _ := c.FormFile("ssmDoc"); ssmDoc != nil {
+		path := fmt.Sprintf("corporate/%s/ssm/", corporateID.Hex())
+		if exception := general.ReadFile(ssmDoc, path); exception != nil {
+			return c.JSON(http.StatusInternalServerError, exception)
+		}
+		corporate.SSMDoc = path + ssmDoc.Filename
+	}
+
+	// check if profile picture is uploaded
+	if profilePicture, _ := c.FormFile("profilePicture"); profilePicture != nil {
+		path := fmt.Sprintf("corporate/%s/profile/", corporateID.Hex())
+		if exception := general.ReadFile(profilePicture, path); exception != nil {
+			return c.JSON(http.StatusInternalServerError, exception)
+		}
+		corporate.ProfilePicture = path + profilePicture.Filename
+	}
+
+	if _, err = h.repository.CreateCorporate(c.Request().Context(), corporate); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: corporate})
+}
+
+// UpdateCorporate : corporate admins update the profile of their own corporate, only admins change the status
+func (h Handler) UpdateCorporate(c echo.Context) error {
+	var i struct {
+		CompanyName    string        `json:"companyName" form:"companyName" validate:"max=50"`
+		SSMNumber      string        `json:"ssmNumber" form:"ssmNumber" validate:"max=24"`
+		BusinessEntity string        `json:"businessEntity" form:"businessEntity"`
+		State          string        `json:"state" form:"state" validate:"max=40"`
+		PostCode       string        `json:"postCode" form:"postCode" validate:"max=5"`
+		MSIC           string        `json:"msic" form:"msic" validate:"msic,max=10"`
+		Status         entity.Status `json:"status" form:"status" validate:"omitempty,eq=ACTIVE|eq=INACTIVE|eq=SUSPENDED"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// cleanup
+	i.PostCode = strings.TrimSpace(i.PostCode)
+	i.SSMNumber = strings.TrimSpace(i.SSMNumber)
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	corporateID, httpStatus, exception := corporateTenantFilter(c, c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// check if corporate exists
+	corporate, err := h.repository.FindCorporateByID(c.Request().Context(), corporateID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("corporate %s not found", corporateID)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if i.CompanyName != "" {
+		corporate.CompanyName = i.CompanyName
+	}
+
+	if i.SSMNumber != "" && i.SSMNumber != corporate.SSMNumber {
+		corporates, _, err := h.repository.FindCorporates(c.Request().Context(), repository.FindCorporateFilter{
+			SSMNumbers: []string{i.SSMNumber},
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if len(corporates) > 0 {
+			return c.JSON(http.StatusBadRequest, response.Exception{
+				Code:  errcode.SSMNumberFound,
+				Error: fmt.Errorf("corporate with ssm number %s already exists", i.SSMNumber),
+			})
+		}
+		corporate.SSMNumber = i.SSMNumber
+	}
+
+	if i.BusinessEntity != "" {
+		corporate.BusinessEntity = entity.BusinessEntity(i.BusinessEntity)
+	}
+
+	if i.State != "" {
+		corporate.State = i.State
+	}
+
+	if i.PostCode != "" {
+		corporate.PostCode = i.PostCode
+	}
+
+	if i.MSIC != "" {
+		corporate.MSIC = i.MSIC
+	}
+
+	if i.Status != "" {
+		if c.Get("ADMIN") == nil {
+			return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only admins can change the status of a corporate")})
+		}
+		corporate.Status = i.Status
+	}
+
+	// check if profile picture is uploaded
+	if profilePicture, _ := c.FormFile("profilePicture"); profilePicture != nil {
+		path := fmt.Sprintf("corporate/%s/profile/", corporate.ID.Hex())
+		if exception := general.ReadFile(profilePicture, path); exception != nil {
+			return c.JSON(http.StatusInternalServerError, exception)
+		}
+		corporate.ProfilePicture = path + profilePicture.Filename
+	}
+
+	corporate.Model.UpdatedAt = time.Now().UTC()
+
+	if _, err := h.repository.UpsertCorporate(corporate); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: corporate})
+}
+
+// DeleteCorporate :
+func (h Handler) DeleteCorporate(c echo.Context) error {
+	corporateID := c.QueryParam("id")
+
+	corporate, err := h.repository.FindCorporateByID(c.Request().Context(), corporateID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("corporate %s not found", corporateID)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if _, err := h.repository.DeleteCorporateByID(corporate); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// UnlinkCorporateSME : remove a vendor SME from the supply chain of a corporate
+func (h Handler) UnlinkCorporateSME(c echo.Context) error {
+	corporateID, httpStatus, exception := corporateTenantFilter(c, c.QueryParam("corporateId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	corporate, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), corporateID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	sme, err := h.repository.FindSMEByID(c.Request().Context(), c.QueryParam("smeId"))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("SME %s not found", c.QueryParam("smeId"))})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	linked := false
+	for _, link := range sme.LinkedWiths {
+		if link.CorporateID != nil && *link.CorporateID == *corporate.ID {
+			linked = true
+		}
+	}
+	notLinked := response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("SME %s is not linked with corporate %s", sme.ID.Hex(), corporate.ID.Hex())}
+	if !linked {
+		return c.JSON(http.StatusNotFound, notLinked)
+	}
+
+	// another request may have unlinked it in the meantime
+	result, err := h.repository.UnlinkSMECorporate(c.Request().Context(), sme.ID, corporate.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if result.ModifiedCount == 0 {
+		return c.JSON(http.StatusNotFound, notLinked)
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ValidateCorporate :
+func ValidateCorporate(h Handler, ctx context.Context, corporateID string) (*entity.Corporate, int, *response.Exception) {
+	// check if corporate exists
+	corporate, err := h.repository.FindCorporateByID(ctx, corporateID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.Corporate{}, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("corporate %s not found", corporateID)}
+		}
+		return &entity.Corporate{}, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if corporate.Status != entity.StatusActive {
+		return &entity.Corporate{}, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("corporate %s status inactive", corporateID)}
+	}
+	return corporate, http.StatusOK, nil
+}
+
+// validateSubscriber : a subscription belongs to a corporate or, for the plans of SMEs, to an SME
+func validateSubscriber(h Handler, ctx context.Context, companyID string) (*primitive.ObjectID, int, *response.Exception) {
+	corporate, httpStatus, exception := ValidateCorporate(h, ctx, companyID)
+	if exception == nil {
+		return corporate.ID, http.StatusOK, nil
+	}
+	if httpStatus != http.StatusNotFound {
+		return nil, httpStatus, exception
+	}
+
+	sme, httpStatus, exception := ValidateSME(h, ctx, companyID)
+	if exception != nil {
+		if httpStatus == http.StatusNotFound {
+			return nil, httpStatus, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("corporate or SME %s not found", companyID)}
+		}
+		return nil, httpStatus, exception
+	}
+	return sme.ID, http.StatusOK, nil
+}
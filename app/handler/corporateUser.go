@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/env"
+	"csi-api/app/kit/general"
+	"csi-api/app/kit/password"
+	"csi-api/app/kit/random"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetCorporateUserByToken :
+func (h Handler) GetCorporateUserByToken(c echo.Context) error {
+	corporateUserData := c.Get("CORPORATE_USER")
+	if corporateUserData == nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("not a corporate user")})
+	}
+	return c.JSON(http.StatusOK, response.Item{Item: corporateUserData.(entity.CorporateUser)})
+}
+
+// GetCorporateUsers :
+func (h Handler) GetCorporateUsers(c echo.Context) error {
+	companyID, httpStatus, exception := corporateTenantFilter(c, c.QueryParam("companyId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	users, cursor, err := h.repository.FindCorporateUsers(c.Request().Context(), repository.FindCorporateUserFilter{
+		Cursor:    c.QueryParam("cursor"),
+		IDs:       c.Request().URL.Query()["id"],
+		Emails:    c.Request().URL.Query()["email"],
+		FirstName: c.QueryParam("firstName"),
+		LastName:  c.QueryParam("lastName"),
+		CompanyID: companyID,
+		Role:      entity.UserRole(c.QueryParam("role")),
+		Status:    entity.UserStatus(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: users, Cursor: cursor, Count: len(users)})
+}
+
+// CreateCorporateUser : admins add users to any corporate, corporate admins to their own
+func (h Handler) CreateCorporateUser(c echo.Context) error {
+	var i struct {
+		CompanyID     string          `json:"companyId" form:"companyId" validate:"required,max=50"`
+		FirstName     string          `json:"firstName" form:"firstName" validate:"required,max=50"`
+		LastName      string          `json:"lastName" form:"lastName" validate:"required,max=50"`
+		Title         string          `json:"title" form:"title" validate:"required"`
+		Position      string          `json:"position" form:"position" validate:"required"`
+		Email         string          `json:"email" form:"email" validate:"required,email,min=10,max=100"`
+		Contact       string          `json:"contact" form:"contact"`
+		MobileContact string          `json:"mobileContact" form:"mobileContact"`
+		Password      string          `json:"password" form:"password" validate:"required,min=6,max=20"`
+		Role          entity.UserRole `json:"role" form:"role" validate:"required,eq=ADMIN|eq=USER"`
+		Status        string          `json:"status" form:"status" validate:"required,eq=ACTIVE|eq=INACTIVE"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// cleanup
+	i.Email = strings.ToLower(strings.TrimSpace(i.Email))
+	i.Password = strings.TrimSpace(i.Password)
+	i.CompanyID = strings.TrimSpace(i.CompanyID)
+	i.Contact = strings.TrimSpace(i.Contact)
+	i.MobileContact = strings.TrimSpace(i.MobileContact)
+
+	// corporate admins add users to their own corporate
+	companyID, httpStatus, exception := corporateTenantFilter(c, i.CompanyID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	i.CompanyID = companyID
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	corporate, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), i.CompanyID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// check if user exists
+	if _, err := h.repository.FindCorporateUserByEmail(c.Request().Context(), i.Email); err == nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EmailFound, Error: fmt.Errorf("corporate user %s already exists", i.Email)})
+	} else if err != mongo.ErrNoDocuments {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	// create password hash and salt
+	salt := random.Strings(10)
+	passwordHash, err := password.Create(i.Password, salt, env.Config.Jwt.Secret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	userID := primitive.NewObjectID()
+	user := entity.CorporateUser{
+		ID:            &userID,
+		CompanyID:     corporate.ID,
+		FirstName:     i.FirstName,
+		LastName:      i.LastName,
+		Title:         entity.UserTitle(i.Title),
+		Email:         i.Email,
+		Contact:       i.Contact,
+		MobileContact: i.MobileContact,
+		Position:      i.Position,
+		PasswordHash:  passwordHash,
+		PasswordSalt:  salt,
+		Role:          i.Role,
+		Status:        entity.UserStatus(i.Status),
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+
+	// check if profile picture is uploaded
+	if profilePicture, _ := c.FormFile("profilePicture"); profilePicture != nil {
+		path := fmt.Sprintf("corporateUser/%s/profile/", corporate.ID.Hex())
+		if exception := general.ReadFile(profilePicture, path); exception != nil {
+			return c.JSON(http.StatusInternalServerError, exception)
+		}
+		user.ProfilePicture = path + profilePicture.Filename
+	}
+
+	if _, err := h.repository.CreateCorporateUser(c.Request().Context(), user); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: user})
+}
+
+// UpdateCorporateUser : corporate users update their own profile, corporate admins every user of their corporate.
+// Only admins and corporate admins change roles and status.
+func (h Handler) UpdateCorporateUser(c echo.Context) error {
+	userID := c.QueryParam("id")
+	var i struct {
+		FirstName     string            `json:"firstName" form:"firstName" validate:"max=50"`
+		LastName      string            `json:"lastName" form:"lastName" validate:"max=50"`
+		Title         string            `json:"title" form:"title"`
+		Position      string            `json:"position" form:"position"`
+		Email         string            `json:"email" form:"email" validate:"omitempty,email,max=100"`
+		Contact       string            `json:"contact" form:"contact"`
+		MobileContact string            `json:"mobileContact" form:"mobileContact"`
+		Password      string            `json:"password" form:"password" validate:"max=20"`
+		Role          entity.UserRole   `json:"role" form:"role" validate:"omitempty,eq=ADMIN|eq=USER"`
+		Status        entity.UserStatus `json:"status" form:"status" validate:"omitempty,eq=ACTIVE|eq=INACTIVE|eq=SUSPENDED"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	// check if corporate user exists
+	user, err := h.repository.FindCorporateUserByID(c.Request().Context(), userID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("corporate user %s not found", userID)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if httpStatus, exception := checkCorporateTenant(c, user.CompanyID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// corporate users who are not corporate admins only reach themselves
+	manager := c.Get("role") != "corporateUser"
+	if current := c.Get("CORPORATE_USER"); !manager && current.(entity.CorporateUser).ID.Hex() != user.ID.Hex() {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("corporate users can only update their own profile")})
+	}
+	if !manager && (i.Role != "" || i.Status != "") {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only corporate admins can change roles and status")})
+	}
+
+	if i.FirstName != "" {
+		user.FirstName = i.FirstName
+	}
+
+	if i.LastName != "" {
+		user.LastName = i.LastName
+	}
+
+	if i.Email != "" {
+		email := strings.ToLower(strings.TrimSpace(i.Email))
+		if email != user.Email {
+			if _, err := h.repository.FindCorporateUserByEmail(c.Request().Context(), email); err == nil {
+				return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EmailFound, Error: fmt.Errorf("corporate user %s already exists", email)})
+			} else if err != mongo.ErrNoDocuments {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+			user.Email = email
+		}
+	}
+
+	if i.Password != "" {
+		// create password hash and salt
+		salt := random.Strings(10)
+		passwordHash, err := password.Create(strings.TrimSpace(i.Password), salt, env.Config.Jwt.Secret)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		user.PasswordHash = passwordHash
+		user.PasswordSalt = salt
+	}
+
+	if i.Title != "" {
+		user.Title = entity.UserTitle(i.Title)
+	}
+
+	if i.Position != "" {
+		user.Position = i.Position
+	}
+
+	if i.Contact != "" {
+		user.Contact = strings.TrimSpace(i.Contact)
+	}
+
+	if i.MobileContact != "" {
+		user.MobileContact = strings.TrimSpace(i.MobileContact)
+	}
+
+	if i.Role != "" {
+		user.Role = i.Role
+	}
+
+	if i.Status != "" {
+		user.Status = i.Status
+	}
+
+	// check if profile picture is uploaded
+	if profilePicture, _ := c.FormFile("profilePicture"); profilePicture != nil {
+		path := fmt.Sprintf("corporateUser/%s/profile/", user.CompanyID.Hex())
+		if exception := general.ReadFile(profilePicture, path); exception != nil {
+			return c.JSON(http.StatusInternalServerError, exception)
+		}
+		user.ProfilePicture = path + profilePicture.Filename
+	}
+
+	user.Model.UpdatedAt = time.Now().UTC()
+
+	if _, err := h.repository.UpsertCorporateUser(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{
+			Code:  errcode.ServerError,
+			Error: err,
+		})
+	}
+
+	// a deactivated user is logged out everywhere
+	if user.Status != entity.UserStatusActive {
+		if _, err := h.repository.RevokeSessions(c.Request().Context(), user.ID, nil, nil); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: user})
+}
+
+// CorporateUserLogin :
+func (h Handler) CorporateUserLogin(c echo.Context) error {
+	var i struct {
+		Email    string `json:"email" form:"email" validate:"required,email,min=10,max=100"`
+		Password string `json:"password" form:"password" validate:"required,min=6,max=20"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// cleanup
+	i.Email = strings.ToLower(strings.TrimSpace(i.Email))
+	i.Password = strings.TrimSpace(i.Password)
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	if httpStatus, exception := checkLogin(c, h, entity.AccountTypeCorporateUser, i.Email); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// check if user exists
+	user, err := h.repository.FindCorporateUserByEmail(c.Request().Context(), i.Email)
+	if err != nil {
+		if err := loginFailed(c, h, entity.AccountTypeCorporateUser, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.UserNotFound, Error: err})
+	}
+
+	if user.Status != entity.UserStatusActive {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("corporate user %s status inactive", i.Email)})
+	}
+
+	if _, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), user.CompanyID.Hex()); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// compare password & return error if password is not same
+	if isSame := password.Compare(i.Password, user.PasswordSalt, env.Config.Jwt.Secret, user.PasswordHash); !isSame {
+		if err := loginFailed(c, h, entity.AccountTypeCorporateUser, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.AuthenticationError})
+	}
+
+	if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeCorporateUser, i.Email); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	user.LastLoginAt = time.Now().UTC()
+	if _, err := h.repository.UpsertCorporateUser(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	// generate token pair
+	tokens, err := issueTokens(c, h, user.ID, nil, nil, map[string]string{
+		"sub":    user.ID.Hex(),
+		"aud":    user.ID.Hex(),
+		"scopes": fmt.Sprintf("%v", user.Role),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: tokens})
+}
+
+// ValidateCorporateUser : active corporate user of an active corporate
+func ValidateCorporateUser(h Handler, ctx context.Context, ID string) (*entity.CorporateUser, int, *response.Exception) {
+	// check if corporate user exists
+	user, err := h.repository.FindCorporateUserByID(ctx, ID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.CorporateUser{}, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("corporate user %s not found", ID)}
+		}
+		return &entity.CorporateUser{}, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if user.Status != entity.UserStatusActive {
+		return &entity.CorporateUser{}, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("corporate user %s status inactive", ID)}
+	}
+
+	if _, httpStatus, exception := ValidateCorporate(h, ctx, user.CompanyID.Hex()); exception != nil {
+		return &entity.CorporateUser{}, httpStatus, exception
+	}
+	return user, http.StatusOK, nil
+}
@@ -0,0 +1,545 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/kit/emission"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetEmissionFactorTables :
+func (h Handler) GetEmissionFactorTables(c echo.Context) error {
+	tables, cursor, err := h.repository.FindEmissionFactorTables(c.Request().Context(), repository.FindEmissionFactorTableFilter{
+		Cursor: c.QueryParam("cursor"),
+		IDs:    c.Request().URL.Query()["id"],
+		State:  entity.EmissionFactorTableState(c.QueryParam("state")),
+		Status: entity.Status(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: tables, Cursor: cursor, Count: len(tables)})
+}
+
+// CreateEmissionFactorTable : create a draft version, factors are copied from sourceId or the defaults when not given
+func (h Handler) CreateEmissionFactorTable(c echo.Context) error {
+	var i struct {
+		Label    string                  `json:"label" form:"label" validate:"required"`
+		SourceID string                  `json:"sourceId" form:"sourceId" validate:"max=50"`
+		Factors  []entity.EmissionFactor `json:"factors" form:"factors" validate:"dive"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// clean up
+	i.Label = strings.TrimSpace(i.Label)
+	i.SourceID = strings.TrimSpace(i.SourceID)
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	factors := i.Factors
+	if len(factors) == 0 {
+		if i.SourceID != "" {
+			source, httpStatus, exception := ValidateEmissionFactorTable(h, c.Request().Context(), i.SourceID)
+			if exception != nil {
+				return c.JSON(httpStatus, exception)
+			}
+			factors = source.Factors
+		} else {
+			factors = emission.DefaultFactors()
+		}
+	}
+	if err := emission.ValidateFactors(factors); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	tables, err := findAllEmissionFactorTables(c.Request().Context(), h, repository.FindEmissionFactorTableFilter{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	version := 1
+	for _, t := range tables {
+		if t.Version >= version {
+			version = t.Version + 1
+		}
+	}
+
+	timeNow := time.Now().UTC()
+	tableID := primitive.NewObjectID()
+	table := entity.EmissionFactorTable{
+		ID:      &tableID,
+		Version: version,
+		Label:   i.Label,
+		Factors: factors,
+		State:   entity.EmissionFactorTableStateDraft,
+		Status:  entity.StatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+
+	if _, err := h.repository.CreateEmissionFactorTable(c.Request().Context(), table); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: table})
+}
+
+// UpdateEmissionFactorTable : only draft versions can be changed
+func (h Handler) UpdateEmissionFactorTable(c echo.Context) error {
+	tableId := c.QueryParam("id")
+	var i struct {
+		Label   string                  `json:"label" form:"label"`
+		Factors []entity.EmissionFactor `json:"factors" form:"factors" validate:"dive"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	table, httpStatus, exception := ValidateDraftEmissionFactorTable(h, c.Request().Context(), tableId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if strings.TrimSpace(i.Label) != "" {
+		table.Label = strings.TrimSpace(i.Label)
+	}
+
+	if len(i.Factors) > 0 {
+		if err := emission.ValidateFactors(i.Factors); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+		}
+		table.Factors = i.Factors
+	}
+
+	table.Model.UpdatedAt = time.Now().UTC()
+
+	if _, err := h.repository.UpsertEmissionFactorTable(table); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: table})
+}
+
+// DeleteEmissionFactorTable :
+func (h Handler) DeleteEmissionFactorTable(c echo.Context) error {
+	tableId := c.QueryParam("id")
+
+	table, httpStatus, exception := ValidateDraftEmissionFactorTable(h, c.Request().Context(), tableId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, err := h.repository.DeleteEmissionFactorTableByID(table); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// PublishEmissionFactorTable : make the version available for calculation
+func (h Handler) PublishEmissionFactorTable(c echo.Context) error {
+	tableId := c.QueryParam("id")
+
+	table, httpStatus, exception := ValidateDraftEmissionFactorTable(h, c.Request().Context(), tableId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if len(table.Factors) == 0 {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EmissionFactorMissing, Error: fmt.Errorf("emission factor table %s has no factor", tableId)})
+	}
+
+	timeNow := time.Now().UTC()
+	table.State = entity.EmissionFactorTableStatePublished
+	table.PublishedAt = timeNow
+	if adminData := c.Get("ADMIN"); adminData != nil {
+		table.PublishedBy = adminData.(entity.Admin).ID
+	}
+	table.Model.UpdatedAt = timeNow
+
+	if _, err := h.repository.UpsertEmissionFactorTable(table); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: table})
+}
+
+// RetireEmissionFactorTable : stop a published version from being used in new calculation
+func (h Handler) RetireEmissionFactorTable(c echo.Context) error {
+	tableId := c.QueryParam("id")
+
+	table, httpStatus, exception := ValidateEmissionFactorTable(h, c.Request().Context(), tableId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if table.State != entity.EmissionFactorTableStatePublished {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EmissionTableNotPublished, Error: fmt.Errorf("emission factor table %s is not published", tableId)})
+	}
+
+	timeNow := time.Now().UTC()
+	table.State = entity.EmissionFactorTableStateRetired
+	table.RetiredAt = timeNow
+	table.Model.UpdatedAt = timeNow
+
+	if _, err := h.repository.UpsertEmissionFactorTable(table); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: table})
+}
+
+// GetEmissions :
+func (h Handler) GetEmissions(c echo.Context) error {
+	// sme users can only view their own emissions
+	smeID, httpStatus, exception := tenantFilter(c, c.QueryParam("smeId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	inventories, cursor, err := h.repository.FindEmissionInventories(c.Request().Context(), repository.FindEmissionInventoryFilter{
+		Cursor: c.QueryParam("cursor"),
+		IDs:    c.Request().URL.Query()["id"],
+		SMEID:  smeID,
+		Status: entity.Status(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: inventories, Cursor: cursor, Count: len(inventories)})
+}
+
+// CreateEmission : record activity data of a reporting period and calculate its emissions
+func (h Handler) CreateEmission(c echo.Context) error {
+	var i struct {
+		SMEID       string                    `json:"smeId" form:"smeId" validate:"max=50"`
+		PeriodStart time.Time                 `json:"periodStart" form:"periodStart" validate:"required"`
+		PeriodEnd   time.Time                 `json:"periodEnd" form:"periodEnd" validate:"required,gtfield=PeriodStart"`
+		Activities  []entity.EmissionActivity `json:"activities" form:"activities" validate:"gt=0,dive"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// sme users can only record their own emissions
+	smeID, httpStatus, exception := tenantFilter(c, i.SMEID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	i.SMEID = smeID
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), i.SMEID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if httpStatus, exception := validateEmissionPeriod(c.Request().Context(), h, sme.ID.Hex(), "", i.PeriodStart, i.PeriodEnd); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	inventoryID := primitive.NewObjectID()
+	inventory := &entity.EmissionInventory{
+		ID:          &inventoryID,
+		SMEID:       sme.ID,
+		PeriodStart: i.PeriodStart.UTC(),
+		PeriodEnd:   i.PeriodEnd.UTC(),
+		Activities:  i.Activities,
+		Status:      entity.StatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+
+	if httpStatus, exception := calculateEmission(c.Request().Context(), h, inventory, sme); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, err := h.repository.CreateEmissionInventory(c.Request().Context(), *inventory); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: inventory})
+}
+
+// UpdateEmission : replace the activity data or period. The inventory keeps the factor table it was calculated with
+// unless its activities change or recalculate is set, then the latest published factors are used.
+func (h Handler) UpdateEmission(c echo.Context) error {
+	inventoryId := c.QueryParam("id")
+	var i struct {
+		PeriodStart time.Time                 `json:"periodStart" form:"periodStart"`
+		PeriodEnd   time.Time                 `json:"periodEnd" form:"periodEnd"`
+		Activities  []entity.EmissionActivity `json:"activities" form:"activities" validate:"dive"`
+		Recalculate bool                      `json:"recalculate" form:"recalculate"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	inventory, httpStatus, exception := ValidateEmissionInventory(h, c.Request().Context(), inventoryId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if httpStatus, exception := checkTenant(c, inventory.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if !i.PeriodStart.IsZero() {
+		inventory.PeriodStart = i.PeriodStart.UTC()
+	}
+
+	if !i.PeriodEnd.IsZero() {
+		inventory.PeriodEnd = i.PeriodEnd.UTC()
+	}
+
+	if !inventory.PeriodEnd.After(inventory.PeriodStart) {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("periodEnd must be after periodStart")})
+	}
+
+	if httpStatus, exception := validateEmissionPeriod(c.Request().Context(), h, inventory.SMEID.Hex(), inventory.ID.Hex(), inventory.PeriodStart, inventory.PeriodEnd); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if len(i.Activities) > 0 {
+		inventory.Activities = i.Activities
+	}
+
+	if len(i.Activities) > 0 || i.Recalculate {
+		sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), inventory.SMEID.Hex())
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+
+		if httpStatus, exception := calculateEmission(c.Request().Context(), h, inventory, sme); exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+	}
+
+	inventory.Model.UpdatedAt = time.Now().UTC()
+
+	if _, err := h.repository.UpsertEmissionInventory(inventory); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: inventory})
+}
+
+// DeleteEmission :
+func (h Handler) DeleteEmission(c echo.Context) error {
+	inventoryId := c.QueryParam("id")
+
+	inventory, httpStatus, exception := ValidateEmissionInventory(h, c.Request().Context(), inventoryId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if httpStatus, exception := checkTenant(c, inventory.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, err := h.repository.DeleteEmissionInventoryByID(inventory); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ValidateEmissionFactorTable :
+func ValidateEmissionFactorTable(h Handler, ctx context.Context, id string) (*entity.EmissionFactorTable, int, *response.Exception) {
+	table, err := h.repository.FindEmissionFactorTableByID(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.EmissionFactorTable{}, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("emission factor table %s not found", id)}
+		}
+		return &entity.EmissionFactorTable{}, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if table.Status != entity.StatusActive {
+		return &entity.EmissionFactorTable{}, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("emission factor table %s status inactive", id)}
+	}
+
+	return table, http.StatusOK, nil
+}
+
+// ValidateDraftEmissionFactorTable : emission factor table must exist and still be editable
+func ValidateDraftEmissionFactorTable(h Handler, ctx context.Context, id string) (*entity.EmissionFactorTable, int, *response.Exception) {
+	table, httpStatus, exception := ValidateEmissionFactorTable(h, ctx, id)
+	if exception != nil {
+		return table, httpStatus, exception
+	}
+
+	if table.State != entity.EmissionFactorTableStateDraft {
+		return &entity.EmissionFactorTable{}, http.StatusBadRequest, &response.Exception{Code: errcode.EmissionTableNotDraft, Error: fmt.Errorf("emission factor table %s is not a draft", id)}
+	}
+
+	return table, http.StatusOK, nil
+}
+
+// ValidateEmissionInventory :
+func ValidateEmissionInventory(h Handler, ctx context.Context, id string) (*entity.EmissionInventory, int, *response.Exception) {
+	inventory, err := h.repository.FindEmissionInventoryByID(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.EmissionInventory{}, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("emission %s not found", id)}
+		}
+		return &entity.EmissionInventory{}, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if inventory.Status != entity.StatusActive {
+		return &entity.EmissionInventory{}, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("emission %s status inactive", id)}
+	}
+
+	return inventory, http.StatusOK, nil
+}
+
+// calculateEmission : calculate the inventory with the latest published emission factor table
+func calculateEmission(c context.Context, h Handler, inventory *entity.EmissionInventory, sme *entity.SME) (int, *response.Exception) {
+	tables, err := findAllEmissionFactorTables(c, h, repository.FindEmissionFactorTableFilter{
+		State:  entity.EmissionFactorTableStatePublished,
+		Status: entity.StatusActive,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	var table *entity.EmissionFactorTable
+	for _, t := range tables {
+		if table == nil || t.Version > table.Version {
+			table = t
+		}
+	}
+	if table == nil {
+		return http.StatusBadRequest, &response.Exception{Code: errcode.EmissionFactorMissing, Error: fmt.Errorf("no published emission factor table")}
+	}
+
+	result, err := emission.Calculate(inventory.Activities, table, sme)
+	if err != nil {
+		return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.EmissionFactorMissing, Error: err}
+	}
+
+	inventory.FactorTableID = table.ID
+	inventory.FactorVersion = table.Version
+	inventory.Result = result
+	inventory.CalculatedAt = time.Now().UTC()
+	return http.StatusOK, nil
+}
+
+// validateEmissionPeriod : reporting periods of an SME must not overlap
+func validateEmissionPeriod(c context.Context, h Handler, smeID, excludeID string, start, end time.Time) (int, *response.Exception) {
+	inventories, err := findAllEmissionInventories(c, h, repository.FindEmissionInventoryFilter{
+		SMEID:  smeID,
+		Status: entity.StatusActive,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	for _, inventory := range inventories {
+		if inventory.ID.Hex() == excludeID {
+			continue
+		}
+		if start.Before(inventory.PeriodEnd) && inventory.PeriodStart.Before(end) {
+			return http.StatusBadRequest, &response.Exception{Code: errcode.RecordFound, Error: fmt.Errorf("period overlaps emission %s", inventory.ID.Hex())}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// latestEmission : the emission of the SME covering the date, or the latest one before it
+func latestEmission(c context.Context, h Handler, smeID string, date time.Time) (*entity.EmissionInventory, error) {
+	inventories, err := findAllEmissionInventories(c, h, repository.FindEmissionInventoryFilter{
+		SMEID:  smeID,
+		Status: entity.StatusActive,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *entity.EmissionInventory
+	for _, inventory := range inventories {
+		if inventory.PeriodStart.After(date) {
+			continue
+		}
+		if latest == nil || inventory.PeriodEnd.After(latest.PeriodEnd) {
+			latest = inventory
+		}
+	}
+	return latest, nil
+}
+
+func findAllEmissionFactorTables(c context.Context, h Handler, filter repository.FindEmissionFactorTableFilter) ([]*entity.EmissionFactorTable, error) {
+	var tables []*entity.EmissionFactorTable
+	for {
+		result, nextCursor, err := h.repository.FindEmissionFactorTables(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return tables, nil
+}
+
+func findAllEmissionInventories(c context.Context, h Handler, filter repository.FindEmissionInventoryFilter) ([]*entity.EmissionInventory, error) {
+	var inventories []*entity.EmissionInventory
+	for {
+		result, nextCursor, err := h.repository.FindEmissionInventories(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		inventories = append(inventories, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return inventories, nil
+}
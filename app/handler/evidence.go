@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/kit/general"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UploadEvidences : attach one or more evidence files to an assessment entry
+func (h Handler) UploadEvidences(c echo.Context) error {
+	assessmentEntryId := c.QueryParam("assessmentEntryId")
+
+	entry, err := h.repository.FindAssessmentEntryByID(c.Request().Context(), assessmentEntryId)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("assessment entry %s not found", assessmentEntryId)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if httpStatus, exception := checkTenant(c, entry.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// evidence backs the answer, it cannot change once the entry is in review
+	if !entryEditable(entry) {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("assessment entry %s is locked for review", assessmentEntryId)})
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+	files := form.File["files"]
+	if len(files) == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("files is required")})
+	}
+
+	// every file is checked before any is stored, a rejected file leaves nothing behind
+	for _, file := range files {
+		if _, err := general.CheckFile(file); err != nil {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidFile, Error: fmt.Errorf("%s: %v", file.Filename, err)})
+		}
+	}
+
+	uploadedBy, role := evidenceUploader(c)
+	timeNow := time.Now().UTC()
+	path := fmt.Sprintf("esg/%s/evidence/%s/", entry.SMEID.Hex(), entry.ID.Hex())
+
+	evidences := make([]*entity.Evidence, 0, len(files))
+	for _, file := range files {
+		// files are stored by id so uploads with the same name never overwrite each other
+		evidenceID := primitive.NewObjectID()
+		filename := evidenceID.Hex() + strings.ToLower(filepath.Ext(file.Filename))
+
+		stored, err := general.StoreFile(file, path, filename)
+		if err != nil {
+			discardEvidences(h, evidences)
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidFile, Error: fmt.Errorf("%s: %v", file.Filename, err)})
+		}
+
+		evidence := &entity.Evidence{
+			ID:                &evidenceID,
+			AssessmentID:      entry.AssessmentID,
+			AssessmentEntryID: entry.ID,
+			SMEID:             entry.SMEID,
+			QuestionID:        entry.QuestionID,
+			FileName:          filepath.Base(file.Filename),
+			Path:              path + filename,
+			ContentType:       stored.ContentType,
+			Size:              stored.Size,
+			SHA256:            stored.SHA256,
+			UploadedBy:        uploadedBy,
+			UploadedByRole:    role,
+			UploadedAt:        timeNow,
+			Status:            entity.StatusActive,
+			Model: entity.Model{
+				CreatedAt: timeNow,
+				UpdatedAt: timeNow,
+			},
+		}
+
+		if _, err := h.repository.CreateEvidence(c.Request().Context(), *evidence); err != nil {
+			if err := general.RemoveFile(general.StoragePath(evidence.Path)); err != nil {
+				log.Printf("evidence file %s of a failed upload not removed: %v", evidence.Path, err)
+			}
+			discardEvidences(h, evidences)
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		evidences = append(evidences, evidence)
+	}
+
+	// the evidence is the answer of an upload question
+	if entry.QuestionType == entity.QuestionTypeUpload {
+		for _, evidence := range evidences {
+			entry.Answer.Text = append(entry.Answer.Text, evidence.Path)
+		}
+		entry.RespondStatus = entity.ResponseStatusInProgress
+		entry.SubmittedDateTime = timeNow
+		if _, err := h.repository.BulkWriteAssessmentEntries(c.Request().Context(), []*entity.AssessmentEntry{entry}); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: evidences, Count: len(evidences)})
+}
+
+// GetEvidences : list evidence of an assessment or one of its entries
+func (h Handler) GetEvidences(c echo.Context) error {
+	// sme users can only see their own evidence
+	smeID, httpStatus, exception := tenantFilter(c, c.QueryParam("smeId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	evidences, cursor, err := h.repository.FindEvidences(c.Request().Context(), repository.FindEvidenceFilter{
+		Cursor:            c.QueryParam("cursor"),
+		IDs:               c.Request().URL.Query()["id"],
+		AssessmentID:      c.QueryParam("assessmentId"),
+		AssessmentEntryID: c.QueryParam("assessmentEntryId"),
+		SMEID:             smeID,
+		Status:            entity.Status(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: evidences, Cursor: cursor, Count: len(evidences)})
+}
+
+// DownloadEvidence :
+func (h Handler) DownloadEvidence(c echo.Context) error {
+	evidence, httpStatus, exception := ValidateEvidence(h, c.Request().Context(), c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if httpStatus, exception := checkTenant(c, evidence.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	return c.Attachment(general.StoragePath(evidence.Path), evidence.FileName)
+}
+
+// DeleteEvidence : remove evidence from an entry which is still editable
+func (h Handler) DeleteEvidence(c echo.Context) error {
+	evidence, httpStatus, exception := ValidateEvidence(h, c.Request().Context(), c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if httpStatus, exception := checkTenant(c, evidence.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	entry, err := h.repository.FindAssessmentEntryByID(c.Request().Context(), evidence.AssessmentEntryID.Hex())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if !entryEditable(entry) {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("assessment entry %s is locked for review", entry.ID.Hex())})
+	}
+
+	if _, err := h.repository.DeleteEvidenceByID(evidence); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if entry.QuestionType == entity.QuestionTypeUpload {
+		text := make([]string, 0, len(entry.Answer.Text))
+		for _, t := range entry.Answer.Text {
+			if t != evidence.Path {
+				text = append(text, t)
+			}
+		}
+		entry.Answer.Text = text
+		if _, err := h.repository.BulkWriteAssessmentEntries(c.Request().Context(), []*entity.AssessmentEntry{entry}); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ValidateEvidence :
+func ValidateEvidence(h Handler, ctx context.Context, id string) (*entity.Evidence, int, *response.Exception) {
+	evidence, err := h.repository.FindEvidenceByID(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.Evidence{}, http.StatusNotFound, &response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("evidence %s not found", id)}
+		}
+		return &entity.Evidence{}, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if evidence.Status != entity.StatusActive {
+		return &entity.Evidence{}, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("evidence %s status inactive", id)}
+	}
+	return evidence, http.StatusOK, nil
+}
+
+// evidenceUploader : id and role of the current user
+func evidenceUploader(c echo.Context) (*primitive.ObjectID, string) {
+	role := fmt.Sprintf("%v", c.Get("role"))
+	if smeUserData := c.Get("SME_ADMIN"); smeUserData != nil {
+		return smeUserData.(entity.SMEUser).ID, role
+	}
+	if adminData := c.Get("ADMIN"); adminData != nil {
+		return adminData.(entity.Admin).ID, role
+	}
+	return nil, role
+}
+
+// discardEvidences : remove the files and records of an upload which failed partway. The upload already failed, so a
+// failed removal is only logged.
+func discardEvidences(h Handler, evidences []*entity.Evidence) {
+	for _, evidence := range evidences {
+		if err := general.RemoveFile(general.StoragePath(evidence.Path)); err != nil {
+			log.Printf("evidence file %s of a failed upload not removed: %v", evidence.Path, err)
+		}
+		if _, err := h.repository.DeleteEvidenceByID(evidence); err != nil {
+			log.Printf("evidence %s of a failed upload not deleted: %v", evidence.ID.Hex(), err)
+		}
+	}
+}
@@ -12,18 +12,21 @@ import (
 
 	"csi-api/app/bootstrap"
 
+	"github.com/casbin/casbin/v2"
 	"github.com/labstack/echo/v4"
 )
 
 // Handler :
 type Handler struct {
 	repository *repository.Repository
+	enforcer   *casbin.SyncedEnforcer
 }
 
 // New :
 func New(bs *bootstrap.Bootstrap) *Handler {
 	return &Handler{
 		repository: bs.Repository,
+		enforcer:   bs.Enforcer,
 	}
 }
 
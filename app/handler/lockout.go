@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	loginFailureWindow  = 30 * time.Minute // failures older than this are forgotten
+	loginDelayAfter     = 3                // failures of an account before each attempt has to wait
+	loginMaxDelaySecond = 60
+	accountLockAfter    = 10
+	ipLockAfter         = 50 // higher than an account, many users can share an office ip
+	loginLockDuration   = 15 * time.Minute
+)
+
+// GetLockouts : accounts and ip addresses which are locked now
+func (h Handler) GetLockouts(c echo.Context) error {
+	throttles, err := h.repository.FindLockedLoginThrottles(c.Request().Context(), time.Now().UTC())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: throttles, Count: len(throttles)})
+}
+
+// GetLockoutEvents :
+func (h Handler) GetLockoutEvents(c echo.Context) error {
+	events, cursor, err := h.repository.FindLockoutEvents(c.Request().Context(), repository.FindLockoutEventFilter{
+		Cursor: c.QueryParam("cursor"),
+		Key:    c.QueryParam("key"),
+		Type:   entity.LockoutEventType(c.QueryParam("type")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: events, Cursor: cursor, Count: len(events)})
+}
+
+// UnlockLogin : clear the failures and lock of an account (accountType and email) or an ip address
+func (h Handler) UnlockLogin(c echo.Context) error {
+	admin := c.Get("ADMIN").(entity.Admin)
+
+	var key string
+	kind := entity.LoginThrottleKindAccount
+	if ip := strings.TrimSpace(c.QueryParam("ip")); ip != "" {
+		key, kind = ipKey(ip), entity.LoginThrottleKindIP
+	} else {
+		accountType := entity.AccountType(c.QueryParam("accountType"))
+		if accountType != entity.AccountTypeAdmin && accountType != entity.AccountTypeSMEUser && accountType != entity.AccountTypeCorporateUser {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("accountType must be ADMIN, SME_USER or CORPORATE_USER")})
+		}
+		key = accountKey(accountType, c.QueryParam("email"))
+	}
+
+	throttle, err := h.repository.FindLoginThrottleByID(c.Request().Context(), key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("%s has no failed logins", key)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if _, err := h.repository.DeleteLoginThrottle(c.Request().Context(), key); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if err := recordLockoutEvent(c, h, entity.LockoutEventTypeUnlocked, kind, key, throttle.Failures, throttle.LockedUntil, admin.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// checkLogin : refuse a login attempt while the account or ip address is locked, or before the delay after the
+// last failure has passed
+func checkLogin(c echo.Context, h Handler, accountType entity.AccountType, email string) (int, *response.Exception) {
+	timeNow := time.Now().UTC()
+	for _, key := range []string{ipKey(c.RealIP()), accountKey(accountType, email)} {
+		throttle, err := h.repository.FindLoginThrottleByID(c.Request().Context(), key)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		}
+
+		if throttle.LockedUntil.After(timeNow) {
+			return http.StatusTooManyRequests, retryAfter(c, &response.Exception{Code: errcode.AccountLocked, Error: fmt.Errorf("too many failed logins, try again later")}, throttle.LockedUntil.Sub(timeNow))
+		}
+
+		if throttle.Kind == entity.LoginThrottleKindAccount && timeNow.Sub(throttle.LastFailureAt) < loginFailureWindow {
+			if wait := loginDelay(throttle.Failures) - timeNow.Sub(throttle.LastFailureAt); wait > 0 {
+				return http.StatusTooManyRequests, retryAfter(c, &response.Exception{Code: errcode.LoginThrottled, Error: fmt.Errorf("too many failed logins, wait before trying again")}, wait)
+			}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// loginFailed : count a failed attempt against the account and the ip address and lock them after too many
+func loginFailed(c echo.Context, h Handler, accountType entity.AccountType, email string) error {
+	timeNow := time.Now().UTC()
+	for _, t := range []struct {
+		key   string
+		kind  entity.LoginThrottleKind
+		limit int
+	}{
+		{accountKey(accountType, email), entity.LoginThrottleKindAccount, accountLockAfter},
+		{ipKey(c.RealIP()), entity.LoginThrottleKindIP, ipLockAfter},
+	} {
+		throttle, err := h.repository.AddLoginFailure(c.Request().Context(), t.key, t.kind, timeNow, timeNow.Add(-loginFailureWindow))
+		if err != nil {
+			return err
+		}
+
+		if throttle.Failures < t.limit || throttle.LockedUntil.After(timeNow) {
+			continue
+		}
+
+		lockedUntil := timeNow.Add(loginLockDuration)
+		if _, err := h.repository.LockLoginThrottle(c.Request().Context(), t.key, lockedUntil); err != nil {
+			return err
+		}
+		if err := recordLockoutEvent(c, h, entity.LockoutEventTypeLocked, t.kind, t.key, throttle.Failures, lockedUntil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loginSucceeded : forget the failures of the account, failures of the ip address expire on their own
+func loginSucceeded(ctx context.Context, h Handler, accountType entity.AccountType, email string) error {
+	_, err := h.repository.DeleteLoginThrottle(ctx, accountKey(accountType, email))
+	return err
+}
+
+// loginDelay : wait before the next attempt, doubling with each failure from loginDelayAfter
+func loginDelay(failures int) time.Duration {
+	if failures < loginDelayAfter {
+		return 0
+	}
+	seconds := math.Min(math.Pow(2, float64(failures-loginDelayAfter)), loginMaxDelaySecond)
+	return time.Duration(seconds) * time.Second
+}
+
+// recordLockoutEvent :
+func recordLockoutEvent(c echo.Context, h Handler, eventType entity.LockoutEventType, kind entity.LoginThrottleKind, key string, failures int, lockedUntil time.Time, by *primitive.ObjectID) error {
+	eventID := primitive.NewObjectID()
+	_, err := h.repository.CreateLockoutEvent(c.Request().Context(), entity.LockoutEvent{
+		ID:          &eventID,
+		Type:        eventType,
+		Kind:        kind,
+		Key:         key,
+		Failures:    failures,
+		LockedUntil: lockedUntil,
+		IPAddress:   c.RealIP(),
+		By:          by,
+		At:          time.Now().UTC(),
+	})
+	return err
+}
+
+// retryAfter : set the Retry-After header and tell the client how long to wait
+func retryAfter(c echo.Context, exception *response.Exception, wait time.Duration) *response.Exception {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+	exception.Details = map[string]int{"retryAfter": seconds}
+	return exception
+}
+
+// accountKey :
+func accountKey(accountType entity.AccountType, email string) string {
+	return fmt.Sprintf("%s:%s", accountType, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// ipKey :
+func ipKey(ip string) string {
+	return fmt.Sprintf("%s:%s", entity.LoginThrottleKindIP, ip)
+}
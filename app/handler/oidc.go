@@ -0,0 +1,670 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/constant"
+	"csi-api/app/entity"
+	"csi-api/app/kit/oidc"
+	"csi-api/app/kit/random"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const oidcLoginExpiresInMinute = 10
+
+// defaultOIDCScopes : scopes asked for when a provider has none configured
+var defaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// GetOIDCProviders : identity providers users can sign in with
+func (h Handler) GetOIDCProviders(c echo.Context) error {
+	if _, httpStatus, exception := superAdminOnly(c); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	providers, cursor, err := h.repository.FindOIDCProviders(c.Request().Context(), repository.FindOIDCProviderFilter{
+		Cursor:      c.QueryParam("cursor"),
+		AccountType: entity.AccountType(c.QueryParam("accountType")),
+		Status:      entity.Status(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: providers, Cursor: cursor, Count: len(providers)})
+}
+
+// GetOIDCLoginProviders : active identity providers shown on the login pages
+func (h Handler) GetOIDCLoginProviders(c echo.Context) error {
+	providers, cursor, err := h.repository.FindOIDCProviders(c.Request().Context(), repository.FindOIDCProviderFilter{
+		Cursor:      c.QueryParam("cursor"),
+		AccountType: entity.AccountType(c.QueryParam("accountType")),
+		Status:      entity.StatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	items := make([]map[string]interface{}, 0, len(providers))
+	for _, provider := range providers {
+		items = append(items, map[string]interface{}{
+			"id":          provider.ID,
+			"name":        provider.Name,
+			"accountType": provider.AccountType,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: items, Cursor: cursor, Count: len(items)})
+}
+
+// CreateOIDCProvider : register an identity provider, its discovery document must be reachable
+func (h Handler) CreateOIDCProvider(c echo.Context) error {
+	if _, httpStatus, exception := superAdminOnly(c); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	var i struct {
+		Name           string          `json:"name" form:"name" validate:"required,max=50"`
+		Issuer         string          `json:"issuer" form:"issuer" validate:"required,url,max=200"`
+		ClientID       string          `json:"clientId" form:"clientId" validate:"required,max=200"`
+		ClientSecret   string          `json:"clientSecret" form:"clientSecret" validate:"max=500"`
+		Scopes         []string        `json:"scopes" form:"scopes" validate:"dive,required,max=50"`
+		RedirectURIs   []string        `json:"redirectUris" form:"redirectUris" validate:"required,min=1,dive,url,max=200"`
+		AccountType    string          `json:"accountType" form:"accountType" validate:"required,eq=ADMIN|eq=SME_USER"`
+		CompanyID      string          `json:"companyId" form:"companyId" validate:"max=50"`
+		AllowedDomains []string        `json:"allowedDomains" form:"allowedDomains" validate:"dive,required,max=100"`
+		Provision      bool            `json:"provision" form:"provision"`
+		DefaultRole    entity.UserRole `json:"defaultRole" form:"defaultRole"`
+		DefaultScopes  []entity.Scope  `json:"defaultScopes" form:"defaultScopes" validate:"scope"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.Issuer = strings.TrimRight(strings.TrimSpace(i.Issuer), "/")
+	i.ClientID = strings.TrimSpace(i.ClientID)
+	i.CompanyID = strings.TrimSpace(i.CompanyID)
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	providerID := primitive.NewObjectID()
+	provider := entity.OIDCProvider{
+		ID:             &providerID,
+		Name:           i.Name,
+		Issuer:         i.Issuer,
+		ClientID:       i.ClientID,
+		ClientSecret:   i.ClientSecret,
+		Scopes:         i.Scopes,
+		RedirectURIs:   i.RedirectURIs,
+		AccountType:    entity.AccountType(i.AccountType),
+		AllowedDomains: lowerAll(i.AllowedDomains),
+		Provision:      i.Provision,
+		DefaultRole:    i.DefaultRole,
+		DefaultScopes:  i.DefaultScopes,
+		Status:         entity.StatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+	if len(provider.Scopes) == 0 {
+		provider.Scopes = defaultOIDCScopes
+	}
+	if i.CompanyID != "" {
+		companyID, err := primitive.ObjectIDFromHex(i.CompanyID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+		}
+		provider.CompanyID = &companyID
+	}
+
+	if httpStatus, exception := validateOIDCProvider(c, h, &provider); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, err := h.repository.CreateOIDCProvider(c.Request().Context(), provider); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: provider})
+}
+
+// UpdateOIDCProvider :
+func (h Handler) UpdateOIDCProvider(c echo.Context) error {
+	if _, httpStatus, exception := superAdminOnly(c); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	providerID := c.QueryParam("id")
+	var i struct {
+		Name           string          `json:"name" form:"name" validate:"max=50"`
+		Issuer         string          `json:"issuer" form:"issuer" validate:"omitempty,url,max=200"`
+		ClientID       string          `json:"clientId" form:"clientId" validate:"max=200"`
+		ClientSecret   string          `json:"clientSecret" form:"clientSecret" validate:"max=500"`
+		Scopes         []string        `json:"scopes" form:"scopes" validate:"dive,required,max=50"`
+		RedirectURIs   []string        `json:"redirectUris" form:"redirectUris" validate:"dive,url,max=200"`
+		CompanyID      string          `json:"companyId" form:"companyId" validate:"max=50"`
+		AllowedDomains []string        `json:"allowedDomains" form:"allowedDomains" validate:"dive,required,max=100"`
+		Provision      *bool           `json:"provision" form:"provision"`
+		DefaultRole    entity.UserRole `json:"defaultRole" form:"defaultRole"`
+		DefaultScopes  []entity.Scope  `json:"defaultScopes" form:"defaultScopes" validate:"scope"`
+		Status         entity.Status   `json:"status" form:"status" validate:"omitempty,eq=ACTIVE|eq=INACTIVE"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.Issuer = strings.TrimRight(strings.TrimSpace(i.Issuer), "/")
+	i.ClientID = strings.TrimSpace(i.ClientID)
+	i.CompanyID = strings.TrimSpace(i.CompanyID)
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	provider, err := h.repository.FindOIDCProviderByID(c.Request().Context(), providerID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.OAuthAppNotExist, Error: fmt.Errorf("identity provider %s not found", providerID)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if i.Name != "" {
+		provider.Name = i.Name
+	}
+	if i.Issuer != "" {
+		provider.Issuer = i.Issuer
+	}
+	if i.ClientID != "" {
+		provider.ClientID = i.ClientID
+	}
+	if i.ClientSecret != "" {
+		provider.ClientSecret = i.ClientSecret
+	}
+	if len(i.Scopes) > 0 {
+		provider.Scopes = i.Scopes
+	}
+	if len(i.RedirectURIs) > 0 {
+		provider.RedirectURIs = i.RedirectURIs
+	}
+	if i.CompanyID != "" {
+		companyID, err := primitive.ObjectIDFromHex(i.CompanyID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+		}
+		provider.CompanyID = &companyID
+	}
+	if i.AllowedDomains != nil {
+		provider.AllowedDomains = lowerAll(i.AllowedDomains)
+	}
+	if i.Provision != nil {
+		provider.Provision = *i.Provision
+	}
+	if i.DefaultRole != "" {
+		provider.DefaultRole = i.DefaultRole
+	}
+	if i.DefaultScopes != nil {
+		provider.DefaultScopes = i.DefaultScopes
+	}
+	if i.Status != "" {
+		provider.Status = i.Status
+	}
+
+	if httpStatus, exception := validateOIDCProvider(c, h, provider); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	provider.UpdatedAt = time.Now().UTC()
+	if _, err := h.repository.UpsertOIDCProvider(provider); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: provider})
+}
+
+// OIDCAuthorize : start an authorization code flow with PKCE, the client redirects the user to the returned url
+// and posts the state and code it gets back to the callback
+func (h Handler) OIDCAuthorize(c echo.Context) error {
+	var i struct {
+		ProviderID  string `json:"providerId" form:"providerId" validate:"required,max=50"`
+		RedirectURI string `json:"redirectUri" form:"redirectUri" validate:"required,url,max=200"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.RedirectURI = strings.TrimSpace(i.RedirectURI)
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	provider, httpStatus, exception := ValidateOIDCProvider(h, c.Request().Context(), i.ProviderID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// the code must only be sent back to a page of ours
+	if !random.Contains(provider.RedirectURIs, i.RedirectURI) {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: fmt.Errorf("redirect uri %s is not registered", i.RedirectURI)})
+	}
+
+	config, err := oidc.Discover(c.Request().Context(), provider.Issuer)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, response.Exception{Code: errcode.OAuthAppNotExist, Error: err})
+	}
+
+	state, err := oidc.State()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	nonce, err := oidc.State()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	verifier, challenge, err := oidc.PKCE()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	loginID := primitive.NewObjectID()
+	login := entity.OIDCLogin{
+		ID:           &loginID,
+		ProviderID:   provider.ID,
+		StateHash:    random.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURI:  i.RedirectURI,
+		IPAddress:    c.RealIP(),
+		ExpiresAt:    timeNow.Add(time.Minute * oidcLoginExpiresInMinute),
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+	if _, err := h.repository.CreateOIDCLogin(c.Request().Context(), login); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: map[string]interface{}{
+		"authorizationUrl": oidc.AuthorizationURL(config, provider.ClientID, i.RedirectURI, provider.Scopes, state, nonce, challenge),
+		"state":            state,
+		"expiresAt":        login.ExpiresAt,
+	}})
+}
+
+// OIDCCallback : finish the flow started by OIDCAuthorize. The account is found by the subject of the ID token,
+// then by its verified email, or created when the provider provisions accounts.
+func (h Handler) OIDCCallback(c echo.Context) error {
+	var i struct {
+		State string `json:"state" form:"state" validate:"required,max=100"`
+		Code  string `json:"code" form:"code" validate:"required,max=2000"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	// claim the state first so the code cannot be used twice
+	login, err := h.repository.UseOIDCLogin(c.Request().Context(), random.HashToken(strings.TrimSpace(i.State)))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidAuthCode, Error: fmt.Errorf("login expired or already used")})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	provider, httpStatus, exception := ValidateOIDCProvider(h, c.Request().Context(), login.ProviderID.Hex())
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	config, err := oidc.Discover(c.Request().Context(), provider.Issuer)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, response.Exception{Code: errcode.OAuthAppNotExist, Error: err})
+	}
+
+	tokens, err := oidc.Exchange(c.Request().Context(), config, provider.ClientID, provider.ClientSecret, login.RedirectURI, strings.TrimSpace(i.Code), login.CodeVerifier)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidAuthCode, Error: err})
+	}
+
+	claims, err := oidc.VerifyIDToken(c.Request().Context(), config, provider.ClientID, tokens.IDToken, login.Nonce)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.InvalidAuthCode, Error: err})
+	}
+
+	// accounts are only matched by an email the provider has verified
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" || !claims.EmailVerified {
+		return c.JSON(http.StatusUnauthorized, response.Exception{Code: errcode.EmailNotVerified, Error: fmt.Errorf("identity provider has not verified the email")})
+	}
+	// providers created before their accounts had to be limited sign nobody in
+	if !oidcProviderLimited(provider) {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("%s is not limited to a company or email domains", provider.Name)})
+	}
+	if !emailDomainAllowed(email, provider.AllowedDomains) {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("email domain of %s cannot sign in with %s", email, provider.Name)})
+	}
+
+	// an account locked out of the password login is locked out of its identity provider as well
+	if httpStatus, exception := checkLogin(c, h, provider.AccountType, email); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	identity, err := h.repository.FindOIDCIdentity(c.Request().Context(), provider.ID, claims.Subject)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	if identity == nil {
+		identityID := primitive.NewObjectID()
+		identity = &entity.OIDCIdentity{
+			ID:          &identityID,
+			ProviderID:  provider.ID,
+			Subject:     claims.Subject,
+			AccountType: provider.AccountType,
+			Model: entity.Model{
+				CreatedAt: timeNow,
+			},
+		}
+	}
+	identity.Email = email
+	identity.LastLoginAt = timeNow
+	identity.UpdatedAt = timeNow
+
+	switch provider.AccountType {
+	case entity.AccountTypeAdmin:
+		admin, httpStatus, exception := oidcAdmin(c, h, provider, identity, claims, email)
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+
+		identity.UserID = admin.ID
+		if _, err := h.repository.UpsertOIDCIdentity(identity); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		// the identity provider is the first factor, TOTP is still asked for
+		if twoFactorRequired(admin) {
+			return twoFactorChallenge(c, admin)
+		}
+
+		if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeAdmin, admin.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		tokens, err := issueTokens(c, h, admin.ID, nil, nil, adminTokenClaims(admin))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		return c.JSON(http.StatusOK, response.Item{Item: tokens})
+
+	default:
+		user, httpStatus, exception := oidcSMEUser(c, h, provider, identity, claims, email)
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+
+		identity.UserID = user.ID
+		if _, err := h.repository.UpsertOIDCIdentity(identity); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeSMEUser, user.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		tokens, err := issueTokens(c, h, user.ID, nil, nil, map[string]string{
+			"sub":    user.ID.Hex(),
+			"aud":    user.ID.Hex(),
+			"scopes": fmt.Sprintf("%v", user.Role),
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		return c.JSON(http.StatusOK, response.Item{Item: tokens})
+	}
+}
+
+// ValidateOIDCProvider :
+func ValidateOIDCProvider(h Handler, ctx context.Context, id string) (*entity.OIDCProvider, int, *response.Exception) {
+	provider, err := h.repository.FindOIDCProviderByID(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.OIDCProvider{}, http.StatusNotFound, &response.Exception{Code: errcode.OAuthAppNotExist, Error: fmt.Errorf("identity provider %s not found", id)}
+		}
+		return &entity.OIDCProvider{}, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if provider.Status != entity.StatusActive {
+		return &entity.OIDCProvider{}, http.StatusBadRequest, &response.Exception{Code: errcode.OAuthAppNotExist, Error: fmt.Errorf("identity provider %s status inactive", id)}
+	}
+	return provider, http.StatusOK, nil
+}
+
+// validateOIDCProvider : settings which depend on each other, and the discovery document of the issuer
+func validateOIDCProvider(c echo.Context, h Handler, provider *entity.OIDCProvider) (int, *response.Exception) {
+	if !random.Contains(provider.Scopes, "openid") {
+		return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("scopes must include openid")}
+	}
+	if !oidcProviderLimited(provider) {
+		if provider.AccountType == entity.AccountTypeAdmin {
+			return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("admin identity providers need allowed domains")}
+		}
+		return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("SME user identity providers need a company or allowed domains")}
+	}
+
+	if provider.Provision {
+		switch provider.AccountType {
+		case entity.AccountTypeAdmin:
+			// superAdmin is never given out by an identity provider
+			if !random.Contains([]entity.UserRole{entity.UserRoleUser, entity.UserRoleSMEVendor, entity.UserRoleCorporateVendor}, provider.DefaultRole) {
+				return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("default role of provisioned admins must be USER, SME_VENDOR or CORPORATE_VENDOR")}
+			}
+			if provider.DefaultRole == entity.UserRoleUser && len(provider.DefaultScopes) == 0 {
+				return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("provisioned admins need default scopes")}
+			}
+		case entity.AccountTypeSMEUser:
+			if provider.DefaultRole == "" {
+				provider.DefaultRole = entity.UserRoleUser
+			}
+			if !random.Contains(constant.UserRoles, provider.DefaultRole) || provider.DefaultRole == entity.UserRoleSMEVendor || provider.DefaultRole == entity.UserRoleCorporateVendor {
+				return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("default role of provisioned SME users must be ADMIN or USER")}
+			}
+			if provider.CompanyID == nil {
+				return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("provisioned SME users need a company")}
+			}
+			if _, httpStatus, exception := ValidateSME(h, c.Request().Context(), provider.CompanyID.Hex()); exception != nil {
+				return httpStatus, exception
+			}
+		}
+	}
+
+	if _, err := oidc.Discover(c.Request().Context(), provider.Issuer); err != nil {
+		return http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: err}
+	}
+	return http.StatusOK, nil
+}
+
+// oidcAdmin : admin of a verified identity, linked on the first login
+func oidcAdmin(c echo.Context, h Handler, provider *entity.OIDCProvider, identity *entity.OIDCIdentity, claims *oidc.Claims, email string) (*entity.Admin, int, *response.Exception) {
+	var admin *entity.Admin
+	var err error
+	if identity.UserID != nil {
+		admin, err = h.repository.FindAdminByID(c.Request().Context(), identity.UserID.Hex())
+	} else {
+		admin, err = h.repository.FindAdminByEmail(c.Request().Context(), email)
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	// superAdmin is never linked by email, an identity provider cannot take it over
+	if admin != nil && identity.UserID == nil && admin.Role == entity.UserRoleAdmin {
+		return nil, http.StatusForbidden, &response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("superAdmin %s cannot sign in with an identity provider", email)}
+	}
+
+	if admin == nil {
+		if !provider.Provision {
+			return nil, http.StatusNotFound, &response.Exception{Code: errcode.AdminNotFound, Error: fmt.Errorf("no admin has the email %s", email)}
+		}
+
+		timeNow := time.Now().UTC()
+		adminID := primitive.NewObjectID()
+		firstName, lastName := claimNames(claims)
+		admin = &entity.Admin{
+			ID:        &adminID,
+			FirstName: firstName,
+			LastName:  lastName,
+			Email:     email,
+			Role:      provider.DefaultRole,
+			Scopes:    provider.DefaultScopes,
+			Status:    entity.UserStatusActive,
+			Model: entity.Model{
+				CreatedAt: timeNow,
+				UpdatedAt: timeNow,
+			},
+		}
+		if _, err := h.repository.CreateAdmin(c.Request().Context(), *admin); err != nil {
+			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		}
+	}
+
+	if admin.Status != entity.UserStatusActive {
+		return nil, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("admin %s status inactive", email)}
+	}
+	return admin, http.StatusOK, nil
+}
+
+// oidcSMEUser : SME user of a verified identity, linked on the first login. The verified email activates invited
+// and unverified users.
+func oidcSMEUser(c echo.Context, h Handler, provider *entity.OIDCProvider, identity *entity.OIDCIdentity, claims *oidc.Claims, email string) (*entity.SMEUser, int, *response.Exception) {
+	var user *entity.SMEUser
+	var err error
+	if identity.UserID != nil {
+		user, err = h.repository.FindSMEUserByID(c.Request().Context(), identity.UserID.Hex())
+	} else {
+		user, err = h.repository.FindSMEUserByEmail(c.Request().Context(), email)
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if user == nil && !provider.Provision {
+		return nil, http.StatusNotFound, &response.Exception{Code: errcode.UserNotFound, Error: fmt.Errorf("no SME user has the email %s", email)}
+	}
+
+	// the company is checked before the user is changed, a provider cannot activate users of another company
+	companyID := provider.CompanyID
+	if user != nil {
+		companyID = user.CompanyID
+	}
+	// users of a provider with a company only sign in to that company
+	if companyID == nil || (provider.CompanyID != nil && *companyID != *provider.CompanyID) {
+		return nil, http.StatusForbidden, &response.Exception{Code: errcode.MismatchSME, Error: fmt.Errorf("SME user %s is not part of the company of %s", email, provider.Name)}
+	}
+	if _, httpStatus, exception := ValidateSME(h, c.Request().Context(), companyID.Hex()); exception != nil {
+		return nil, httpStatus, exception
+	}
+
+	timeNow := time.Now().UTC()
+	if user == nil {
+		if reached, err := smeUserLimitReached(c.Request().Context(), h, provider.CompanyID.Hex()); err != nil {
+			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		} else if reached {
+			return nil, http.StatusBadRequest, &response.Exception{Code: errcode.ExceedUserLimit, Error: fmt.Errorf("total number of users exceeded")}
+		}
+
+		userID := primitive.NewObjectID()
+		firstName, lastName := claimNames(claims)
+		user = &entity.SMEUser{
+			ID:              &userID,
+			CompanyID:       provider.CompanyID,
+			FirstName:       firstName,
+			LastName:        lastName,
+			Email:           email,
+			EmailVerifiedAt: timeNow,
+			Role:            provider.DefaultRole,
+			Status:          entity.UserStatusActive,
+			Model: entity.Model{
+				CreatedAt: timeNow,
+				UpdatedAt: timeNow,
+			},
+		}
+		if _, err := h.repository.CreateSMEUser(c.Request().Context(), *user); err != nil {
+			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		}
+	} else if user.Status == entity.UserStatusUnverified || user.Status == entity.UserStatusInvited {
+		user.EmailVerifiedAt = timeNow
+		user.Status = entity.UserStatusActive
+		user.UpdatedAt = timeNow
+		if _, err := h.repository.UpsertSMEUser(user); err != nil {
+			return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+		}
+	}
+
+	if user.Status != entity.UserStatusActive {
+		return nil, http.StatusBadRequest, &response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("SME user %s status inactive", email)}
+	}
+	return user, http.StatusOK, nil
+}
+
+// claimNames : first and last name of the ID token, the full name when the provider has no given name
+func claimNames(claims *oidc.Claims) (string, string) {
+	if claims.GivenName != "" {
+		return claims.GivenName, claims.FamilyName
+	}
+	if parts := strings.SplitN(strings.TrimSpace(claims.Name), " ", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return claims.Name, ""
+}
+
+// oidcProviderLimited : whether the accounts of a provider are limited, admin providers by email domains and SME user
+// providers by a company or email domains. Otherwise any account of any tenant could sign in through it.
+func oidcProviderLimited(provider *entity.OIDCProvider) bool {
+	if provider.AccountType == entity.AccountTypeAdmin {
+		return len(provider.AllowedDomains) > 0
+	}
+	return provider.CompanyID != nil || len(provider.AllowedDomains) > 0
+}
+
+// emailDomainAllowed :
+func emailDomainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	return at >= 0 && random.Contains(domains, email[at+1:])
+}
+
+// lowerAll :
+func lowerAll(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, v := range values {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(v)))
+	}
+	return lowered
+}
@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/env"
+	"csi-api/app/kit/aws"
+	"csi-api/app/kit/jwt"
+	"csi-api/app/kit/password"
+	"csi-api/app/kit/random"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	emailVerificationExpiresInHour = 24
+	invitationExpiresInHour        = 24 * 7
+)
+
+// InviteSMEUser : invite a colleague to the SME by email, the invitee sets a password through the emailed link
+func (h Handler) InviteSMEUser(c echo.Context) error {
+	var i struct {
+		CompanyID string          `json:"companyId" form:"companyId" validate:"max=50"`
+		FirstName string          `json:"firstName" form:"firstName" validate:"required,max=50"`
+		LastName  string          `json:"lastName" form:"lastName" validate:"required,max=50"`
+		Title     string          `json:"title" form:"title" validate:"required"`
+		Position  string          `json:"position" form:"position" validate:"required"`
+		Email     string          `json:"email" form:"email" validate:"required,email,min=10,max=100"`
+		Role      entity.UserRole `json:"role" form:"role" validate:"required,role"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.Email = strings.ToLower(strings.TrimSpace(i.Email))
+	i.CompanyID = strings.TrimSpace(i.CompanyID)
+
+	// sme users invite to their own company
+	inviter := "CSI"
+	if smeUserData := c.Get("SME_ADMIN"); smeUserData != nil {
+		smeUser := smeUserData.(entity.SMEUser)
+		i.CompanyID = smeUser.CompanyID.Hex()
+		inviter = strings.TrimSpace(smeUser.FirstName + " " + smeUser.LastName)
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	if i.CompanyID == "" {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("companyId is required")})
+	}
+
+	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), i.CompanyID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	user, err := h.repository.FindSMEUserByEmail(c.Request().Context(), i.Email)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if user != nil {
+		// inviting a pending invitee again sends a new link
+		if user.Status != entity.UserStatusInvited || user.CompanyID.Hex() != sme.ID.Hex() {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EmailFound})
+		}
+		user.UpdatedAt = timeNow
+		if _, err := h.repository.UpsertSMEUser(user); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	} else {
+		if reached, err := smeUserLimitReached(c.Request().Context(), h, sme.ID.Hex()); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		} else if reached {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.ExceedUserLimit, Error: fmt.Errorf("total number of users exceeded")})
+		}
+
+		userID := primitive.NewObjectID()
+		user = &entity.SMEUser{
+			ID:        &userID,
+			CompanyID: sme.ID,
+			FirstName: i.FirstName,
+			LastName:  i.LastName,
+			Title:     entity.UserTitle(i.Title),
+			Email:     i.Email,
+			Position:  i.Position,
+			Role:      i.Role,
+			Status:    entity.UserStatusInvited,
+			Model: entity.Model{
+				CreatedAt: timeNow,
+				UpdatedAt: timeNow,
+			},
+		}
+		if _, err := h.repository.CreateSMEUser(c.Request().Context(), *user); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	}
+
+	if httpStatus, exception := sendInvitationEmail(user, sme, inviter); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: user})
+}
+
+// AcceptInvitation : set the password of an invited user and activate the account
+func (h Handler) AcceptInvitation(c echo.Context) error {
+	var i struct {
+		Token    string `json:"token" form:"token" validate:"required"`
+		Password string `json:"password" form:"password" validate:"required,min=6,max=20"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.Password = strings.TrimSpace(i.Password)
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	user, httpStatus, exception := linkTokenUser(h, c.Request().Context(), i.Token, jwt.TokenTypeInvitation, entity.UserStatusInvited)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	salt := random.Strings(10)
+	passwordHash, err := password.Create(i.Password, salt, env.Config.Jwt.Secret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	// the invitee received the link, so the email is verified too
+	timeNow := time.Now().UTC()
+	user.PasswordSalt = salt
+	user.PasswordHash = passwordHash
+	user.EmailVerifiedAt = timeNow
+	user.Status = entity.UserStatusActive
+	user.UpdatedAt = timeNow
+	if _, err := h.repository.UpsertSMEUser(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// VerifyEmail : activate a self registered user with the token of the verification email
+func (h Handler) VerifyEmail(c echo.Context) error {
+	var i struct {
+		Token string `json:"token" form:"token" validate:"required"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	user, httpStatus, exception := linkTokenUser(h, c.Request().Context(), i.Token, jwt.TokenTypeEmailVerification, entity.UserStatusUnverified)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	user.EmailVerifiedAt = timeNow
+	user.Status = entity.UserStatusActive
+	user.UpdatedAt = timeNow
+	if _, err := h.repository.UpsertSMEUser(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ResendVerificationEmail : send the verification email again, at most once a minute. The response is the same
+// whether the account exists or not.
+func (h Handler) ResendVerificationEmail(c echo.Context) error {
+	var i struct {
+		Email string `json:"email" form:"email" validate:"required,email,max=100"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.Email = strings.ToLower(strings.TrimSpace(i.Email))
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	user, err := h.repository.FindSMEUserByEmail(c.Request().Context(), i.Email)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusOK, nil)
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	if user.Status != entity.UserStatusUnverified || timeNow.Sub(user.UpdatedAt) < time.Minute {
+		return c.JSON(http.StatusOK, nil)
+	}
+
+	user.UpdatedAt = timeNow
+	if _, err := h.repository.UpsertSMEUser(user); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if httpStatus, exception := sendVerificationEmail(user); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// linkTokenUser : SME user of an emailed link token, the user must still be in the status the link was sent for
+// and have the same email, so a link stops working once used
+func linkTokenUser(h Handler, ctx context.Context, token string, tokenType string, status entity.UserStatus) (*entity.SMEUser, int, *response.Exception) {
+	invalid := &response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("link is invalid or has expired")}
+
+	claims, err := jwt.Validate(strings.TrimSpace(token))
+	if err != nil {
+		return nil, http.StatusBadRequest, invalid
+	}
+
+	if ok := claims.VerifyIssuer(env.Config.Jwt.Issuer, true); !ok {
+		return nil, http.StatusBadRequest, invalid
+	}
+
+	reqClaims, err := jwt.ExtractClaims(claims)
+	if err != nil || reqClaims.Type != tokenType {
+		return nil, http.StatusBadRequest, invalid
+	}
+
+	if isExpired, err := jwt.IsTokenExpired(reqClaims.Exp); err != nil || isExpired {
+		return nil, http.StatusBadRequest, invalid
+	}
+
+	user, err := h.repository.FindSMEUserByID(ctx, reqClaims.Audience)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, http.StatusBadRequest, invalid
+		}
+		return nil, http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	if user.Status != status || user.Email != reqClaims.Email {
+		return nil, http.StatusBadRequest, invalid
+	}
+	return user, http.StatusOK, nil
+}
+
+// sendVerificationEmail :
+func sendVerificationEmail(user *entity.SMEUser) (int, *response.Exception) {
+	token, err := jwt.GenerateLinkToken(env.Config.Jwt.Secret, jwt.TokenTypeEmailVerification, time.Hour*emailVerificationExpiresInHour, map[string]string{
+		"aud":   user.ID.Hex(),
+		"email": user.Email,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	content := `<p>Hi {FirstName},</p>
+<p>Thank you for signing up to CSI. Please confirm your email address to activate your account.</p>
+<p><a href='{Link}'>Verify email</a></p>
+<p>The link expires in {Hours} hours. If you did not sign up, you can ignore this email.</p>
+<p>Best regards,<br>SDM Team</p>`
+	content = strings.Replace(content, "{FirstName}", html.EscapeString(user.FirstName), 1)
+	content = strings.Replace(content, "{Link}", fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(env.Config.App.UserPortalPath, "/"), token), 1)
+	content = strings.Replace(content, "{Hours}", fmt.Sprintf("%d", emailVerificationExpiresInHour), 1)
+
+	recipient := user.Email
+	return aws.SendEmails([]*string{&recipient}, "Verify your CSI account", content, "", env.Config.AWS.Sender)
+}
+
+// sendInvitationEmail :
+func sendInvitationEmail(user *entity.SMEUser, sme *entity.SME, inviter string) (int, *response.Exception) {
+	token, err := jwt.GenerateLinkToken(env.Config.Jwt.Secret, jwt.TokenTypeInvitation, time.Hour*invitationExpiresInHour, map[string]string{
+		"aud":   user.ID.Hex(),
+		"email": user.Email,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, &response.Exception{Code: errcode.ServerError, Error: err}
+	}
+
+	content := `<p>Hi {FirstName},</p>
+<p>{Inviter} has invited you to join {CompanyName} on CSI. Click the link below to set your password and activate your account.</p>
+<p><a href='{Link}'>Accept invitation</a></p>
+<p>The link expires in {Days} days.</p>
+<p>Best regards,<br>SDM Team</p>`
+	content = strings.Replace(content, "{FirstName}", html.EscapeString(user.FirstName), 1)
+	content = strings.Replace(content, "{Inviter}", html.EscapeString(inviter), 1)
+	content = strings.Replace(content, "{CompanyName}", html.EscapeString(sme.CompanyName), 1)
+	content = strings.Replace(content, "{Link}", fmt.Sprintf("%s/accept-invitation?token=%s", strings.TrimRight(env.Config.App.UserPortalPath, "/"), token), 1)
+	content = strings.Replace(content, "{Days}", fmt.Sprintf("%d", invitationExpiresInHour/24), 1)
+
+	recipient := user.Email
+	return aws.SendEmails([]*string{&recipient}, fmt.Sprintf("You are invited to join %s on CSI", sme.CompanyName), content, "", env.Config.AWS.Sender)
+}
+
+// smeUserLimitReached : active and invited users count towards the user limit of the subscription plan
+func smeUserLimitReached(ctx context.Context, h Handler, companyID string) (bool, error) {
+	maxUser := 3
+	subscriptions, _, err := h.repository.FindSubscriptions(ctx, repository.FindSubscriptionFilter{
+		CorporateIDs: []string{companyID},
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(subscriptions) > 0 && subscriptions[0].SubscriptionPlan != "Single Business Plan" {
+		maxUser = 10
+	}
+
+	total := 0
+	for _, status := range []entity.UserStatus{entity.UserStatusActive, entity.UserStatusInvited} {
+		users, _, err := h.repository.FindSMEUsers(ctx, repository.FindSMEUserFilter{
+			CompanyID: companyID,
+			Status:    status,
+		})
+		if err != nil {
+			return false, err
+		}
+		total += len(users)
+	}
+	return total >= maxUser, nil
+}
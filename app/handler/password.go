@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"csi-api/app/entity"
+	"csi-api/app/env"
+	"csi-api/app/kit/aws"
+	"csi-api/app/kit/password"
+	"csi-api/app/kit/random"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	passwordResetExpiresInMinute = 30
+	passwordResetLimitPerHour    = 3
+)
+
+// ForgotPassword : email a single use password reset link. The response is the same whether the account exists
+// or not, so the endpoint cannot be used to find registered emails.
+func (h Handler) ForgotPassword(c echo.Context) error {
+	var i struct {
+		Email       string `json:"email" form:"email" validate:"required,email,max=100"`
+		AccountType string `json:"accountType" form:"accountType" validate:"required,eq=ADMIN|eq=SME_USER|eq=CORPORATE_USER"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	i.Email = strings.ToLower(strings.TrimSpace(i.Email))
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	count, err := h.repository.CountPasswordResets(c.Request().Context(), i.Email, timeNow.Add(-time.Hour))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if count >= passwordResetLimitPerHour {
+		return c.JSON(http.StatusTooManyRequests, response.Exception{Code: errcode.ExceedOTPRequest, Error: fmt.Errorf("too many password reset requests, try again later")})
+	}
+
+	// every request counts towards the limit, whether the account exists or not
+	resetID := primitive.NewObjectID()
+	reset := entity.PasswordReset{
+		ID:          &resetID,
+		AccountType: entity.AccountType(i.AccountType),
+		Email:       i.Email,
+		IPAddress:   c.RealIP(),
+		Status:      entity.PasswordResetStatusRequested,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+	if _, err := h.repository.CreatePasswordReset(c.Request().Context(), reset); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	var (
+		userID    *primitive.ObjectID
+		firstName string
+		portal    string
+	)
+	switch entity.AccountType(i.AccountType) {
+	case entity.AccountTypeAdmin:
+		admin, err := h.repository.FindAdminByEmail(c.Request().Context(), i.Email)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if err == nil && admin.Status == entity.UserStatusActive {
+			userID, firstName, portal = admin.ID, admin.FirstName, env.Config.App.AdminPortalPath
+		}
+	case entity.AccountTypeSMEUser:
+		user, err := h.repository.FindSMEUserByEmail(c.Request().Context(), i.Email)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if err == nil && user.Status == entity.UserStatusActive {
+			userID, firstName, portal = user.ID, user.FirstName, env.Config.App.UserPortalPath
+		}
+	case entity.AccountTypeCorporateUser:
+		user, err := h.repository.FindCorporateUserByEmail(c.Request().Context(), i.Email)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if err == nil && user.Status == entity.UserStatusActive {
+			userID, firstName, portal = user.ID, user.FirstName, env.Config.App.UserPortalPath
+		}
+	}
+	if userID == nil {
+		return c.JSON(http.StatusOK, nil)
+	}
+
+	// only the latest link works
+	if _, err := h.repository.CancelPasswordResets(c.Request().Context(), userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	token, err := random.Token(32)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	reset.UserID = userID
+	reset.TokenHash = random.HashToken(token)
+	reset.ExpiresAt = timeNow.Add(time.Minute * passwordResetExpiresInMinute)
+	reset.Status = entity.PasswordResetStatusActive
+	if _, err := h.repository.UpsertPasswordReset(&reset); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	content := `<p>Hi {FirstName},</p>
+<p>We received a request to reset the password of your CSI account. Click the link below to choose a new password.</p>
+<p><a href='{Link}'>Reset password</a></p>
+<p>The link expires in {Minutes} minutes and can only be used once. If you did not request a password reset, you can ignore this email.</p>
+<p>Best regards,<br>SDM Team</p>`
+	content = strings.Replace(content, "{FirstName}", html.EscapeString(firstName), 1)
+	content = strings.Replace(content, "{Link}", fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(portal, "/"), token), 1)
+	content = strings.Replace(content, "{Minutes}", fmt.Sprintf("%d", passwordResetExpiresInMinute), 1)
+
+	// a failed email answers like an unknown account, otherwise the response tells which accounts exist
+	recipient := i.Email
+	if _, exception := aws.SendEmails([]*string{&recipient}, "Reset your CSI password", content, "", env.Config.AWS.Sender); exception != nil {
+		log.Printf("password reset %s: email not sent: %v", reset.ID.Hex(), exception.Error)
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ResetPassword : set a new password with the token of a reset link, then log out every session of the user
+func (h Handler) ResetPassword(c echo.Context) error {
+	var i struct {
+		Token    string `json:"token" form:"token" validate:"required"`
+		Password string `json:"password" form:"password" validate:"required,min=6,max=20"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	reset, err := h.repository.FindPasswordResetByTokenHash(c.Request().Context(), random.HashToken(strings.TrimSpace(i.Token)))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("invalid password reset token")})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if reset.Status != entity.PasswordResetStatusActive || time.Now().UTC().After(reset.ExpiresAt) {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("password reset token expired or already used")})
+	}
+
+	// claim the token first so it cannot be used twice
+	used, err := h.repository.UsePasswordReset(c.Request().Context(), reset.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if !used {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("password reset token expired or already used")})
+	}
+
+	salt := random.Strings(10)
+	passwordHash, err := password.Create(i.Password, salt, env.Config.Jwt.Secret)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	switch reset.AccountType {
+	case entity.AccountTypeAdmin:
+		admin, httpStatus, exception := ValidateAdmin(h, c.Request().Context(), reset.UserID.Hex())
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+		admin.PasswordSalt = salt
+		admin.PasswordHash = passwordHash
+		admin.UpdatedAt = timeNow
+		if _, err := h.repository.UpsertAdmin(admin); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	case entity.AccountTypeSMEUser:
+		user, httpStatus, exception := ValidateSMEUser(h, c.Request().Context(), reset.UserID.Hex())
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+		user.PasswordSalt = salt
+		user.PasswordHash = passwordHash
+		user.UpdatedAt = timeNow
+		if _, err := h.repository.UpsertSMEUser(user); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	case entity.AccountTypeCorporateUser:
+		user, httpStatus, exception := ValidateCorporateUser(h, c.Request().Context(), reset.UserID.Hex())
+		if exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+		user.PasswordSalt = salt
+		user.PasswordHash = passwordHash
+		user.UpdatedAt = timeNow
+		if _, err := h.repository.UpsertCorporateUser(user); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	}
+
+	if _, err := h.repository.RevokeSessions(c.Request().Context(), reset.UserID, nil, reset.UserID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
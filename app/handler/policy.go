@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"csi-api/app/constant"
+	"csi-api/app/entity"
+	"csi-api/app/kit/random"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// protectedPolicies : rules keeping superAdmin in control, removing them would lock everyone out of the policy
+var protectedPolicies = []entity.PolicyRule{
+	{PType: "p", Rule: []string{"admin", "/*", "*"}},
+	{PType: "g", Rule: []string{"superAdmin", "admin"}},
+}
+
+// policyActions : methods a policy can allow
+var policyActions = []string{"*", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// GetPolicies : policy (ptype p) and role grouping (ptype g) rules in effect, optionally of one subject
+func (h Handler) GetPolicies(c echo.Context) error {
+	if _, httpStatus, exception := superAdminOnly(c); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	ptypes := []string{"p", "g"}
+	if ptype := c.QueryParam("ptype"); ptype != "" {
+		if ptype != "p" && ptype != "g" {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("ptype must be p or g")})
+		}
+		ptypes = []string{ptype}
+	}
+
+	subject := c.QueryParam("subject")
+	policies := make([]entity.PolicyRule, 0)
+	for _, ptype := range ptypes {
+		var rules [][]string
+		if ptype == "p" {
+			rules = h.enforcer.GetFilteredNamedPolicy(ptype, 0, subject)
+		} else {
+			rules = h.enforcer.GetFilteredNamedGroupingPolicy(ptype, 0, subject)
+		}
+		for _, rule := range rules {
+			policies = append(policies, entity.PolicyRule{PType: ptype, Rule: rule})
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: policies, Count: len(policies)})
+}
+
+// AddPolicy : add a policy rule (subject, path, method) or a role grouping (role, parent role), every instance
+// picks the change up
+func (h Handler) AddPolicy(c echo.Context) error {
+	admin, httpStatus, exception := superAdminOnly(c)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	var i struct {
+		PType string   `json:"ptype" form:"ptype" validate:"required,eq=p|eq=g"`
+		Rule  []string `json:"rule" form:"rule" validate:"required,min=2,max=3,dive,required,max=100"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	for idx := range i.Rule {
+		i.Rule[idx] = strings.TrimSpace(i.Rule[idx])
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	if err := validatePolicyRule(i.PType, i.Rule); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	params := make([]interface{}, 0, len(i.Rule))
+	for _, v := range i.Rule {
+		params = append(params, v)
+	}
+
+	var added bool
+	var err error
+	if i.PType == "p" {
+		added, err = h.enforcer.AddNamedPolicy(i.PType, params...)
+	} else {
+		added, err = h.enforcer.AddNamedGroupingPolicy(i.PType, params...)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if !added {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.RecordFound, Error: fmt.Errorf("%s rule %s already exists", i.PType, strings.Join(i.Rule, ", "))})
+	}
+
+	if err := recordPolicyChange(c, h, entity.PolicyChangeActionAdd, i.PType, i.Rule, admin.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: entity.PolicyRule{PType: i.PType, Rule: i.Rule}})
+}
+
+// RemovePolicy : remove a policy rule or a role grouping given as ptype and repeated rule query params
+func (h Handler) RemovePolicy(c echo.Context) error {
+	admin, httpStatus, exception := superAdminOnly(c)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	ptype := c.QueryParam("ptype")
+	rule := c.Request().URL.Query()["rule"]
+	if (ptype != "p" || len(rule) != 3) && (ptype != "g" || len(rule) != 2) {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("a p rule needs 3 values and a g rule 2")})
+	}
+
+	for _, protected := range protectedPolicies {
+		if protected.PType == ptype && strings.Join(protected.Rule, ",") == strings.Join(rule, ",") {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: fmt.Errorf("%s rule %s cannot be removed", ptype, strings.Join(rule, ", "))})
+		}
+	}
+
+	params := make([]interface{}, 0, len(rule))
+	for _, v := range rule {
+		params = append(params, v)
+	}
+
+	var removed bool
+	var err error
+	if ptype == "p" {
+		removed, err = h.enforcer.RemoveNamedPolicy(ptype, params...)
+	} else {
+		removed, err = h.enforcer.RemoveNamedGroupingPolicy(ptype, params...)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if !removed {
+		return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("%s rule %s not found", ptype, strings.Join(rule, ", "))})
+	}
+
+	if err := recordPolicyChange(c, h, entity.PolicyChangeActionRemove, ptype, rule, admin.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// GetPolicyChanges : audit log of policy edits
+func (h Handler) GetPolicyChanges(c echo.Context) error {
+	if _, httpStatus, exception := superAdminOnly(c); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	changes, cursor, err := h.repository.FindPolicyChanges(c.Request().Context(), repository.FindPolicyChangeFilter{
+		Cursor: c.QueryParam("cursor"),
+		By:     c.QueryParam("by"),
+		PType:  c.QueryParam("ptype"),
+		Action: entity.PolicyChangeAction(c.QueryParam("action")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: changes, Cursor: cursor, Count: len(changes)})
+}
+
+// superAdminOnly : the current admin when it is a superAdmin, casbin lets every admin through the admin routes
+func superAdminOnly(c echo.Context) (*entity.Admin, int, *response.Exception) {
+	adminData := c.Get("ADMIN")
+	if adminData == nil || c.Get("role") != "superAdmin" {
+		return nil, http.StatusForbidden, &response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only superAdmin has access")}
+	}
+	admin := adminData.(entity.Admin)
+	return &admin, http.StatusOK, nil
+}
+
+// validatePolicyRule : a p rule is subject, path and method, a g rule is role and parent role
+func validatePolicyRule(ptype string, rule []string) error {
+	for _, v := range rule {
+		// the subject of a request is role#scopes
+		if strings.ContainsAny(v, "#,") {
+			return fmt.Errorf("rule values cannot contain # or ,")
+		}
+	}
+
+	if ptype == "g" {
+		if len(rule) != 2 {
+			return fmt.Errorf("a g rule needs a role and a parent role")
+		}
+		return nil
+	}
+
+	if len(rule) != 3 {
+		return fmt.Errorf("a p rule needs a subject, a path and a method")
+	}
+	if scope := strings.TrimPrefix(rule[0], "scope:"); scope != rule[0] && !random.Contains(constant.UserScopes, entity.Scope(scope)) {
+		return fmt.Errorf("unknown scope %s", scope)
+	}
+	if !strings.HasPrefix(rule[1], "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if !random.Contains(policyActions, rule[2]) {
+		return fmt.Errorf("method must be one of %s", strings.Join(policyActions, ", "))
+	}
+	return nil
+}
+
+// recordPolicyChange :
+func recordPolicyChange(c echo.Context, h Handler, action entity.PolicyChangeAction, ptype string, rule []string, by *primitive.ObjectID) error {
+	changeID := primitive.NewObjectID()
+	_, err := h.repository.CreatePolicyChange(c.Request().Context(), entity.PolicyChange{
+		ID:     &changeID,
+		Action: action,
+		PType:  ptype,
+		Rule:   rule,
+		By:     by,
+		At:     time.Now().UTC(),
+	})
+	return err
+}
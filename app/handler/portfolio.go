@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"csi-api/app/entity"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	portfolioRiskThreshold = 40 // overall or dimension score below which a supplier is high risk
+	portfolioOverdueDays   = 14 // days an invitation can stay unanswered
+	portfolioDimensions    = 5  // weakest dimensions reported
+)
+
+// PortfolioSummary :
+type PortfolioSummary struct {
+	CorporateID        string                        `json:"corporateID"`
+	Coverage           *repository.PortfolioCoverage `json:"coverage"`
+	PendingInvitations int                           `json:"pendingInvitations"`
+	OverdueInvitations int                           `json:"overdueInvitations"`
+}
+
+// GetPortfolioSummary : assessment coverage of the connected SMEs of a corporate and its open invitations
+func (h Handler) GetPortfolioSummary(c echo.Context) error {
+	corporate, httpStatus, exception := portfolioCorporate(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	overdueDays, exception := portfolioParam(c, "overdueDays", portfolioOverdueDays)
+	if exception != nil {
+		return c.JSON(http.StatusUnprocessableEntity, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	coverage, err := h.repository.PortfolioCoverage(c.Request().Context(), corporate.ID, timeNow)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	pending, err := h.repository.PortfolioOverdueInvitations(c.Request().Context(), corporate.ID, timeNow, timeNow)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	overdue := 0
+	for _, invitation := range pending {
+		if invitation.DaysPending >= int(overdueDays) {
+			overdue++
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: PortfolioSummary{
+		CorporateID:        corporate.ID.Hex(),
+		Coverage:           coverage,
+		PendingInvitations: len(pending),
+		OverdueInvitations: overdue,
+	}})
+}
+
+// GetPortfolioScores : score distribution and weakest dimensions of the suppliers, from the scores shared with
+// the corporate
+func (h Handler) GetPortfolioScores(c echo.Context) error {
+	corporate, httpStatus, exception := portfolioCorporate(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	dimensions, exception := portfolioParam(c, "dimensions", portfolioDimensions)
+	if exception != nil {
+		return c.JSON(http.StatusUnprocessableEntity, exception)
+	}
+	if dimensions < 1 {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("invalid dimensions")})
+	}
+
+	scores, err := h.repository.PortfolioScores(c.Request().Context(), corporate.ID, time.Now().UTC(), int(dimensions))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: scores})
+}
+
+// GetPortfolioRisks : suppliers scoring below the threshold overall or in a dimension
+func (h Handler) GetPortfolioRisks(c echo.Context) error {
+	corporate, httpStatus, exception := portfolioCorporate(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	threshold, exception := portfolioParam(c, "threshold", portfolioRiskThreshold)
+	if exception != nil {
+		return c.JSON(http.StatusUnprocessableEntity, exception)
+	}
+
+	risks, err := h.repository.PortfolioRisks(c.Request().Context(), corporate.ID, time.Now().UTC(), threshold)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: risks, Count: len(risks)})
+}
+
+// GetPortfolioOverdueInvitations : invitations unanswered for overdueDays or longer
+func (h Handler) GetPortfolioOverdueInvitations(c echo.Context) error {
+	corporate, httpStatus, exception := portfolioCorporate(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	overdueDays, exception := portfolioParam(c, "overdueDays", portfolioOverdueDays)
+	if exception != nil {
+		return c.JSON(http.StatusUnprocessableEntity, exception)
+	}
+
+	timeNow := time.Now().UTC()
+	cutoff := timeNow.Add(-time.Duration(overdueDays*24) * time.Hour)
+	invitations, err := h.repository.PortfolioOverdueInvitations(c.Request().Context(), corporate.ID, timeNow, cutoff)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: invitations, Count: len(invitations)})
+}
+
+// portfolioCorporate : corporate the portfolio is for, corporate users get their own
+func portfolioCorporate(c echo.Context, h Handler) (*entity.Corporate, int, *response.Exception) {
+	corporateID, httpStatus, exception := corporateTenantFilter(c, c.QueryParam("corporateId"))
+	if exception != nil {
+		return nil, httpStatus, exception
+	}
+	if corporateID == "" {
+		return nil, http.StatusUnprocessableEntity, &response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("corporateId is required")}
+	}
+	return ValidateCorporate(h, c.Request().Context(), corporateID)
+}
+
+// portfolioParam : non negative number query parameter with a default
+func portfolioParam(c echo.Context, name string, fallback float64) (float64, *response.Exception) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return fallback, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, &response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("invalid %s", name)}
+	}
+	return number, nil
+}
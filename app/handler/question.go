@@ -2,7 +2,11 @@ package handler
 
 import (
 	"context"
+	"csi-api/app/constant"
 	"csi-api/app/entity"
+	"csi-api/app/kit/answer"
+	"csi-api/app/kit/condition"
+	"csi-api/app/kit/random"
 	"csi-api/app/repository"
 	"csi-api/app/response"
 	"csi-api/app/response/errcode"
@@ -49,6 +53,12 @@ func (h Handler) UpdateQuestion(c echo.Context) error {
 		QuestionLabel string              `json:"questionLabel" form:"questionLabel"`
 		QuestionType  entity.QuestionType `json:"questionType" form:"questionType"`
 		Options       []string            `json:"options" form:"options"`
+		Rows          []string            `json:"rows" form:"rows"`
+		Unit          string              `json:"unit" form:"unit"`
+		Min           *float64            `json:"min" form:"min"`
+		Max           *float64            `json:"max" form:"max"`
+		Weight        float64             `json:"weight" form:"weight" validate:"gte=0"`
+		Conditions    []entity.Condition  `json:"conditions" form:"conditions"`
 		Status        entity.Status       `json:"status" form:"status"`
 	}
 
@@ -74,12 +84,14 @@ func (h Handler) UpdateQuestion(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
+	// questions of a published revision are immutable
+	if _, httpStatus, exception := ValidateDraftQuestionSet(h, c.Request().Context(), question.QuestionSetID.Hex()); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	if i.QuestionSetID != "" {
-		if _, err := h.repository.FindQuestionSetByID(c.Request().Context(), i.QuestionSetID); err != nil {
-			if err == mongo.ErrNoDocuments {
-				return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("question set %s not found", i.QuestionSetID)})
-			}
-			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		if _, httpStatus, exception := ValidateDraftQuestionSet(h, c.Request().Context(), i.QuestionSetID); exception != nil {
+			return c.JSON(httpStatus, exception)
 		}
 		questionSetID, err := primitive.ObjectIDFromHex(i.QuestionSetID)
 		if err != nil {
@@ -115,10 +127,50 @@ func (h Handler) UpdateQuestion(c echo.Context) error {
 		question.Options = i.Options
 	}
 
+	if len(i.Rows) > 0 {
+		question.Rows = i.Rows
+	}
+
+	if i.Unit != "" {
+		question.Unit = i.Unit
+	}
+
+	if i.Min != nil {
+		question.Min = i.Min
+	}
+
+	if i.Max != nil {
+		question.Max = i.Max
+	}
+
+	if i.Weight > 0 {
+		question.Weight = i.Weight
+	}
+
+	// an empty list removes every condition
+	if i.Conditions != nil {
+		question.Conditions = i.Conditions
+	}
+
 	if i.Status != "" {
 		question.Status = i.Status
 	}
 
+	// conditions refer to questions of the set the question ends up in
+	setQuestions, err := findAllQuestions(c.Request().Context(), h, repository.FindQuestionFilter{
+		QuestionSetID: question.QuestionSetID.Hex(),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if err := validateConditions(question, setQuestions); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	if err := answer.ValidateQuestion(question); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
 	question.Model.UpdatedAt = time.Now().UTC()
 
 	if _, err := h.repository.UpsertQuestion(question); err != nil {
@@ -143,6 +195,11 @@ func (h Handler) DeleteQuestion(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
+	// questions of a published revision are immutable
+	if _, httpStatus, exception := ValidateDraftQuestionSet(h, c.Request().Context(), question.QuestionSetID.Hex()); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	if _, err := h.repository.DeleteQuestionByID(question); err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
@@ -161,6 +218,12 @@ func (h Handler) CreateQuestion(c echo.Context) error {
 		QuestionLabel string              `json:"questionLabel" form:"questionLabel" validate:"required"`
 		QuestionType  entity.QuestionType `json:"questionType" form:"questionType" validate:"required"`
 		Options       []string            `json:"options" form:"options"`
+		Rows          []string            `json:"rows" form:"rows"`
+		Unit          string              `json:"unit" form:"unit"`
+		Min           *float64            `json:"min" form:"min"`
+		Max           *float64            `json:"max" form:"max"`
+		Weight        float64             `json:"weight" form:"weight" validate:"gte=0"`
+		Conditions    []entity.Condition  `json:"conditions" form:"conditions"`
 	}
 
 	var i struct {
@@ -183,12 +246,12 @@ func (h Handler) CreateQuestion(c echo.Context) error {
 	for _, res := range i.Responses {
 		// clean up
 		res.QuestionSetID = strings.TrimSpace(res.QuestionSetID)
-		// check if question set exists
-		if _, err := h.repository.FindQuestionSetByID(c.Request().Context(), res.QuestionSetID); err != nil {
-			if err == mongo.ErrNoDocuments {
-				return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("question set %s not found", res.QuestionSetID)})
-			}
-			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		if res.Weight == 0 {
+			res.Weight = 1
+		}
+		// check if question set exists and is still a draft
+		if _, httpStatus, exception := ValidateDraftQuestionSet(h, c.Request().Context(), res.QuestionSetID); exception != nil {
+			return c.JSON(httpStatus, exception)
 		}
 
 		// create Question object
@@ -204,12 +267,19 @@ func (h Handler) CreateQuestion(c echo.Context) error {
 		question := entity.Question{
 			ID:            &questionID,
 			QuestionSetID: &questionSetID,
+			OriginID:      &questionID,
 			Dimension:     res.Dimension,
 			// SubCategory:   res.SubCategory,
 			// Indicator:     res.Indicator,
 			QuestionLabel: res.QuestionLabel,
 			QuestionType:  res.QuestionType,
 			Options:       res.Options,
+			Rows:          res.Rows,
+			Unit:          res.Unit,
+			Min:           res.Min,
+			Max:           res.Max,
+			Weight:        res.Weight,
+			Conditions:    res.Conditions,
 			Status:        entity.StatusActive,
 			Model: entity.Model{
 				CreatedAt: timeNow,
@@ -217,6 +287,10 @@ func (h Handler) CreateQuestion(c echo.Context) error {
 			},
 		}
 
+		if err := answer.ValidateQuestion(&question); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+		}
+
 		// if res.QuestionType == entity.QuestionTypeDemographic {
 		// 	question.Options = res.Options
 		// }
@@ -224,6 +298,29 @@ func (h Handler) CreateQuestion(c echo.Context) error {
 		questions = append(questions, &question)
 	}
 
+	// conditions refer to questions of the same set, the ones created together included
+	setQuestions := make(map[string][]*entity.Question)
+	for _, question := range questions {
+		setID := question.QuestionSetID.Hex()
+		if _, ok := setQuestions[setID]; !ok {
+			existing, err := findAllQuestions(c.Request().Context(), h, repository.FindQuestionFilter{
+				QuestionSetID: setID,
+			})
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+			for _, q := range questions {
+				if q.QuestionSetID.Hex() == setID {
+					existing = append(existing, q)
+				}
+			}
+			setQuestions[setID] = existing
+		}
+		if err := validateConditions(question, setQuestions[setID]); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+		}
+	}
+
 	result, err := h.repository.BulkInsertQuestions(c.Request().Context(), questions)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{
@@ -251,3 +348,66 @@ func ValidateQuestion(h Handler, ctx context.Context, id string) (*entity.Questi
 	}
 	return questions, http.StatusOK, nil
 }
+
+// findAllQuestions : walk through every page of questions matching the filter
+func findAllQuestions(c context.Context, h Handler, filter repository.FindQuestionFilter) ([]*entity.Question, error) {
+	var questions []*entity.Question
+	for {
+		result, nextCursor, err := h.repository.FindQuestions(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return questions, nil
+}
+
+// validateConditions : check the display conditions of a question against the questions of its set. Answer
+// conditions are stored with the origin of the question they depend on, which is what entries are matched by.
+func validateConditions(question *entity.Question, questions []*entity.Question) error {
+	byID := make(map[string]*entity.Question, len(questions)*2)
+	for _, q := range questions {
+		byID[q.ID.Hex()] = q
+		byID[condition.Origin(q).Hex()] = q
+	}
+
+	for n := range question.Conditions {
+		c := &question.Conditions[n]
+		switch c.Source {
+		case entity.ConditionSourceAnswer:
+			if c.QuestionID == nil {
+				return fmt.Errorf("condition %d requires questionID", n)
+			}
+			dependency, ok := byID[c.QuestionID.Hex()]
+			if !ok {
+				return fmt.Errorf("condition %d refers to question %s which is not in the question set", n, c.QuestionID.Hex())
+			}
+			if condition.Origin(dependency).Hex() == condition.Origin(question).Hex() {
+				return fmt.Errorf("condition %d refers to the question itself", n)
+			}
+			c.QuestionID = condition.Origin(dependency)
+		case entity.ConditionSourceSME:
+			if !random.Contains(constant.SMEProfileFields, c.Field) {
+				return fmt.Errorf("condition %d has invalid field %s", n, c.Field)
+			}
+		default:
+			return fmt.Errorf("condition %d has invalid source %s", n, c.Source)
+		}
+
+		switch c.Operator {
+		case entity.ConditionOperatorIn, entity.ConditionOperatorNotIn, entity.ConditionOperatorPrefix:
+		default:
+			return fmt.Errorf("condition %d has invalid operator %s", n, c.Operator)
+		}
+
+		if len(c.Values) == 0 {
+			return fmt.Errorf("condition %d requires values", n)
+		}
+	}
+	return nil
+}
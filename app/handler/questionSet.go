@@ -3,11 +3,14 @@ package handler
 import (
 	"context"
 	"csi-api/app/entity"
+	"csi-api/app/kit/condition"
 	"csi-api/app/repository"
 	"csi-api/app/response"
 	"csi-api/app/response/errcode"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -18,10 +21,12 @@ import (
 // GetQuestionSets :
 func (h Handler) GetQuestionSets(c echo.Context) error {
 	questionSets, cursor, err := h.repository.FindQuestionSets(c.Request().Context(), repository.FindQuestionSetFilter{
-		Cursor: c.QueryParam("cursor"),
-		IDs:    c.Request().URL.Query()["Id"],
-		Label:  c.QueryParam("label"),
-		Status: entity.Status(c.QueryParam("status")),
+		Cursor:     c.QueryParam("cursor"),
+		IDs:        c.Request().URL.Query()["Id"],
+		Label:      c.QueryParam("label"),
+		RevisionOf: c.QueryParam("revisionOf"),
+		State:      entity.QuestionSetState(c.QueryParam("state")),
+		Status:     entity.Status(c.QueryParam("status")),
 	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{
@@ -37,8 +42,9 @@ func (h Handler) GetQuestionSets(c echo.Context) error {
 func (h Handler) UpdateQuestionSet(c echo.Context) error {
 	questionSetId := c.QueryParam("id")
 	var i struct {
-		Label  string        `json:"label" form:"label" validate:"max=40"`
-		Status entity.Status `json:"status" form:"status"`
+		Label   string             `json:"label" form:"label" validate:"max=40"`
+		Weights map[string]float64 `json:"weights" form:"weights" validate:"dive,gte=0"`
+		Status  entity.Status      `json:"status" form:"status"`
 	}
 
 	// bind req input
@@ -60,19 +66,32 @@ func (h Handler) UpdateQuestionSet(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
+	// published revisions are immutable
+	if (i.Label != "" || len(i.Weights) > 0) && questionSetState(questionSet) != entity.QuestionSetStateDraft {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.QuestionSetNotDraft, Error: fmt.Errorf("questionSet %s is %s", questionSetId, questionSetState(questionSet))})
+	}
+
 	if i.Label != "" {
-		// check if QuestionSet exists
+		// check if QuestionSet exists, revisions of the same question set share the label
 		if questionSets, _, err := h.repository.FindQuestionSets(c.Request().Context(), repository.FindQuestionSetFilter{
 			Label: i.Label,
-		}); err == nil && len(questionSets) > 0 {
-			return c.JSON(http.StatusBadRequest, response.Exception{
-				Code:  errcode.RecordFound,
-				Error: err,
-			})
+		}); err == nil {
+			for _, qs := range questionSets {
+				if questionSetLineage(qs).Hex() != questionSetLineage(questionSet).Hex() {
+					return c.JSON(http.StatusBadRequest, response.Exception{
+						Code:  errcode.RecordFound,
+						Error: fmt.Errorf("questionSet %s already exists", i.Label),
+					})
+				}
+			}
 		}
 		questionSet.Label = i.Label
 	}
 
+	if len(i.Weights) > 0 {
+		questionSet.Weights = i.Weights
+	}
+
 	if i.Status != "" {
 		questionSet.Status = i.Status
 	}
@@ -89,16 +108,14 @@ func (h Handler) UpdateQuestionSet(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.Item{Item: questionSet})
 }
 
-// DeleteQuestionSet :
+// DeleteQuestionSet : only drafts can be deleted, published and retired revisions stay for the assessments pinned
+// to them
 func (h Handler) DeleteQuestionSet(c echo.Context) error {
 	questionSetId := c.QueryParam("id")
 
-	questionSet, err := h.repository.FindQuestionSetByID(c.Request().Context(), questionSetId)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("questionSet %s not found", questionSetId)})
-		}
-		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	questionSet, httpStatus, exception := ValidateDraftQuestionSet(h, c.Request().Context(), questionSetId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
 	}
 
 	if _, err := h.repository.DeleteQuestionSetByID(questionSet); err != nil {
@@ -111,7 +128,8 @@ func (h Handler) DeleteQuestionSet(c echo.Context) error {
 // CreateQuestionSet :
 func (h Handler) CreateQuestionSet(c echo.Context) error {
 	var i struct {
-		Label string `json:"label" form:"label" validate:"required,max=40"`
+		Label   string             `json:"label" form:"label" validate:"required,max=40"`
+		Weights map[string]float64 `json:"weights" form:"weights" validate:"dive,gte=0"`
 	}
 
 	// bind req input
@@ -142,9 +160,13 @@ func (h Handler) CreateQuestionSet(c echo.Context) error {
 	questionSetID := primitive.NewObjectID()
 
 	questionSet := entity.QuestionSet{
-		ID:     &questionSetID,
-		Label:  i.Label,
-		Status: entity.StatusActive,
+		ID:         &questionSetID,
+		RevisionOf: &questionSetID,
+		Revision:   1,
+		Label:      i.Label,
+		Weights:    i.Weights,
+		State:      entity.QuestionSetStateDraft,
+		Status:     entity.StatusActive,
 		Model: entity.Model{
 			CreatedAt: timeNow,
 			UpdatedAt: timeNow,
@@ -161,6 +183,319 @@ func (h Handler) CreateQuestionSet(c echo.Context) error {
 	return c.JSON(http.StatusOK, response.Item{Item: questionSet})
 }
 
+// PublishQuestionSet : freeze a draft revision so it can be used by assessments
+func (h Handler) PublishQuestionSet(c echo.Context) error {
+	questionSetId := c.QueryParam("id")
+
+	questionSet, httpStatus, exception := ValidateDraftQuestionSet(h, c.Request().Context(), questionSetId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// an empty revision cannot be published
+	questions, _, err := h.repository.FindQuestions(c.Request().Context(), repository.FindQuestionFilter{
+		QuestionSetID: questionSetId,
+		Status:        entity.StatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if len(questions) == 0 {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("questionSet %s has no question", questionSetId)})
+	}
+
+	timeNow := time.Now().UTC()
+	questionSet.State = entity.QuestionSetStatePublished
+	questionSet.PublishedAt = timeNow
+	if adminData := c.Get("ADMIN"); adminData != nil {
+		questionSet.PublishedBy = adminData.(entity.Admin).ID
+	}
+	questionSet.Model.UpdatedAt = timeNow
+
+	if _, err := h.repository.UpsertQuestionSet(questionSet); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: questionSet})
+}
+
+// RetireQuestionSet : stop a published revision from being used by new assessments
+func (h Handler) RetireQuestionSet(c echo.Context) error {
+	questionSetId := c.QueryParam("id")
+
+	questionSet, httpStatus, exception := ValidateQuestionSet(h, c.Request().Context(), questionSetId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if questionSetState(questionSet) != entity.QuestionSetStatePublished {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.QuestionSetNotPublished, Error: fmt.Errorf("questionSet %s is not published", questionSetId)})
+	}
+
+	timeNow := time.Now().UTC()
+	questionSet.State = entity.QuestionSetStateRetired
+	questionSet.RetiredAt = timeNow
+	questionSet.Model.UpdatedAt = timeNow
+
+	if _, err := h.repository.UpsertQuestionSet(questionSet); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: questionSet})
+}
+
+// CreateQuestionSetRevision : copy a published or retired revision and its questions into a new draft
+func (h Handler) CreateQuestionSetRevision(c echo.Context) error {
+	questionSetId := c.QueryParam("id")
+
+	source, httpStatus, exception := ValidateQuestionSet(h, c.Request().Context(), questionSetId)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if questionSetState(source) == entity.QuestionSetStateDraft {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.QuestionSetNotPublished, Error: fmt.Errorf("questionSet %s is still a draft", questionSetId)})
+	}
+
+	// find the latest revision, only one draft is allowed at a time
+	lineage := questionSetLineage(source)
+	revisions, _, err := h.repository.FindQuestionSets(c.Request().Context(), repository.FindQuestionSetFilter{
+		RevisionOf: lineage.Hex(),
+		Status:     entity.StatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	latestRevision := source.Revision
+	for _, revision := range revisions {
+		if revision.State == entity.QuestionSetStateDraft {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.RecordFound, Error: fmt.Errorf("draft revision %s already exists", revision.ID.Hex())})
+		}
+		if revision.Revision > latestRevision {
+			latestRevision = revision.Revision
+		}
+	}
+
+	questions, err := findAllQuestions(c.Request().Context(), h, repository.FindQuestionFilter{
+		QuestionSetID: source.ID.Hex(),
+		Status:        entity.StatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	// create time object
+	timeNow := time.Now().UTC()
+
+	questionSetID := primitive.NewObjectID()
+	questionSet := entity.QuestionSet{
+		ID:         &questionSetID,
+		RevisionOf: lineage,
+		Revision:   latestRevision + 1,
+		Label:      source.Label,
+		Weights:    source.Weights,
+		State:      entity.QuestionSetStateDraft,
+		Status:     entity.StatusActive,
+		Model: entity.Model{
+			CreatedAt: timeNow,
+			UpdatedAt: timeNow,
+		},
+	}
+
+	if _, err = h.repository.CreateQuestionSet(c.Request().Context(), questionSet); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if len(questions) > 0 {
+		for _, question := range questions {
+			questionID := primitive.NewObjectID()
+			question.OriginID = condition.Origin(question)
+			question.ID = &questionID
+			question.QuestionSetID = &questionSetID
+			question.Model = entity.Model{
+				CreatedAt: timeNow,
+				UpdatedAt: timeNow,
+			}
+		}
+		if _, err := h.repository.BulkInsertQuestions(c.Request().Context(), questions); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: questionSet})
+}
+
+// QuestionChange :
+type QuestionChange struct {
+	OriginID string           `json:"originID"`
+	Change   string           `json:"change"`
+	Fields   []string         `json:"fields"`
+	From     *entity.Question `json:"from"`
+	To       *entity.Question `json:"to"`
+}
+
+// QuestionSetDiff :
+type QuestionSetDiff struct {
+	From    *entity.QuestionSet `json:"from"`
+	To      *entity.QuestionSet `json:"to"`
+	Added   int                 `json:"added"`
+	Removed int                 `json:"removed"`
+	Changed int                 `json:"changed"`
+	Changes []QuestionChange    `json:"changes"`
+}
+
+// DiffQuestionSets : list the questions added, removed and changed between two revisions
+func (h Handler) DiffQuestionSets(c echo.Context) error {
+	fromId := c.QueryParam("from")
+	toId := c.QueryParam("to")
+
+	revisions := make([]*entity.QuestionSet, 0, 2)
+	questions := make([]map[string]*entity.Question, 0, 2)
+	for _, id := range []string{fromId, toId} {
+		questionSet, err := h.repository.FindQuestionSetByID(c.Request().Context(), id)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("questionSet %s not found", id)})
+			}
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		result, err := findAllQuestions(c.Request().Context(), h, repository.FindQuestionFilter{
+			QuestionSetID: id,
+			Status:        entity.StatusActive,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+
+		byOrigin := make(map[string]*entity.Question)
+		for _, question := range result {
+			byOrigin[condition.Origin(question).Hex()] = question
+		}
+		revisions = append(revisions, questionSet)
+		questions = append(questions, byOrigin)
+	}
+
+	if questionSetLineage(revisions[0]).Hex() != questionSetLineage(revisions[1]).Hex() {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: fmt.Errorf("questionSet %s and %s are not revisions of the same question set", fromId, toId)})
+	}
+
+	diff := QuestionSetDiff{
+		From:    revisions[0],
+		To:      revisions[1],
+		Changes: []QuestionChange{},
+	}
+	for origin, from := range questions[0] {
+		to, ok := questions[1][origin]
+		if !ok {
+			diff.Removed++
+			diff.Changes = append(diff.Changes, QuestionChange{OriginID: origin, Change: "REMOVED", From: from})
+			continue
+		}
+		if fields := questionChangedFields(from, to); len(fields) > 0 {
+			diff.Changed++
+			diff.Changes = append(diff.Changes, QuestionChange{OriginID: origin, Change: "CHANGED", Fields: fields, From: from, To: to})
+		}
+	}
+	for origin, to := range questions[1] {
+		if _, ok := questions[0][origin]; !ok {
+			diff.Added++
+			diff.Changes = append(diff.Changes, QuestionChange{OriginID: origin, Change: "ADDED", To: to})
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].OriginID < diff.Changes[j].OriginID
+	})
+
+	return c.JSON(http.StatusOK, response.Item{Item: diff})
+}
+
+// questionChangedFields : names of the question fields that differ between two revisions
+func questionChangedFields(from, to *entity.Question) []string {
+	fields := []string{}
+	if from.Dimension != to.Dimension {
+		fields = append(fields, "dimension")
+	}
+	if from.QuestionLabel != to.QuestionLabel {
+		fields = append(fields, "questionLabel")
+	}
+	if from.QuestionType != to.QuestionType {
+		fields = append(fields, "questionType")
+	}
+	if strings.Join(from.Options, "\x00") != strings.Join(to.Options, "\x00") {
+		fields = append(fields, "options")
+	}
+	if strings.Join(from.Rows, "\x00") != strings.Join(to.Rows, "\x00") {
+		fields = append(fields, "rows")
+	}
+	if from.Unit != to.Unit {
+		fields = append(fields, "unit")
+	}
+	if !sameBound(from.Min, to.Min) {
+		fields = append(fields, "min")
+	}
+	if !sameBound(from.Max, to.Max) {
+		fields = append(fields, "max")
+	}
+	if from.Weight != to.Weight {
+		fields = append(fields, "weight")
+	}
+	if conditionsText(from.Conditions) != conditionsText(to.Conditions) {
+		fields = append(fields, "conditions")
+	}
+	return fields
+}
+
+// sameBound : whether two optional numeric bounds are equal
+func sameBound(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// conditionsText : comparable form of question conditions
+func conditionsText(conditions []entity.Condition) string {
+	texts := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		questionID := ""
+		if c.QuestionID != nil {
+			questionID = c.QuestionID.Hex()
+		}
+		texts = append(texts, strings.Join([]string{string(c.Source), questionID, c.Field, string(c.Operator), strings.Join(c.Values, ",")}, "|"))
+	}
+	return strings.Join(texts, "\x00")
+}
+
+// questionSetState : question sets created before revisions were introduced are treated as published
+func questionSetState(questionSet *entity.QuestionSet) entity.QuestionSetState {
+	if questionSet.State == "" {
+		return entity.QuestionSetStatePublished
+	}
+	return questionSet.State
+}
+
+// questionSetLineage : id of the first revision of the question set
+func questionSetLineage(questionSet *entity.QuestionSet) *primitive.ObjectID {
+	if questionSet.RevisionOf == nil {
+		return questionSet.ID
+	}
+	return questionSet.RevisionOf
+}
+
+// ValidateDraftQuestionSet : question set must exist and still be editable
+func ValidateDraftQuestionSet(h Handler, ctx context.Context, id string) (*entity.QuestionSet, int, *response.Exception) {
+	questionSet, httpStatus, exception := ValidateQuestionSet(h, ctx, id)
+	if exception != nil {
+		return questionSet, httpStatus, exception
+	}
+
+	if questionSetState(questionSet) != entity.QuestionSetStateDraft {
+		return &entity.QuestionSet{}, http.StatusBadRequest, &response.Exception{Code: errcode.QuestionSetNotDraft, Error: fmt.Errorf("questionSet %s is %s", id, questionSetState(questionSet))}
+	}
+	return questionSet, http.StatusOK, nil
+}
+
 // ValidateQuestionSet :
 func ValidateQuestionSet(h Handler, ctx context.Context, id string) (*entity.QuestionSet, int, *response.Exception) {
 	// check if QuestionSet exists
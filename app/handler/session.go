@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetSessions : active sessions of the current user
+func (h Handler) GetSessions(c echo.Context) error {
+	session, httpStatus, exception := currentSession(c)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	sessions, cursor, err := h.repository.FindSessions(c.Request().Context(), repository.FindSessionFilter{
+		Cursor: c.QueryParam("cursor"),
+		UserID: session.UserID.Hex(),
+		Status: entity.SessionStatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: sessions, Cursor: cursor, Count: len(sessions)})
+}
+
+// Logout : revoke the session of the current token
+func (h Handler) Logout(c echo.Context) error {
+	session, httpStatus, exception := currentSession(c)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, err := h.repository.RevokeSessions(c.Request().Context(), session.UserID, session.ID, session.UserID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// LogoutAll : revoke every session of the current user, on all devices
+func (h Handler) LogoutAll(c echo.Context) error {
+	session, httpStatus, exception := currentSession(c)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if _, err := h.repository.RevokeSessions(c.Request().Context(), session.UserID, nil, session.UserID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// GetUserSessions : sessions of any admin, vendor or SME user
+func (h Handler) GetUserSessions(c echo.Context) error {
+	sessions, cursor, err := h.repository.FindSessions(c.Request().Context(), repository.FindSessionFilter{
+		Cursor: c.QueryParam("cursor"),
+		UserID: c.QueryParam("userId"),
+		Status: entity.SessionStatus(c.QueryParam("status")),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: sessions, Cursor: cursor, Count: len(sessions)})
+}
+
+// RevokeUserSessions : force logout of a user, from one session when id is given or else from all of them
+func (h Handler) RevokeUserSessions(c echo.Context) error {
+	admin := c.Get("ADMIN").(entity.Admin)
+
+	userID, err := primitive.ObjectIDFromHex(c.QueryParam("userId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("invalid userId")})
+	}
+
+	var sessionID *primitive.ObjectID
+	if id := c.QueryParam("id"); id != "" {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidQueryString, Error: fmt.Errorf("invalid id")})
+		}
+		sessionID = &oid
+	}
+
+	if _, err := h.repository.RevokeSessions(c.Request().Context(), &userID, sessionID, admin.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ValidateSession : the session must be active and belong to the user of the token
+func ValidateSession(h Handler, ctx context.Context, ID string, userID string) (*entity.Session, int, *response.Exception) {
+	session, err := h.repository.FindSessionByID(ctx, ID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return &entity.Session{}, http.StatusUnauthorized, &response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("session %s not found", ID)}
+		}
+		return &entity.Session{}, http.StatusUnauthorized, &response.Exception{Code: errcode.InvalidToken, Error: err}
+	}
+
+	if session.UserID.Hex() != userID {
+		return &entity.Session{}, http.StatusUnauthorized, &response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("session %s user mismatch", ID)}
+	}
+
+	if session.Status != entity.SessionStatusActive {
+		return &entity.Session{}, http.StatusUnauthorized, &response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("session %s revoked", ID)}
+	}
+	return session, http.StatusOK, nil
+}
+
+// currentSession : session of the access token of the request
+func currentSession(c echo.Context) (*entity.Session, int, *response.Exception) {
+	sessionData := c.Get("SESSION")
+	if sessionData == nil {
+		return nil, http.StatusUnauthorized, &response.Exception{Code: errcode.MissingAccessToken}
+	}
+	session := sessionData.(entity.Session)
+	return &session, http.StatusOK, nil
+}
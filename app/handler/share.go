@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/kit/general"
+	"csi-api/app/kit/random"
+	"csi-api/app/repository"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SharedAssessment : what a corporate sees of an assessment, score, entries and evidences depend on the scopes
+// of its share
+type SharedAssessment struct {
+	ID             *primitive.ObjectID       `json:"id"`
+	SMEID          *primitive.ObjectID       `json:"smeID"`
+	SerialNo       string                    `json:"serialNo"`
+	PeriodStart    time.Time                 `json:"periodStart"`
+	PeriodEnd      time.Time                 `json:"periodEnd"`
+	CompletionDate time.Time                 `json:"completionDate"`
+	ReviewStatus   entity.ReviewStatus       `json:"reviewStatus"`
+	Share          entity.AssessmentShare    `json:"share"`
+	Score          *entity.AssessmentScore   `json:"score,omitempty"`
+	Entries        []*entity.AssessmentEntry `json:"entries,omitempty"`
+	Evidences      []*entity.Evidence        `json:"evidences,omitempty"`
+}
+
+// ShareAssessment : the SME grants a connected corporate access to the scopes of an assessment until expiresAt,
+// sharing again replaces the earlier grant
+func (h Handler) ShareAssessment(c echo.Context) error {
+	var i struct {
+		AssessmentID string              `json:"assessmentId" form:"assessmentId" validate:"required,max=50"`
+		CorporateID  string              `json:"corporateId" form:"corporateId" validate:"required,max=50"`
+		Scopes       []entity.ShareScope `json:"scopes" form:"scopes" validate:"required,min=1,dive,eq=SCORE|eq=ANSWERS|eq=EVIDENCE"`
+		ExpiresAt    time.Time           `json:"expiresAt" form:"expiresAt" validate:"required"`
+	}
+
+	// bind req input
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	// validate
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	timeNow := time.Now().UTC()
+	if !i.ExpiresAt.After(timeNow) {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("expiresAt must be in the future")})
+	}
+
+	// consent comes from the sme itself
+	smeUserData := c.Get("SME_ADMIN")
+	if smeUserData == nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("only the sme can share its assessments")})
+	}
+	smeUser := smeUserData.(entity.SMEUser)
+
+	assessment, httpStatus, exception := ValidateAssessment(h, c.Request().Context(), i.AssessmentID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if httpStatus, exception := checkTenant(c, assessment.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	corporate, httpStatus, exception := ValidateCorporate(h, c.Request().Context(), i.CorporateID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	sme, httpStatus, exception := ValidateSME(h, c.Request().Context(), assessment.SMEID.Hex())
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// assessments are shared within the supply chain only
+	connected := false
+	for _, link := range sme.LinkedWiths {
+		if link.CorporateID != nil && link.CorporateID.Hex() == corporate.ID.Hex() && link.Status == entity.StatusActive {
+			connected = true
+		}
+	}
+	if !connected {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.CorporateNotConnected, Error: fmt.Errorf("sme %s is not connected with corporate %s", sme.ID.Hex(), corporate.ID.Hex())})
+	}
+
+	scopes := make([]entity.ShareScope, 0, len(i.Scopes))
+	for _, scope := range i.Scopes {
+		if !random.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	share := entity.AssessmentShare{
+		CorporateID: corporate.ID,
+		LinkDate:    timeNow,
+		Status:      entity.StatusActive,
+		Scopes:      scopes,
+		ExpiresAt:   i.ExpiresAt.UTC(),
+		GrantedBy:   smeUser.ID,
+	}
+
+	if err := h.repository.GrantAssessmentShare(c.Request().Context(), assessment.ID, share); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: share})
+}
+
+// RevokeAssessmentShare : the SME, or an admin, withdraws the access of a corporate to an assessment
+func (h Handler) RevokeAssessmentShare(c echo.Context) error {
+	assessmentID := c.QueryParam("assessmentId")
+
+	assessment, err := h.repository.FindAssessmentByID(c.Request().Context(), assessmentID)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.RecordNotFound, Error: fmt.Errorf("assessment %s not found", assessmentID)})
+		}
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if httpStatus, exception := checkTenant(c, assessment.SMEID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	corporateID, err := primitive.ObjectIDFromHex(c.QueryParam("corporateId"))
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: fmt.Errorf("invalid corporateId")})
+	}
+
+	result, err := h.repository.RevokeAssessmentShare(c.Request().Context(), assessment.ID, &corporateID, actingUserID(c))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, response.Exception{Code: errcode.AssessmentNotShared, Error: fmt.Errorf("assessment %s is not shared with corporate %s", assessmentID, corporateID.Hex())})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// GetSharedAssessments : assessments currently shared with the corporate of the user, without their data
+func (h Handler) GetSharedAssessments(c echo.Context) error {
+	corporateID := corporateTenantID(c)
+	if corporateID == nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("not a corporate user")})
+	}
+
+	timeNow := time.Now().UTC()
+	assessments, cursor, err := h.repository.FindAssessments(c.Request().Context(), repository.FindAssessmentFilter{
+		Cursor:       c.QueryParam("cursor"),
+		SMEID:        c.QueryParam("smeId"),
+		SharedWiths:  []string{corporateID.Hex()},
+		SharedStatus: entity.StatusActive,
+		SharedAt:     timeNow,
+		Status:       entity.StatusActive,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	shared := make([]SharedAssessment, 0, len(assessments))
+	for _, assessment := range assessments {
+		if share := activeShare(assessment, corporateID.Hex(), timeNow); share != nil {
+			shared = append(shared, sharedAssessment(assessment, share))
+		}
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: shared, Cursor: cursor, Count: len(shared)})
+}
+
+// GetSharedAssessment : an assessment with the data its share grants to the corporate of the user, every call is
+// logged for the SME
+func (h Handler) GetSharedAssessment(c echo.Context) error {
+	corporateID := corporateTenantID(c)
+	if corporateID == nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("not a corporate user")})
+	}
+
+	assessment, httpStatus, exception := ValidateAssessment(h, c.Request().Context(), c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	share := activeShare(assessment, corporateID.Hex(), time.Now().UTC())
+	if share == nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.AssessmentNotShared, Error: fmt.Errorf("assessment %s is not shared with corporate %s", assessment.ID.Hex(), corporateID.Hex())})
+	}
+
+	result := sharedAssessment(assessment, share)
+	if random.Contains(share.Scopes, entity.ShareScopeScore) {
+		result.Score = assessment.Score
+	}
+	if random.Contains(share.Scopes, entity.ShareScopeAnswers) {
+		entries, err := findAllAssessmentEntries(c.Request().Context(), h, repository.FindAssessmentEntryFilter{
+			AssessmentID: assessment.ID.Hex(),
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		for _, entry := range entries {
+			// reviewer notes stay with the sme
+			entry.Comment = ""
+			entry.History = nil
+		}
+		result.Entries = entries
+	}
+	if random.Contains(share.Scopes, entity.ShareScopeEvidence) {
+		evidences, err := findAllEvidences(c.Request().Context(), h, repository.FindEvidenceFilter{
+			AssessmentID: assessment.ID.Hex(),
+			Status:       entity.StatusActive,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		result.Evidences = evidences
+	}
+
+	if err := logShareAccess(c, h, assessment, share.Scopes, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: result})
+}
+
+// DownloadSharedEvidence : evidence of an assessment shared with the EVIDENCE scope, every download is logged
+func (h Handler) DownloadSharedEvidence(c echo.Context) error {
+	corporateID := corporateTenantID(c)
+	if corporateID == nil {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("not a corporate user")})
+	}
+
+	evidence, httpStatus, exception := ValidateEvidence(h, c.Request().Context(), c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	assessment, httpStatus, exception := ValidateAssessment(h, c.Request().Context(), evidence.AssessmentID.Hex())
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	share := activeShare(assessment, corporateID.Hex(), time.Now().UTC())
+	if share == nil || !random.Contains(share.Scopes, entity.ShareScopeEvidence) {
+		return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.AssessmentNotShared, Error: fmt.Errorf("evidence of assessment %s is not shared with corporate %s", assessment.ID.Hex(), corporateID.Hex())})
+	}
+
+	if err := logShareAccess(c, h, assessment, []entity.ShareScope{entity.ShareScopeEvidence}, evidence.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.Attachment(general.StoragePath(evidence.Path), evidence.FileName)
+}
+
+// GetShareAccessLogs : who viewed the shared assessments of an SME
+func (h Handler) GetShareAccessLogs(c echo.Context) error {
+	// sme users see the log of their own company
+	smeID, httpStatus, exception := tenantFilter(c, c.QueryParam("smeId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	logs, cursor, err := h.repository.FindShareAccessLogs(c.Request().Context(), repository.FindShareAccessLogFilter{
+		Cursor:       c.QueryParam("cursor"),
+		AssessmentID: c.QueryParam("assessmentId"),
+		SMEID:        smeID,
+		CorporateID:  c.QueryParam("corporateId"),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Items{Items: logs, Cursor: cursor, Count: len(logs)})
+}
+
+// activeShare : share of the assessment with the corporate which is active and not expired at the given time,
+// nil when there is none
+func activeShare(assessment *entity.Assessment, corporateID string, at time.Time) *entity.AssessmentShare {
+	for i, s := range assessment.SharedWiths {
+		if s.CorporateID != nil && s.CorporateID.Hex() == corporateID && s.Status == entity.StatusActive && s.ExpiresAt.After(at) {
+			return &assessment.SharedWiths[i]
+		}
+	}
+	return nil
+}
+
+// sharedAssessment : the parts of an assessment every share shows
+func sharedAssessment(assessment *entity.Assessment, share *entity.AssessmentShare) SharedAssessment {
+	return SharedAssessment{
+		ID:             assessment.ID,
+		SMEID:          assessment.SMEID,
+		SerialNo:       assessment.SerialNo,
+		PeriodStart:    assessment.PeriodStart,
+		PeriodEnd:      assessment.PeriodEnd,
+		CompletionDate: assessment.CompletionDate,
+		ReviewStatus:   assessment.ReviewStatus,
+		Share:          *share,
+	}
+}
+
+// logShareAccess : record a corporate user viewing shared data
+func logShareAccess(c echo.Context, h Handler, assessment *entity.Assessment, scopes []entity.ShareScope, evidenceID *primitive.ObjectID) error {
+	var userID *primitive.ObjectID
+	if corporateUserData := c.Get("CORPORATE_USER"); corporateUserData != nil {
+		userID = corporateUserData.(entity.CorporateUser).ID
+	}
+
+	logID := primitive.NewObjectID()
+	_, err := h.repository.CreateShareAccessLog(c.Request().Context(), entity.ShareAccessLog{
+		ID:           &logID,
+		AssessmentID: assessment.ID,
+		SMEID:        assessment.SMEID,
+		CorporateID:  corporateTenantID(c),
+		UserID:       userID,
+		Scopes:       scopes,
+		EvidenceID:   evidenceID,
+		IPAddress:    c.RealIP(),
+		AccessedAt:   time.Now().UTC(),
+	})
+	return err
+}
+
+// findAllEvidences : walk through every page of evidences matching the filter
+func findAllEvidences(c context.Context, h Handler, filter repository.FindEvidenceFilter) ([]*entity.Evidence, error) {
+	var evidences []*entity.Evidence
+	for {
+		result, nextCursor, err := h.repository.FindEvidences(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		evidences = append(evidences, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return evidences, nil
+}
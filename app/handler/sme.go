@@ -19,10 +19,31 @@ import (
 
 // GetSMEs :
 func (h Handler) GetSMEs(c echo.Context) error {
+	ids := c.Request().URL.Query()["id"]
+	linkedWiths := c.Request().URL.Query()["linkedWith"]
+
+	// sme users see their own company, or the smes linked with it
+	var httpStatus int
+	var exception *response.Exception
+	if len(linkedWiths) > 0 {
+		linkedWiths, httpStatus, exception = tenantFilterIDs(c, linkedWiths)
+	} else {
+		ids, httpStatus, exception = tenantFilterIDs(c, ids)
+	}
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// corporate users only see the smes linked with their corporate
+	linkedWiths, httpStatus, exception = corporateTenantFilterIDs(c, linkedWiths)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	smes, cursor, err := h.repository.FindSMEs(c.Request().Context(), repository.FindSMEFilter{
 		Cursor:      c.QueryParam("cursor"),
-		IDs:         c.Request().URL.Query()["id"],
-		LinkedWiths: c.Request().URL.Query()["linkedWith"],
+		IDs:         ids,
+		LinkedWiths: linkedWiths,
 		SSMNumbers:  c.Request().URL.Query()["ssmNumber"],
 		CompanyName: c.QueryParam("companyName"),
 		Status:      entity.Status(c.QueryParam("status")),
@@ -41,23 +62,18 @@ func (h Handler) GetSMEs(c echo.Context) error {
 func (h Handler) UpdateSME(c echo.Context) error {
 	smeId := c.QueryParam("id")
 	var i struct {
-		CompanyName          string   `json:"companyName" form:"companyName" validate:"max=50"`
-		SSMNumber            string   `json:"ssmNumber" form:"ssmNumber" validate:"max=12"`
-		BusinessEntity       string   `json:"businessEntity" form:"businessEntity"`
-		RegisteredInEastMY   bool     `json:"registeredInEastMy" form:"registeredInEastMy"`
-		EducationType        string   `json:"educationType" form:"educationType"`
-		State                string   `json:"state" form:"state" validate:"max=40"`
-		PostCode             string   `json:"postCode" form:"postCode"  validate:"max=5"`
-		MSIC                 string   `json:"msic" form:"msic" validate:"msic,max=10"`
-		Industry             string   `json:"industry" form:"industry"  validate:"max=40"`
-		ApprovedBy           string   `json:"approvedBy" form:"approvedBy"`
-		ParticipatedLearning []string `json:"participatedLearning" form:"participatedLearning"`
-		LinkedWiths          []struct {
-			CorporateID string        `bson:"corporateID" json:"corporateID" form:"corporateID" validate:"max=50"`
-			LinkDate    time.Time     `bson:"linkDate" json:"linkDate" form:"linkDate"`
-			Status      entity.Status `bson:"status" json:"status" form:"status" validate:"eq=INVITED|eq=ACTIVE|eq=INACTIVE"`
-		} `json:"linkedWiths" form:"linkedWiths" validate:"dive,max=50,required"`
-		Status entity.Status `json:"status" form:"status"`
+		CompanyName          string        `json:"companyName" form:"companyName" validate:"max=50"`
+		SSMNumber            string        `json:"ssmNumber" form:"ssmNumber" validate:"max=12"`
+		BusinessEntity       string        `json:"businessEntity" form:"businessEntity"`
+		RegisteredInEastMY   bool          `json:"registeredInEastMy" form:"registeredInEastMy"`
+		EducationType        string        `json:"educationType" form:"educationType"`
+		State                string        `json:"state" form:"state" validate:"max=40"`
+		PostCode             string        `json:"postCode" form:"postCode"  validate:"max=5"`
+		MSIC                 string        `json:"msic" form:"msic" validate:"msic,max=10"`
+		Industry             string        `json:"industry" form:"industry"  validate:"max=40"`
+		ApprovedBy           string        `json:"approvedBy" form:"approvedBy"`
+		ParticipatedLearning []string      `json:"participatedLearning" form:"participatedLearning"`
+		Status               entity.Status `json:"status" form:"status"`
 	}
 
 	// bind req input
@@ -83,6 +99,10 @@ func (h Handler) UpdateSME(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
+	if httpStatus, exception := checkTenant(c, sme.ID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	if i.CompanyName != "" {
 		sme.CompanyName = i.CompanyName
 	}
@@ -145,31 +165,6 @@ func (h Handler) UpdateSME(c echo.Context) error {
 		sme.ApprovedBy = &approvedBy
 	}
 
-	linkedWiths := []entity.LinkCorporate{}
-	if len(i.LinkedWiths) > 0 {
-		for _, linkwith := range i.LinkedWiths {
-			_, httpStatus, exception := ValidateSME(h, c.Request().Context(), linkwith.CorporateID)
-			if exception != nil {
-				return c.JSON(httpStatus, exception)
-			}
-
-			corporateID, err := primitive.ObjectIDFromHex(linkwith.CorporateID)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, response.Exception{
-					Code:  errcode.ServerError,
-					Error: err,
-				})
-			}
-
-			linkedWiths = append(linkedWiths, entity.LinkCorporate{
-				CorporateID: &corporateID,
-				LinkDate:    linkwith.LinkDate,
-				Status:      linkwith.Status,
-			})
-		}
-	}
-	sme.LinkedWiths = linkedWiths
-
 	if len(i.ParticipatedLearning) > 0 {
 		participatedLearning := []*primitive.ObjectID{}
 		for _, id := range i.ParticipatedLearning {
@@ -246,6 +241,10 @@ func (h Handler) DeleteSME(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
+	if httpStatus, exception := checkTenant(c, sme.ID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	if _, err := h.repository.DeleteSMEByID(sme); err != nil {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
@@ -399,3 +398,21 @@ func ValidateSME(h Handler, ctx context.Context, companyID string) (*entity.SME,
 	}
 	return sme, http.StatusOK, nil
 }
+
+// findAllSMEs : walk through every page of SMEs matching the filter
+func findAllSMEs(c context.Context, h Handler, filter repository.FindSMEFilter) ([]*entity.SME, error) {
+	var smes []*entity.SME
+	for {
+		result, nextCursor, err := h.repository.FindSMEs(c, filter)
+		if err != nil {
+			return nil, err
+		}
+		smes = append(smes, result...)
+		if nextCursor == "0" {
+			break
+		} else {
+			filter.Cursor = nextCursor
+		}
+	}
+	return smes, nil
+}
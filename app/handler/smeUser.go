@@ -10,7 +10,6 @@ import (
 	"csi-api/app/entity"
 	"csi-api/app/env"
 	"csi-api/app/kit/general"
-	"csi-api/app/kit/jwt"
 	"csi-api/app/kit/password"
 	"csi-api/app/repository"
 	"csi-api/app/response"
@@ -34,13 +33,18 @@ func (h Handler) GetSMEUserByToken(c echo.Context) error {
 
 // GetSMEUsers :
 func (h Handler) GetSMEUsers(c echo.Context) error {
+	companyID, httpStatus, exception := tenantFilter(c, c.QueryParam("companyId"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	users, cursor, err := h.repository.FindSMEUsers(c.Request().Context(), repository.FindSMEUserFilter{
 		Cursor:    c.QueryParam("cursor"),
 		IDs:       c.Request().URL.Query()["Id"],
 		Emails:    c.Request().URL.Query()["email"],
 		FirstName: c.QueryParam("firstName"),
 		LastName:  c.QueryParam("lastName"),
-		CompanyID: c.QueryParam("companyId"),
+		CompanyID: companyID,
 		Status:    entity.UserStatus(c.QueryParam("status")),
 	})
 	if err != nil {
@@ -89,6 +93,10 @@ func (h Handler) UpdateSMEUser(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
 	}
 
+	if httpStatus, exception := checkTenant(c, user.CompanyID); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	if i.FirstName != "" {
 		user.FirstName = i.FirstName
 	}
@@ -202,7 +210,7 @@ func (h Handler) CreateSMEUser(c echo.Context) error {
 		ApprovedBy    string          `json:"approvedBy" form:"approvedBy"`
 		Password      string          `json:"password" form:"password" validate:"required,min=6,max=20"`
 		Role          entity.UserRole `json:"role" form:"role" validate:"required,role"`
-		Status        string          `json:"status" form:"status" validate:"required,eq=ACTIVE|eq=INACTIVE"`
+		Status        string          `json:"status" form:"status" validate:"required,eq=ACTIVE|eq=INACTIVE|eq=UNVERIFIED"`
 	}
 
 	// bind req input
@@ -221,6 +229,24 @@ func (h Handler) CreateSMEUser(c echo.Context) error {
 	i.ApprovedBy = strings.TrimSpace(i.ApprovedBy)
 	maxUser := 3
 
+	// sme users add users to their own company
+	companyID, httpStatus, exception := tenantFilter(c, i.CompanyID)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	i.CompanyID = companyID
+
+	// only admins choose the status, everyone else has to verify the email first
+	if c.Get("ADMIN") == nil {
+		i.Status = string(entity.UserStatusUnverified)
+	}
+
+	// self registration creates a plain user
+	selfRegister := c.Get("ADMIN") == nil && tenantID(c) == nil
+	if selfRegister {
+		i.Role = entity.UserRoleUser
+	}
+
 	// validate
 	if err := c.Validate(&i); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
@@ -235,6 +261,19 @@ func (h Handler) CreateSMEUser(c echo.Context) error {
 	} else if sme.Status != entity.StatusActive {
 		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("SME %s status inactive", i.CompanyID)})
 	}
+
+	// only a newly registered company can be joined without an invitation
+	if selfRegister {
+		members, _, err := h.repository.FindSMEUsers(c.Request().Context(), repository.FindSMEUserFilter{
+			CompanyID: i.CompanyID,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if len(members) > 0 {
+			return c.JSON(http.StatusForbidden, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("SME %s already has users, ask one of them for an invitation", i.CompanyID)})
+		}
+	}
 	
 	// check if user exists
 	exists, _ := h.repository.FindSMEUserByEmail(c.Request().Context(), i.Email)
@@ -344,6 +383,12 @@ func (h Handler) CreateSMEUser(c echo.Context) error {
 		})
 	}
 
+	if user.Status == entity.UserStatusUnverified {
+		if httpStatus, exception := sendVerificationEmail(&user); exception != nil {
+			return c.JSON(httpStatus, exception)
+		}
+	}
+
 	// SME user self register
 	// if i.ApprovedBy == "" {
 	// 	content :=
@@ -419,15 +464,25 @@ func (h Handler) SMEUserLogin(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
 
+	if httpStatus, exception := checkLogin(c, h, entity.AccountTypeSMEUser, i.Email); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	// check if user exists
 	user, err := h.repository.FindSMEUserByEmail(c.Request().Context(), i.Email)
 	if err != nil {
+		if err := loginFailed(c, h, entity.AccountTypeSMEUser, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
 		return c.JSON(http.StatusBadRequest, response.Exception{
 			Code:  errcode.UserNotFound,
 			Error: err,
 		})
 	}
 	// check user status
+	if user.Status == entity.UserStatusUnverified {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.EmailNotVerified, Error: fmt.Errorf("SME user %s has not verified the email", i.Email)})
+	}
 	if user.Status != entity.UserStatusActive {
 		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.StatusInActive, Error: fmt.Errorf("SME user %s status inactive", i.Email)})
 	}
@@ -445,18 +500,25 @@ func (h Handler) SMEUserLogin(c echo.Context) error {
 	// compare password & return error if password is not same
 	salt, pepper := user.PasswordSalt, env.Config.Jwt.Secret
 	if isSame := password.Compare(i.Password, salt, pepper, user.PasswordHash); !isSame {
+		if err := loginFailed(c, h, entity.AccountTypeSMEUser, i.Email); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
 		return c.JSON(http.StatusBadRequest, response.Exception{
 			Code: errcode.AuthenticationError,
 		})
 	}
 
+	if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeSMEUser, i.Email); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
 	// convert to string array
 	scopes := []string{}
 	s := fmt.Sprintf("%v", user.Role)
 	scopes = append(scopes, s)
 
 	// generate token pair
-	tokens, err := jwt.GenerateTokens(env.Config.Jwt.Secret, map[string]string{
+	tokens, err := issueTokens(c, h, user.ID, nil, nil, map[string]string{
 		"sub":    user.ID.Hex(),
 		"aud":    user.ID.Hex(),
 		"scopes": strings.Join(scopes, ","),
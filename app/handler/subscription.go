@@ -18,10 +18,20 @@ import (
 
 // GetSubscriptions :
 func (h Handler) GetSubscriptions(c echo.Context) error {
+	// sme and corporate users see the subscriptions of their own company
+	corporateIDs, httpStatus, exception := tenantFilterIDs(c, c.Request().URL.Query()["corporateId"])
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+	corporateIDs, httpStatus, exception = corporateTenantFilterIDs(c, corporateIDs)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
 	subscriptions, cursor, err := h.repository.FindSubscriptions(c.Request().Context(), repository.FindSubscriptionFilter{
 		Cursor:                    c.QueryParam("cursor"),
 		IDs:                       c.Request().URL.Query()["id"],
-		CorporateIDs:              c.Request().URL.Query()["corporateId"],
+		CorporateIDs:              corporateIDs,
 		PaymentStatus:             c.QueryParam("paymentStatus"),
 		SubscriptionStartBefore:   c.QueryParam("subscriptionStartBefore"),
 		SubscriptionStartAfter:    c.QueryParam("subscriptionStartAfter"),
@@ -88,11 +98,11 @@ func (h Handler) UpdateSubscription(c echo.Context) error {
 		return c.JSON(httpStatus, exception)
 	}
 
-	corporate, httpStatus, exception := ValidateSME(h, c.Request().Context(), i.CorporateID)
+	subscriberID, httpStatus, exception := validateSubscriber(h, c.Request().Context(), i.CorporateID)
 	if exception != nil {
 		return c.JSON(httpStatus, exception)
 	}
-	subscription.CorporateID = corporate.ID
+	subscription.CorporateID = subscriberID
 
 	if i.SubscriptionPlan != "" {
 		subscription.SubscriptionPlan = i.SubscriptionPlan
@@ -145,7 +155,7 @@ func (h Handler) UpdateSubscription(c echo.Context) error {
 	// check if receipt document is uploaded
 	if receipt, _ := c.FormFile("receipt"); receipt != nil {
 		// create path
-		path := fmt.Sprintf("corporate/%s/subscription/%s/receipt/", corporate.ID.Hex(), subscriptionId)
+		path := fmt.Sprintf("corporate/%s/subscription/%s/receipt/", subscriberID.Hex(), subscriptionId)
 
 		// push to s3 bucket
 		// url, httpStatus, exception := aws.PushDocBucket(path, receipt)
@@ -199,8 +209,8 @@ func (h Handler) CreateSubscription(c echo.Context) error {
 		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
 	}
 
-	// check if corporate exists
-	corporate, httpStatus, exception := ValidateSME(h, c.Request().Context(), i.CorporateID)
+	// check if the corporate or SME exists
+	subscriberID, httpStatus, exception := validateSubscriber(h, c.Request().Context(), i.CorporateID)
 	if exception != nil {
 		return c.JSON(httpStatus, exception)
 	}
@@ -219,7 +229,7 @@ func (h Handler) CreateSubscription(c echo.Context) error {
 
 	subscription := entity.Subscription{
 		ID:                    &subscriptionID,
-		CorporateID:           corporate.ID,
+		CorporateID:           subscriberID,
 		SubscriptionPlan:      i.SubscriptionPlan,
 		SubscriptionPeriod:    i.SubscriptionPeriod,
 		ActivationDate:        i.ActivationDate,
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"csi-api/app/entity"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// tenantID : company of the current sme user, nil for admins and vendors who are not bound to one company
+func tenantID(c echo.Context) *primitive.ObjectID {
+	if smeUserData := c.Get("SME_ADMIN"); smeUserData != nil {
+		return smeUserData.(entity.SMEUser).CompanyID
+	}
+	return nil
+}
+
+// tenantFilter : sme id a query or input of the current user is limited to. SME users always get their own
+// company, asking for another one is a mismatch. Everyone else gets the requested id.
+func tenantFilter(c echo.Context, smeID string) (string, int, *response.Exception) {
+	tenant := tenantID(c)
+	if tenant == nil {
+		return smeID, http.StatusOK, nil
+	}
+	if smeID != "" && smeID != tenant.Hex() {
+		return "", http.StatusBadRequest, &response.Exception{Code: errcode.MismatchSME, Error: fmt.Errorf("mismatch sme id")}
+	}
+	return tenant.Hex(), http.StatusOK, nil
+}
+
+// tenantFilterIDs : same as tenantFilter for a list of sme ids
+func tenantFilterIDs(c echo.Context, smeIDs []string) ([]string, int, *response.Exception) {
+	tenant := tenantID(c)
+	if tenant == nil {
+		return smeIDs, http.StatusOK, nil
+	}
+	for _, id := range smeIDs {
+		if id != tenant.Hex() {
+			return nil, http.StatusBadRequest, &response.Exception{Code: errcode.MismatchSME, Error: fmt.Errorf("mismatch sme id")}
+		}
+	}
+	return []string{tenant.Hex()}, http.StatusOK, nil
+}
+
+// checkTenant : sme users can only reach records of their own company
+func checkTenant(c echo.Context, smeID *primitive.ObjectID) (int, *response.Exception) {
+	if tenant := tenantID(c); tenant != nil {
+		if smeID == nil || smeID.Hex() != tenant.Hex() {
+			return http.StatusBadRequest, &response.Exception{Code: errcode.MismatchSME, Error: fmt.Errorf("mismatch sme id")}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// corporateTenantID : corporate of the current corporate user, nil for everyone else
+func corporateTenantID(c echo.Context) *primitive.ObjectID {
+	if corporateUserData := c.Get("CORPORATE_USER"); corporateUserData != nil {
+		return corporateUserData.(entity.CorporateUser).CompanyID
+	}
+	return nil
+}
+
+// corporateTenantFilter : corporate id a query or input of the current user is limited to, same as tenantFilter
+// for corporate users
+func corporateTenantFilter(c echo.Context, corporateID string) (string, int, *response.Exception) {
+	tenant := corporateTenantID(c)
+	if tenant == nil {
+		return corporateID, http.StatusOK, nil
+	}
+	if corporateID != "" && corporateID != tenant.Hex() {
+		return "", http.StatusBadRequest, &response.Exception{Code: errcode.MismatchCorporate, Error: fmt.Errorf("mismatch corporate id")}
+	}
+	return tenant.Hex(), http.StatusOK, nil
+}
+
+// corporateTenantFilterIDs : same as corporateTenantFilter for a list of corporate ids
+func corporateTenantFilterIDs(c echo.Context, corporateIDs []string) ([]string, int, *response.Exception) {
+	tenant := corporateTenantID(c)
+	if tenant == nil {
+		return corporateIDs, http.StatusOK, nil
+	}
+	for _, id := range corporateIDs {
+		if id != tenant.Hex() {
+			return nil, http.StatusBadRequest, &response.Exception{Code: errcode.MismatchCorporate, Error: fmt.Errorf("mismatch corporate id")}
+		}
+	}
+	return []string{tenant.Hex()}, http.StatusOK, nil
+}
+
+// checkCorporateTenant : corporate users can only reach records of their own corporate
+func checkCorporateTenant(c echo.Context, corporateID *primitive.ObjectID) (int, *response.Exception) {
+	if tenant := corporateTenantID(c); tenant != nil {
+		if corporateID == nil || corporateID.Hex() != tenant.Hex() {
+			return http.StatusBadRequest, &response.Exception{Code: errcode.MismatchCorporate, Error: fmt.Errorf("mismatch corporate id")}
+		}
+	}
+	return http.StatusOK, nil
+}
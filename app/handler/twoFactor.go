@@ -0,0 +1,430 @@
+package handler
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"csi-api/app/env"
+	"csi-api/app/kit/jwt"
+	"csi-api/app/kit/random"
+	"csi-api/app/kit/totp"
+	"csi-api/app/response"
+	"csi-api/app/response/errcode"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	twoFactorIssuer                   = "CSI"
+	twoFactorChallengeExpiresInMinute = 5
+	recoveryCodeCount                 = 10
+)
+
+// EnrollTwoFactorChallenge : start enrollment during a login which requires two factor authentication
+func (h Handler) EnrollTwoFactorChallenge(c echo.Context) error {
+	var i struct {
+		ChallengeToken string `json:"challengeToken" form:"challengeToken" validate:"required"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	admin, httpStatus, exception := challengeAdmin(h, c.Request().Context(), i.ChallengeToken)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if admin.TwoFactor.Enabled {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: fmt.Errorf("two factor authentication is already enabled")})
+	}
+
+	enrollment, err := startTwoFactorEnrollment(h, admin)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: enrollment})
+}
+
+// VerifyTwoFactorChallenge : second step of the login, issues tokens once the TOTP or a recovery code checks out.
+// A code of a pending enrollment activates two factor authentication and returns the recovery codes as well.
+func (h Handler) VerifyTwoFactorChallenge(c echo.Context) error {
+	var i struct {
+		ChallengeToken string `json:"challengeToken" form:"challengeToken" validate:"required"`
+		Code           string `json:"code" form:"code" validate:"max=10"`
+		RecoveryCode   string `json:"recoveryCode" form:"recoveryCode" validate:"max=20"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	admin, httpStatus, exception := challengeAdmin(h, c.Request().Context(), i.ChallengeToken)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	// wrong codes count as failed logins of the account
+	if httpStatus, exception := checkLogin(c, h, entity.AccountTypeAdmin, admin.Email); exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	var recoveryCodes []string
+	if admin.TwoFactor.Enabled {
+		if !checkSecondFactor(admin, i.Code, i.RecoveryCode) {
+			if err := loginFailed(c, h, entity.AccountTypeAdmin, admin.Email); err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidTwoFactorCode})
+		}
+		admin.UpdatedAt = time.Now().UTC()
+		if _, err := h.repository.UpsertAdmin(admin); err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+	} else {
+		codes, ok, err := activateTwoFactor(h, admin, i.Code)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+		}
+		if !ok {
+			if err := loginFailed(c, h, entity.AccountTypeAdmin, admin.Email); err != nil {
+				return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+			}
+			return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidTwoFactorCode})
+		}
+		recoveryCodes = codes
+	}
+
+	if err := loginSucceeded(c.Request().Context(), h, entity.AccountTypeAdmin, admin.Email); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	tokens, err := issueTokens(c, h, admin.ID, nil, nil, adminTokenClaims(admin))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if recoveryCodes != nil {
+		tokens["recoveryCodes"] = recoveryCodes
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: tokens})
+}
+
+// EnrollTwoFactor : start enrollment of the current admin or vendor, returns the secret and the QR code uri
+func (h Handler) EnrollTwoFactor(c echo.Context) error {
+	admin, httpStatus, exception := currentAdmin(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if admin.TwoFactor.Enabled {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: fmt.Errorf("two factor authentication is already enabled")})
+	}
+
+	enrollment, err := startTwoFactorEnrollment(h, admin)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: enrollment})
+}
+
+// ActivateTwoFactor : confirm the enrollment with the first code, returns the recovery codes
+func (h Handler) ActivateTwoFactor(c echo.Context) error {
+	var i struct {
+		Code string `json:"code" form:"code" validate:"required,max=10"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	admin, httpStatus, exception := currentAdmin(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if admin.TwoFactor.Enabled {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: fmt.Errorf("two factor authentication is already enabled")})
+	}
+
+	codes, ok, err := activateTwoFactor(h, admin, i.Code)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+	if !ok {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidTwoFactorCode})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: map[string]interface{}{"recoveryCodes": codes}})
+}
+
+// RegenerateRecoveryCodes : replace all recovery codes, the old ones stop working
+func (h Handler) RegenerateRecoveryCodes(c echo.Context) error {
+	var i struct {
+		Code string `json:"code" form:"code" validate:"required,max=10"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	admin, httpStatus, exception := currentAdmin(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if !admin.TwoFactor.Enabled || !checkSecondFactor(admin, i.Code, "") {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidTwoFactorCode})
+	}
+
+	codes, err := newRecoveryCodes(admin)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	admin.UpdatedAt = time.Now().UTC()
+	if _, err := h.repository.UpsertAdmin(admin); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: map[string]interface{}{"recoveryCodes": codes}})
+}
+
+// DisableTwoFactor : turn off two factor authentication of the current admin or vendor, not allowed for superAdmin
+func (h Handler) DisableTwoFactor(c echo.Context) error {
+	var i struct {
+		Code string `json:"code" form:"code" validate:"required,max=10"`
+	}
+
+	if err := c.Bind(&i); err != nil {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidRequest, Error: err})
+	}
+
+	if err := c.Validate(&i); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, response.Exception{Code: errcode.ValidationError, Error: err})
+	}
+
+	admin, httpStatus, exception := currentAdmin(c, h)
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	if admin.Role == entity.UserRoleAdmin {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("two factor authentication is mandatory for super admin")})
+	}
+
+	if !admin.TwoFactor.Enabled || !checkSecondFactor(admin, i.Code, "") {
+		return c.JSON(http.StatusBadRequest, response.Exception{Code: errcode.InvalidTwoFactorCode})
+	}
+
+	admin.TwoFactor = entity.TwoFactor{}
+	admin.UpdatedAt = time.Now().UTC()
+	if _, err := h.repository.UpsertAdmin(admin); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// ResetTwoFactor : clear two factor authentication of an admin or vendor who lost the device and the recovery
+// codes, they enroll again at the next login. Sessions of the user are revoked.
+func (h Handler) ResetTwoFactor(c echo.Context) error {
+	currentAdmin := c.Get("ADMIN").(entity.Admin)
+
+	admin, httpStatus, exception := ValidateAdmin(h, c.Request().Context(), c.QueryParam("id"))
+	if exception != nil {
+		return c.JSON(httpStatus, exception)
+	}
+
+	admin.TwoFactor = entity.TwoFactor{}
+	admin.UpdatedAt = time.Now().UTC()
+	if _, err := h.repository.UpsertAdmin(admin); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	if _, err := h.repository.RevokeSessions(c.Request().Context(), admin.ID, nil, currentAdmin.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+// twoFactorRequired : superAdmin must use two factor authentication, other admins and vendors can opt in
+func twoFactorRequired(admin *entity.Admin) bool {
+	return admin.TwoFactor.Enabled || admin.Role == entity.UserRoleAdmin
+}
+
+// twoFactorChallenge : answer of a login which needs a TOTP code, tokens are only issued by the verify step
+func twoFactorChallenge(c echo.Context, admin *entity.Admin) error {
+	token, err := jwt.GenerateLinkToken(env.Config.Jwt.Secret, jwt.TokenTypeTwoFactor, time.Minute*twoFactorChallengeExpiresInMinute, map[string]string{
+		"aud": admin.ID.Hex(),
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, response.Exception{Code: errcode.ServerError, Error: err})
+	}
+
+	return c.JSON(http.StatusOK, response.Item{Item: map[string]interface{}{
+		"twoFactorRequired":  true,
+		"enrollmentRequired": !admin.TwoFactor.Enabled,
+		"challengeToken":     token,
+		"expiresIn":          twoFactorChallengeExpiresInMinute * 60,
+	}})
+}
+
+// adminTokenClaims : claims of the tokens of an admin or vendor, the role followed by the assigned scopes
+func adminTokenClaims(admin *entity.Admin) map[string]string {
+	scopes := []string{fmt.Sprintf("%v", admin.Role)}
+	for _, scope := range admin.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+
+	return map[string]string{
+		"sub":    admin.ID.Hex(),
+		"aud":    admin.ID.Hex(),
+		"scopes": strings.Join(scopes, ","),
+	}
+}
+
+// challengeAdmin : admin of a two factor challenge token
+func challengeAdmin(h Handler, ctx context.Context, token string) (*entity.Admin, int, *response.Exception) {
+	invalid := &response.Exception{Code: errcode.InvalidToken, Error: fmt.Errorf("login challenge is invalid or has expired")}
+
+	claims, err := jwt.Validate(strings.TrimSpace(token))
+	if err != nil {
+		return nil, http.StatusUnauthorized, invalid
+	}
+
+	if ok := claims.VerifyIssuer(env.Config.Jwt.Issuer, true); !ok {
+		return nil, http.StatusUnauthorized, invalid
+	}
+
+	reqClaims, err := jwt.ExtractClaims(claims)
+	if err != nil || reqClaims.Type != jwt.TokenTypeTwoFactor {
+		return nil, http.StatusUnauthorized, invalid
+	}
+
+	if isExpired, err := jwt.IsTokenExpired(reqClaims.Exp); err != nil || isExpired {
+		return nil, http.StatusUnauthorized, invalid
+	}
+
+	return ValidateAdmin(h, ctx, reqClaims.Audience)
+}
+
+// currentAdmin : admin or vendor of the access token, loaded again since c.Get holds the copy made when the request
+// started and may carry a stale TwoFactor
+func currentAdmin(c echo.Context, h Handler) (*entity.Admin, int, *response.Exception) {
+	adminData := c.Get("ADMIN")
+	if adminData == nil {
+		return nil, http.StatusBadRequest, &response.Exception{Code: errcode.InvalidAccess, Error: fmt.Errorf("two factor authentication is only available to admins and vendors")}
+	}
+	return ValidateAdmin(h, c.Request().Context(), adminData.(entity.Admin).ID.Hex())
+}
+
+// startTwoFactorEnrollment : store a new pending secret and return the data of the QR code
+func startTwoFactorEnrollment(h Handler, admin *entity.Admin) (map[string]interface{}, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	admin.TwoFactor.PendingSecret = secret
+	admin.UpdatedAt = time.Now().UTC()
+	if _, err := h.repository.UpsertAdmin(admin); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"secret":          secret,
+		"provisioningUri": totp.ProvisioningURI(twoFactorIssuer, admin.Email, secret),
+	}, nil
+}
+
+// activateTwoFactor : enable two factor authentication when the code matches the pending secret, returns the
+// recovery codes which are only shown this once
+func activateTwoFactor(h Handler, admin *entity.Admin, code string) ([]string, bool, error) {
+	if admin.TwoFactor.PendingSecret == "" {
+		return nil, false, nil
+	}
+
+	timeNow := time.Now().UTC()
+	step, ok := totp.Validate(admin.TwoFactor.PendingSecret, code, timeNow)
+	if !ok {
+		return nil, false, nil
+	}
+
+	admin.TwoFactor.Enabled = true
+	admin.TwoFactor.EnabledAt = timeNow
+	admin.TwoFactor.Secret = admin.TwoFactor.PendingSecret
+	admin.TwoFactor.PendingSecret = ""
+	admin.TwoFactor.LastUsedStep = step
+
+	codes, err := newRecoveryCodes(admin)
+	if err != nil {
+		return nil, false, err
+	}
+
+	admin.UpdatedAt = timeNow
+	if _, err := h.repository.UpsertAdmin(admin); err != nil {
+		return nil, false, err
+	}
+	return codes, true, nil
+}
+
+// checkSecondFactor : check a TOTP code, or else a recovery code which is then used up. The admin is updated
+// and has to be saved by the caller.
+func checkSecondFactor(admin *entity.Admin, code string, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(admin.TwoFactor.Secret, code, time.Now().UTC())
+		if !ok || step <= admin.TwoFactor.LastUsedStep {
+			return false
+		}
+		admin.TwoFactor.LastUsedStep = step
+		return true
+	}
+
+	if recoveryCode != "" {
+		hash := random.HashToken(totp.NormalizeRecoveryCode(recoveryCode))
+		for n, stored := range admin.TwoFactor.RecoveryCodes {
+			if stored == hash {
+				admin.TwoFactor.RecoveryCodes = append(admin.TwoFactor.RecoveryCodes[:n], admin.TwoFactor.RecoveryCodes[n+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newRecoveryCodes : replace the recovery codes of the admin, only the hashes are kept
+func newRecoveryCodes(admin *entity.Admin) ([]string, error) {
+	codes, err := totp.RecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	admin.TwoFactor.RecoveryCodes = make([]string, 0, len(codes))
+	for _, code := range codes {
+		admin.TwoFactor.RecoveryCodes = append(admin.TwoFactor.RecoveryCodes, random.HashToken(code))
+	}
+	return codes, nil
+}
@@ -0,0 +1,195 @@
+package answer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"csi-api/app/entity"
+	"csi-api/app/kit/random"
+)
+
+const (
+	dateLayout    = "2006-01-02"
+	percentageMin = 0.0
+	percentageMax = 100.0
+)
+
+// QuestionTypes : every supported question type
+var QuestionTypes = []entity.QuestionType{
+	entity.QuestionTypePsychographic,
+	entity.QuestionTypeDemographic,
+	entity.QuestionTypeUpload,
+	entity.QuestionTypeNumeric,
+	entity.QuestionTypeSingleChoice,
+	entity.QuestionTypeMultiChoice,
+	entity.QuestionTypeDate,
+	entity.QuestionTypePercentage,
+	entity.QuestionTypeMatrix,
+}
+
+// ValidateQuestion : check the question has what its type needs to be answered
+func ValidateQuestion(question *entity.Question) error {
+	if !random.Contains(QuestionTypes, question.QuestionType) {
+		return fmt.Errorf("invalid question type %s", question.QuestionType)
+	}
+
+	switch question.QuestionType {
+	case entity.QuestionTypeSingleChoice, entity.QuestionTypeMultiChoice:
+		if len(question.Options) == 0 {
+			return fmt.Errorf("question type %s requires options", question.QuestionType)
+		}
+	case entity.QuestionTypeMatrix:
+		if len(question.Options) == 0 || len(question.Rows) == 0 {
+			return fmt.Errorf("question type %s requires options and rows", question.QuestionType)
+		}
+	}
+
+	if question.Min != nil && question.Max != nil && *question.Min > *question.Max {
+		return fmt.Errorf("min %v is greater than max %v", *question.Min, *question.Max)
+	}
+	return nil
+}
+
+// Validate : check an answer against the type, options and range of its question
+func Validate(question *entity.Question, answer entity.Answer) error {
+	switch question.QuestionType {
+	case entity.QuestionTypeDemographic:
+		// free text unless the question lists its options
+		if len(question.Options) > 0 {
+			return inOptions(question.Options, answer.Text)
+		}
+	case entity.QuestionTypeNumeric:
+		if answer.Number == nil {
+			return fmt.Errorf("number is required")
+		}
+		return inRange(*answer.Number, question.Min, question.Max)
+	case entity.QuestionTypePercentage:
+		if answer.Number == nil {
+			return fmt.Errorf("number is required")
+		}
+		min, max := percentageMin, percentageMax
+		if question.Min != nil {
+			min = math.Max(min, *question.Min)
+		}
+		if question.Max != nil {
+			max = math.Min(max, *question.Max)
+		}
+		return inRange(*answer.Number, &min, &max)
+	case entity.QuestionTypeSingleChoice:
+		if len(answer.Text) != 1 {
+			return fmt.Errorf("exactly one option is required")
+		}
+		return inOptions(question.Options, answer.Text)
+	case entity.QuestionTypeMultiChoice:
+		if len(answer.Text) == 0 {
+			return fmt.Errorf("at least one option is required")
+		}
+		seen := make(map[string]bool)
+		for _, t := range answer.Text {
+			if seen[t] {
+				return fmt.Errorf("option %s is chosen more than once", t)
+			}
+			seen[t] = true
+		}
+		return inOptions(question.Options, answer.Text)
+	case entity.QuestionTypeDate:
+		if answer.Date == nil || answer.Date.IsZero() {
+			return fmt.Errorf("date is required")
+		}
+	case entity.QuestionTypeMatrix:
+		for row := range answer.Matrix {
+			if !random.Contains(question.Rows, row) {
+				return fmt.Errorf("row %s is not in the question rows", row)
+			}
+		}
+		for _, row := range question.Rows {
+			option, ok := answer.Matrix[row]
+			if !ok {
+				return fmt.Errorf("row %s is not answered", row)
+			}
+			if !random.Contains(question.Options, option) {
+				return fmt.Errorf("option %s of row %s is not in the question options", option, row)
+			}
+		}
+	}
+	return nil
+}
+
+// Values : answer as text, used to compare answers with condition values
+func Values(questionType entity.QuestionType, answer entity.Answer) []string {
+	switch questionType {
+	case entity.QuestionTypePsychographic:
+		if answer.Bool {
+			return []string{"YES"}
+		}
+		return []string{"NO"}
+	case entity.QuestionTypeNumeric, entity.QuestionTypePercentage:
+		if answer.Number == nil {
+			return []string{}
+		}
+		return []string{strconv.FormatFloat(*answer.Number, 'f', -1, 64)}
+	case entity.QuestionTypeDate:
+		if answer.Date == nil {
+			return []string{}
+		}
+		return []string{answer.Date.Format(dateLayout)}
+	case entity.QuestionTypeMatrix:
+		values := make([]string, 0, len(answer.Matrix))
+		for row, option := range answer.Matrix {
+			values = append(values, row+": "+option)
+		}
+		sort.Strings(values)
+		return values
+	}
+	return answer.Text
+}
+
+// Text : printable answer
+func Text(question *entity.Question, answer entity.Answer) string {
+	values := Values(question.QuestionType, answer)
+	if len(values) == 0 {
+		return "-"
+	}
+
+	switch question.QuestionType {
+	case entity.QuestionTypePsychographic:
+		if answer.Bool {
+			return "Yes"
+		}
+		return "No"
+	case entity.QuestionTypeNumeric:
+		return strings.TrimSpace(values[0] + " " + question.Unit)
+	case entity.QuestionTypePercentage:
+		return values[0] + "%"
+	case entity.QuestionTypeDate:
+		return answer.Date.Format("02 Jan 2006")
+	case entity.QuestionTypeMatrix:
+		return strings.Join(values, "; ")
+	}
+	return strings.Join(values, ", ")
+}
+
+func inOptions(options []string, values []string) error {
+	for _, v := range values {
+		if !random.Contains(options, v) {
+			return fmt.Errorf("option %s is not in the question options", v)
+		}
+	}
+	return nil
+}
+
+func inRange(v float64, min, max *float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("invalid number")
+	}
+	if min != nil && v < *min {
+		return fmt.Errorf("%v is less than %v", v, *min)
+	}
+	if max != nil && v > *max {
+		return fmt.Errorf("%v is greater than %v", v, *max)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package benchmark
+
+import (
+	"math"
+	"sort"
+)
+
+// Summary : distribution of peer scores
+type Summary struct {
+	Min    float64 `json:"min"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+	P90    float64 `json:"p90"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Count  int     `json:"count"`
+}
+
+// Summarize : build the score distribution, returns nil when there is no score
+func Summarize(scores []float64) *Summary {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64{}, scores...)
+	sort.Float64s(sorted)
+
+	var total float64
+	for _, s := range sorted {
+		total += s
+	}
+
+	return &Summary{
+		Min:    sorted[0],
+		Q1:     Percentile(sorted, 25),
+		Median: Percentile(sorted, 50),
+		Q3:     Percentile(sorted, 75),
+		P90:    Percentile(sorted, 90),
+		Max:    sorted[len(sorted)-1],
+		Mean:   round(total / float64(len(sorted))),
+		Count:  len(sorted),
+	}
+}
+
+// Percentile : value at the p-th percentile (0 - 100) of sorted scores using linear interpolation
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return round(sorted[lower])
+	}
+	return round(sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower)))
+}
+
+// PercentileRank : percentage of scores below the value, counting ties as half
+func PercentileRank(scores []float64, value float64) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	var below, equal float64
+	for _, s := range scores {
+		if s < value {
+			below++
+		} else if s == value {
+			equal++
+		}
+	}
+	return round((below + equal/2) / float64(len(scores)) * 100)
+}
+
+// Quartile : quartile (1 - 4) the value falls into
+func Quartile(summary *Summary, value float64) int {
+	switch {
+	case value <= summary.Q1:
+		return 1
+	case value <= summary.Median:
+		return 2
+	case value <= summary.Q3:
+		return 3
+	}
+	return 4
+}
+
+// round : round to 2 decimal places
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,134 @@
+package condition
+
+import (
+	"fmt"
+	"strings"
+
+	"csi-api/app/entity"
+	"csi-api/app/kit/answer"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProfileValue : value of an SME profile field used in conditions
+func ProfileValue(sme *entity.SME, field string) string {
+	switch field {
+	case "msic":
+		return sme.MSIC
+	case "state":
+		return sme.State
+	case "businessEntity":
+		return string(sme.BusinessEntity)
+	case "registeredInEastMY":
+		return fmt.Sprintf("%t", sme.RegisteredInEastMY)
+	}
+	return ""
+}
+
+// Match : whether any of the values satisfies the condition
+func Match(c entity.Condition, values []string) bool {
+	switch c.Operator {
+	case entity.ConditionOperatorIn:
+		return anyOf(values, c.Values, strings.EqualFold)
+	case entity.ConditionOperatorNotIn:
+		return !anyOf(values, c.Values, strings.EqualFold)
+	case entity.ConditionOperatorPrefix:
+		return anyOf(values, c.Values, func(v, prefix string) bool {
+			return strings.HasPrefix(strings.ToUpper(v), strings.ToUpper(prefix))
+		})
+	}
+	return false
+}
+
+// ProfileApplicable : whether the SME conditions of the question hold, answer conditions are ignored
+func ProfileApplicable(question *entity.Question, sme *entity.SME) bool {
+	for _, c := range question.Conditions {
+		if c.Source == entity.ConditionSourceSME && !Match(c, []string{ProfileValue(sme, c.Field)}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve : work out which entries are skipped, keyed by entry id. An entry is skipped when any
+// condition fails; answers of unanswered or skipped entries never satisfy a condition.
+func Resolve(entries []*entity.AssessmentEntry, sme *entity.SME) map[string]bool {
+	byOrigin := make(map[string]*entity.AssessmentEntry)
+	for _, entry := range entries {
+		byOrigin[EntryOrigin(entry)] = entry
+	}
+
+	skipped := make(map[string]bool)
+	for _, entry := range entries {
+		skipped[entry.ID.Hex()] = false
+	}
+
+	// conditions may depend on other conditional questions, repeat until nothing changes
+	for n := 0; n <= len(entries); n++ {
+		changed := false
+		for _, entry := range entries {
+			result := !applicable(entry, sme, byOrigin, skipped)
+			if skipped[entry.ID.Hex()] != result {
+				skipped[entry.ID.Hex()] = result
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return skipped
+}
+
+func applicable(entry *entity.AssessmentEntry, sme *entity.SME, byOrigin map[string]*entity.AssessmentEntry, skipped map[string]bool) bool {
+	if entry.Question == nil {
+		return true
+	}
+	for _, c := range entry.Question.Conditions {
+		switch c.Source {
+		case entity.ConditionSourceSME:
+			if !Match(c, []string{ProfileValue(sme, c.Field)}) {
+				return false
+			}
+		case entity.ConditionSourceAnswer:
+			if c.QuestionID == nil {
+				return false
+			}
+			dependency, ok := byOrigin[c.QuestionID.Hex()]
+			if !ok || skipped[dependency.ID.Hex()] || dependency.RespondStatus == entity.ResponseStatusToStart {
+				return false
+			}
+			if !Match(c, answer.Values(dependency.QuestionType, dependency.Answer)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Origin : id shared by the same question across revisions
+func Origin(question *entity.Question) *primitive.ObjectID {
+	if question.OriginID == nil {
+		return question.ID
+	}
+	return question.OriginID
+}
+
+// EntryOrigin : origin of the question an entry answers
+func EntryOrigin(entry *entity.AssessmentEntry) string {
+	if entry.Question != nil && Origin(entry.Question) != nil {
+		return Origin(entry.Question).Hex()
+	}
+	return entry.QuestionID.Hex()
+}
+
+func anyOf(values []string, targets []string, match func(string, string) bool) bool {
+	for _, v := range values {
+		for _, t := range targets {
+			if match(strings.TrimSpace(v), strings.TrimSpace(t)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package emission
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"csi-api/app/entity"
+)
+
+const (
+	// ActivityElectricity : purchased grid electricity, the factor is picked by grid region
+	ActivityElectricity = "ELECTRICITY"
+
+	kgPerTonne = 1000.0
+)
+
+// DefaultFactors : starting factors of a new emission factor table, admins should review them before publishing
+func DefaultFactors() []entity.EmissionFactor {
+	return []entity.EmissionFactor{
+		// scope 1
+		{Activity: "DIESEL", Label: "Diesel", Scope: entity.EmissionScope1, Unit: "litre", Factor: 2.68, Source: "IPCC 2006"},
+		{Activity: "PETROL", Label: "Petrol", Scope: entity.EmissionScope1, Unit: "litre", Factor: 2.31, Source: "IPCC 2006"},
+		{Activity: "LPG", Label: "LPG", Scope: entity.EmissionScope1, Unit: "kg", Factor: 2.94, Source: "IPCC 2006"},
+		{Activity: "NATURAL_GAS", Label: "Natural gas", Scope: entity.EmissionScope1, Unit: "m3", Factor: 2.02, Source: "IPCC 2006"},
+		// scope 2, Malaysia grid emission factors
+		{Activity: ActivityElectricity, Label: "Electricity - Peninsular Malaysia", Scope: entity.EmissionScope2, Region: entity.GridRegionPeninsular, Unit: "kWh", Factor: 0.758, Source: "Suruhanjaya Tenaga grid emission factor"},
+		{Activity: ActivityElectricity, Label: "Electricity - Sabah", Scope: entity.EmissionScope2, Region: entity.GridRegionSabah, Unit: "kWh", Factor: 0.525, Source: "Suruhanjaya Tenaga grid emission factor"},
+		{Activity: ActivityElectricity, Label: "Electricity - Sarawak", Scope: entity.EmissionScope2, Region: entity.GridRegionSarawak, Unit: "kWh", Factor: 0.199, Source: "Suruhanjaya Tenaga grid emission factor"},
+		// scope 3
+		{Activity: "AIR_TRAVEL_DOMESTIC", Label: "Air travel - domestic", Scope: entity.EmissionScope3, Unit: "passenger.km", Factor: 0.246, Source: "DEFRA"},
+		{Activity: "AIR_TRAVEL_INTERNATIONAL", Label: "Air travel - international", Scope: entity.EmissionScope3, Unit: "passenger.km", Factor: 0.148, Source: "DEFRA"},
+		{Activity: "CAR_TRAVEL", Label: "Car travel", Scope: entity.EmissionScope3, Unit: "km", Factor: 0.171, Source: "DEFRA"},
+		{Activity: "RAIL_TRAVEL", Label: "Rail travel", Scope: entity.EmissionScope3, Unit: "passenger.km", Factor: 0.035, Source: "DEFRA"},
+		{Activity: "WASTE_LANDFILL", Label: "Waste to landfill", Scope: entity.EmissionScope3, Unit: "kg", Factor: 0.467, Source: "DEFRA"},
+		{Activity: "WATER_SUPPLY", Label: "Water supply", Scope: entity.EmissionScope3, Unit: "m3", Factor: 0.149, Source: "DEFRA"},
+	}
+}
+
+// GridRegionOf : grid region of the state an SME is registered in
+func GridRegionOf(state string) entity.GridRegion {
+	s := strings.ToUpper(state)
+	switch {
+	case strings.Contains(s, "SABAH"), strings.Contains(s, "LABUAN"):
+		return entity.GridRegionSabah
+	case strings.Contains(s, "SARAWAK"):
+		return entity.GridRegionSarawak
+	}
+	return entity.GridRegionPeninsular
+}
+
+// ValidateFactors : every activity and region must have one factor only
+func ValidateFactors(factors []entity.EmissionFactor) error {
+	seen := make(map[string]bool)
+	for _, f := range factors {
+		key := f.Activity + "|" + string(f.Region)
+		if seen[key] {
+			return fmt.Errorf("duplicate factor for activity %s region %s", f.Activity, f.Region)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Calculate : fill in the factor and emission of each activity and total them per scope. Electricity
+// without a region uses the grid of the SME state.
+func Calculate(activities []entity.EmissionActivity, table *entity.EmissionFactorTable, sme *entity.SME) (entity.EmissionResult, error) {
+	var result entity.EmissionResult
+	for n := range activities {
+		activity := &activities[n]
+		if activity.Activity == ActivityElectricity && activity.Region == "" {
+			activity.Region = GridRegionOf(sme.State)
+		}
+
+		factor, ok := find(table.Factors, activity.Activity, activity.Region)
+		if !ok {
+			return result, fmt.Errorf("no emission factor for activity %s in table version %d", activity.Activity, table.Version)
+		}
+
+		activity.Unit = factor.Unit
+		activity.Scope = factor.Scope
+		activity.Factor = factor.Factor
+		activity.Emission = round(activity.Quantity * factor.Factor / kgPerTonne)
+
+		switch factor.Scope {
+		case entity.EmissionScope1:
+			result.Scope1 += activity.Emission
+		case entity.EmissionScope2:
+			result.Scope2 += activity.Emission
+		case entity.EmissionScope3:
+			result.Scope3 += activity.Emission
+		}
+	}
+
+	result.Scope1 = round(result.Scope1)
+	result.Scope2 = round(result.Scope2)
+	result.Scope3 = round(result.Scope3)
+	result.Total = round(result.Scope1 + result.Scope2 + result.Scope3)
+	return result, nil
+}
+
+// find : factor of the activity in the region, falling back to the factor without region
+func find(factors []entity.EmissionFactor, activity string, region entity.GridRegion) (entity.EmissionFactor, bool) {
+	var fallback *entity.EmissionFactor
+	for n, f := range factors {
+		if f.Activity != activity {
+			continue
+		}
+		if f.Region == region {
+			return f, true
+		}
+		if f.Region == "" {
+			fallback = &factors[n]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return entity.EmissionFactor{}, false
+}
+
+// round : round to 4 decimal places, small SMEs emit well under a tonne per activity
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -1,7 +1,9 @@
 package general
 
 import (
+	"crypto/sha256"
 	"csi-api/app/env"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -75,6 +77,98 @@ func ReadFile(file *multipart.FileHeader, path string) error {
 	return nil
 }
 
+// StoredFile : details of a file written into the storage path
+type StoredFile struct {
+	ContentType string
+	Size        int64
+	SHA256      string
+}
+
+// CheckFile : content type of an uploaded file, an error when it is too large or of an unsupported type
+func CheckFile(file *multipart.FileHeader) (string, error) {
+	// check file size
+	if file.Size > 8388608 {
+		return "", errors.New("file size exceeds limit")
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	// to read the file type
+	buff := make([]byte, 512)
+	n, err := src.Read(buff)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	fileType := http.DetectContentType(buff[:n])
+
+	// check supported types
+	if _, ok := supportedTypes[fileType]; !ok {
+		return "", errors.New("unsupported file type")
+	}
+	return fileType, nil
+}
+
+// StoreFile : save an uploaded file under a given name and hash its content
+func StoreFile(file *multipart.FileHeader, path string, filename string) (*StoredFile, error) {
+	// get the temperary file path
+	path = fmt.Sprintf("%s/%s", env.Config.Storage.Path, path)
+
+	fileType, err := CheckFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// read file
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	// check the directory exists
+	CreateFolder(path)
+
+	dst, err := os.Create(path + filename)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	// hash while copying the content to the destination
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), src)
+	if err != nil {
+		os.Remove(path + filename)
+		return nil, err
+	}
+
+	return &StoredFile{
+		ContentType: fileType,
+		Size:        size,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// StoragePath : location of a stored file on disk
+func StoragePath(path string) string {
+	return fmt.Sprintf("%s/%s", env.Config.Storage.Path, path)
+}
+
+// SaveFile : write generated content into the storage path
+func SaveFile(content []byte, path string, filename string) error {
+	// get the temperary file path
+	path = fmt.Sprintf("%s/%s", env.Config.Storage.Path, path)
+
+	// check the directory exists
+	CreateFolder(path)
+
+	return os.WriteFile(path+filename, content, 0644)
+}
+
 // Create folder
 func CreateFolder(path string) {
 	// check the directory exists
@@ -8,9 +8,20 @@ import (
 )
 
 const (
-	accessTokenExpiresInHour  = 24 * 30 * 3 // every 3 months
-	refreshTokenExpiresInHour = 24 * 30 * 6 // every 6 months
-	tokenExpiresInSecond      = 86400       // 1 day
+	accessTokenExpiresInMinute = 15          // short lived, renewed with the refresh token
+	refreshTokenExpiresInHour  = 24 * 30 * 6 // every 6 months
+	tokenExpiresInSecond       = 86400       // 1 day
+
+	// TokenTypeAccess :
+	TokenTypeAccess = "access"
+	// TokenTypeRefresh : only accepted by the refresh endpoint
+	TokenTypeRefresh = "refresh"
+	// TokenTypeEmailVerification : link emailed after self registration
+	TokenTypeEmailVerification = "verify_email"
+	// TokenTypeInvitation : link emailed to an invited user to set a password
+	TokenTypeInvitation = "invitation"
+	// TokenTypeTwoFactor : issued after the password check of a login which needs a TOTP code
+	TokenTypeTwoFactor = "two_factor"
 )
 
 // ExtractedClaims :
@@ -20,6 +31,9 @@ type ExtractedClaims struct {
 	Subject  string `json:"sub"`
 	Exp      string `json:"exp"`    // exp extracted is a string, to be casted to time.Time
 	Scopes   string `json:"scopes"` // scopes extracted is a string, delimit by ,
+	Type     string `json:"typ"`
+	ID       string `json:"jti"`
+	Email    string `json:"email"`
 }
 
 // GenerateAccessToken :
@@ -28,11 +42,12 @@ func GenerateAccessToken(secretKey string, extraClaims map[string]string) (map[s
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 
-	exp := time.Now().Add(time.Hour * accessTokenExpiresInHour).Format(time.RFC3339)
+	exp := time.Now().Add(time.Minute * accessTokenExpiresInMinute).Format(time.RFC3339)
 
 	// set issuer, expiry time
 	claims["iss"] = env.Config.Jwt.Issuer
 	claims["exp"] = exp
+	claims["typ"] = TokenTypeAccess
 
 	// set extra claims (admin)
 	if extraClaims != nil {
@@ -50,19 +65,23 @@ func GenerateAccessToken(secretKey string, extraClaims map[string]string) (map[s
 	return map[string]interface{}{
 		"accessToken": accessToken,
 		"expiresAt":   exp,
-		"expiresIn":   accessTokenExpiresInHour * 3600,
+		"expiresIn":   accessTokenExpiresInMinute * 60,
 	}, nil
 }
 
-// GenerateRefreshToken :
-func GenerateRefreshToken(secretKey string, extraClaims map[string]string) (string, error) {
+// GenerateRefreshToken : id is the server side record of the token
+func GenerateRefreshToken(secretKey string, id string, extraClaims map[string]string) (string, string, error) {
 	// init access token and claims
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
 
+	exp := time.Now().Add(time.Hour * refreshTokenExpiresInHour).Format(time.RFC3339)
+
 	// set issuer, expiry time
 	claims["iss"] = env.Config.Jwt.Issuer
-	claims["exp"] = time.Now().Add(time.Hour * refreshTokenExpiresInHour).Format(time.RFC3339)
+	claims["exp"] = exp
+	claims["typ"] = TokenTypeRefresh
+	claims["jti"] = id
 
 	// use aud as user identifier
 	claims["aud"] = extraClaims["aud"]
@@ -70,28 +89,46 @@ func GenerateRefreshToken(secretKey string, extraClaims map[string]string) (stri
 	// generate token
 	refreshToken, err := token.SignedString([]byte(secretKey))
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	return refreshToken, exp, nil
+}
+
+// GenerateLinkToken : short lived token of the given type for links sent by email
+func GenerateLinkToken(secretKey string, tokenType string, validFor time.Duration, extraClaims map[string]string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+
+	for k, v := range extraClaims {
+		claims[k] = v
 	}
 
-	return refreshToken, nil
+	// set issuer, expiry time
+	claims["iss"] = env.Config.Jwt.Issuer
+	claims["exp"] = time.Now().Add(validFor).Format(time.RFC3339)
+	claims["typ"] = tokenType
+
+	return token.SignedString([]byte(secretKey))
 }
 
 // GenerateTokens : Generate both access and refresh token
-func GenerateTokens(secretKey string, extraClaims map[string]string) (map[string]interface{}, error) {
+func GenerateTokens(secretKey string, refreshTokenID string, extraClaims map[string]string) (map[string]interface{}, error) {
 	accessToken, err := GenerateAccessToken(secretKey, extraClaims)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := GenerateRefreshToken(secretKey, extraClaims)
+	refreshToken, refreshExp, err := GenerateRefreshToken(secretKey, refreshTokenID, extraClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	return map[string]interface{}{
-		"accessToken":  accessToken["accessToken"],
-		"refreshToken": refreshToken,
-		"expiresAt":    accessToken["expiresAt"],
-		"expiresIn":    accessToken["expiresIn"],
+		"accessToken":           accessToken["accessToken"],
+		"refreshToken":          refreshToken,
+		"expiresAt":             accessToken["expiresAt"],
+		"expiresIn":             accessToken["expiresIn"],
+		"refreshTokenExpiresAt": refreshExp,
 	}, nil
 }
@@ -0,0 +1,336 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	discoveryCacheDuration = time.Hour
+	jwksCacheDuration      = time.Hour
+	requestTimeout         = 10 * time.Second
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// Configuration : discovery document of an identity provider
+type Configuration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// TokenResponse : response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Claims : verified claims of an ID token
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+type cached struct {
+	value     interface{}
+	fetchedAt time.Time
+}
+
+var (
+	cacheMu    sync.Mutex
+	discovered = map[string]cached{}
+	jwks       = map[string]cached{}
+)
+
+// Discover : discovery document of the issuer, cached for an hour
+func Discover(ctx context.Context, issuer string) (*Configuration, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	cacheMu.Lock()
+	if c, ok := discovered[issuer]; ok && time.Since(c.fetchedAt) < discoveryCacheDuration {
+		cacheMu.Unlock()
+		return c.value.(*Configuration), nil
+	}
+	cacheMu.Unlock()
+
+	config := new(Configuration)
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", config); err != nil {
+		return nil, err
+	}
+
+	// the discovery document must belong to the issuer it was fetched from
+	if strings.TrimSuffix(config.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery issuer %s does not match %s", config.Issuer, issuer)
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" || config.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is incomplete", issuer)
+	}
+
+	cacheMu.Lock()
+	discovered[issuer] = cached{value: config, fetchedAt: time.Now()}
+	cacheMu.Unlock()
+
+	return config, nil
+}
+
+// PKCE : a code verifier and its S256 code challenge
+func PKCE() (string, string, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// State : random value for the state and nonce parameters
+func State() (string, error) {
+	return randomString(32)
+}
+
+// AuthorizationURL : where the user signs in at the identity provider
+func AuthorizationURL(config *Configuration, clientID string, redirectURI string, scopes []string, state string, nonce string, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", clientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(config.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return config.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange : trade the authorization code and the code verifier for tokens
+func Exchange(ctx context.Context, config *Configuration, clientID string, clientSecret string, redirectURI string, code string, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", clientID)
+	form.Set("code_verifier", codeVerifier)
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	tokens := new(TokenResponse)
+	if err := json.Unmarshal(body, tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint returned no id_token")
+	}
+	return tokens, nil
+}
+
+// VerifyIDToken : check the signature against the JWKS of the issuer, the issuer, audience, expiry and nonce
+func VerifyIDToken(ctx context.Context, config *Configuration, clientID string, rawIDToken string, nonce string) (*Claims, error) {
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512"}}
+	token, err := parser.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return signingKey(ctx, config.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid id token")
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(config.Issuer, "/") {
+		return nil, fmt.Errorf("id token issuer %s is not %s", iss, config.Issuer)
+	}
+	if !claims.VerifyAudience(clientID, true) && !audienceContains(claims["aud"], clientID) {
+		return nil, fmt.Errorf("id token is not issued to %s", clientID)
+	}
+	// exp is optional to the jwt library, not to OIDC
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("id token has no expiry")
+	}
+	if n, _ := claims["nonce"].(string); n == "" || n != nonce {
+		return nil, fmt.Errorf("id token nonce mismatch")
+	}
+
+	result := &Claims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.GivenName, _ = claims["given_name"].(string)
+	result.FamilyName, _ = claims["family_name"].(string)
+	result.Name, _ = claims["name"].(string)
+	// some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+
+	if result.Subject == "" {
+		return nil, fmt.Errorf("id token has no subject")
+	}
+	return result, nil
+}
+
+// audienceContains : aud can be a list of client ids
+func audienceContains(aud interface{}, clientID string) bool {
+	list, ok := aud.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, a := range list {
+		if s, _ := a.(string); s == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// signingKey : RSA key of the JWKS by kid, the JWKS is fetched again once for an unknown kid so rotated keys work
+func signingKey(ctx context.Context, jwksURI string, kid string) (*rsa.PublicKey, error) {
+	for _, refresh := range []bool{false, true} {
+		keys, err := keySet(ctx, jwksURI, refresh)
+		if err != nil {
+			return nil, err
+		}
+		// without a kid the only key of the set is used
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("signing key %s not found", kid)
+}
+
+// keySet : RSA signing keys of a JWKS by kid
+func keySet(ctx context.Context, jwksURI string, refresh bool) (map[string]*rsa.PublicKey, error) {
+	cacheMu.Lock()
+	if c, ok := jwks[jwksURI]; ok && !refresh && time.Since(c.fetchedAt) < jwksCacheDuration {
+		cacheMu.Unlock()
+		return c.value.(map[string]*rsa.PublicKey), nil
+	}
+	cacheMu.Unlock()
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	cacheMu.Lock()
+	jwks[jwksURI] = cached{value: keys, fetchedAt: time.Now()}
+	cacheMu.Unlock()
+
+	return keys, nil
+}
+
+// getJSON :
+func getJSON(ctx context.Context, uri string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", uri, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// randomString : url safe random string of n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,210 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"csi-api/app/constant"
+	"csi-api/app/entity"
+	"csi-api/app/kit/answer"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	pageWidth   = 190.0
+	labelWidth  = 60.0
+	lineHeight  = 7.0
+	answerWidth = 40.0
+)
+
+// Data : everything printed in an ESG assessment report
+type Data struct {
+	SME        *entity.SME
+	Assessment *entity.Assessment
+	Entries    []*entity.AssessmentEntry
+	Emission   *entity.EmissionInventory
+}
+
+// Generate : render the ESG report of an assessment as PDF
+func Generate(data Data) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetTitle("ESG Assessment Report", true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	// title
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(pageWidth, 12, "ESG Assessment Report", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(pageWidth, lineHeight, tr(fmt.Sprintf("Generated on %s", time.Now().UTC().Format("02 Jan 2006"))), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	// SME profile
+	heading(pdf, "Company Profile")
+	sme := data.SME
+	businessEntity := constant.BusinessEntities[sme.BusinessEntity]
+	if businessEntity == "" {
+		businessEntity = string(sme.BusinessEntity)
+	}
+	rows := [][2]string{
+		{"Company Name", sme.CompanyName},
+		{"SSM Number", sme.SSMNumber},
+		{"Business Entity", businessEntity},
+		{"MSIC", sme.MSIC},
+		{"State", sme.State},
+		{"Post Code", sme.PostCode},
+		{"Registered in East Malaysia", yesNo(sme.RegisteredInEastMY)},
+		{"Assessment Serial No", data.Assessment.SerialNo},
+		{"Completion Date", data.Assessment.CompletionDate.Format("02 Jan 2006")},
+	}
+	if a := data.Assessment; !a.PeriodStart.IsZero() {
+		rows = append(rows, [2]string{"Reporting Period", fmt.Sprintf("%s - %s", a.PeriodStart.Format("02 Jan 2006"), a.PeriodEnd.Format("02 Jan 2006"))})
+	}
+	for _, row := range rows {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(labelWidth, lineHeight, row[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(pageWidth-labelWidth, lineHeight, tr(row[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// scores
+	heading(pdf, "ESG Score")
+	if score := data.Assessment.Score; score != nil {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(230, 230, 230)
+		pdf.CellFormat(labelWidth, lineHeight, "Dimension", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(answerWidth, lineHeight, "Score (%)", "1", 0, "R", true, 0, "")
+		pdf.CellFormat(answerWidth, lineHeight, "Weight", "1", 1, "R", true, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		for _, d := range score.Dimensions {
+			pdf.CellFormat(labelWidth, lineHeight, tr(d.Dimension), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(answerWidth, lineHeight, fmt.Sprintf("%.2f", d.Score), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(answerWidth, lineHeight, fmt.Sprintf("%.2f", d.Weight), "1", 1, "R", false, 0, "")
+		}
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(labelWidth, lineHeight, "Overall", "1", 0, "L", false, 0, "")
+		pdf.CellFormat(answerWidth, lineHeight, fmt.Sprintf("%.2f", score.Overall), "1", 1, "R", false, 0, "")
+	} else {
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(pageWidth, lineHeight, "Assessment has not been scored.", "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// GHG emissions
+	heading(pdf, "GHG Emissions (tCO2e)")
+	if inventory := data.Emission; inventory != nil {
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(pageWidth, lineHeight, fmt.Sprintf("Reporting period %s - %s, emission factors version %d",
+			inventory.PeriodStart.Format("02 Jan 2006"), inventory.PeriodEnd.Format("02 Jan 2006"), inventory.FactorVersion), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(230, 230, 230)
+		pdf.CellFormat(labelWidth, lineHeight, "Activity", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(answerWidth, lineHeight, "Scope", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(answerWidth, lineHeight, "Quantity", "1", 0, "R", true, 0, "")
+		pdf.CellFormat(answerWidth, lineHeight, "tCO2e", "1", 1, "R", true, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		for _, a := range inventory.Activities {
+			pdf.CellFormat(labelWidth, lineHeight, tr(strings.TrimSpace(a.Activity+" "+string(a.Region))), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(answerWidth, lineHeight, string(a.Scope), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(answerWidth, lineHeight, tr(fmt.Sprintf("%.2f %s", a.Quantity, a.Unit)), "1", 0, "R", false, 0, "")
+			pdf.CellFormat(answerWidth, lineHeight, fmt.Sprintf("%.4f", a.Emission), "1", 1, "R", false, 0, "")
+		}
+		pdf.SetFont("Helvetica", "B", 10)
+		totals := [][2]string{
+			{"Scope 1", fmt.Sprintf("%.4f", inventory.Result.Scope1)},
+			{"Scope 2", fmt.Sprintf("%.4f", inventory.Result.Scope2)},
+			{"Scope 3", fmt.Sprintf("%.4f", inventory.Result.Scope3)},
+			{"Total", fmt.Sprintf("%.4f", inventory.Result.Total)},
+		}
+		for _, row := range totals {
+			pdf.CellFormat(labelWidth+answerWidth*2, lineHeight, row[0], "1", 0, "L", false, 0, "")
+			pdf.CellFormat(answerWidth, lineHeight, row[1], "1", 1, "R", false, 0, "")
+		}
+	} else {
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(pageWidth, lineHeight, "No emission data recorded.", "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	// answers grouped by dimension
+	dimensions := make(map[string][]*entity.AssessmentEntry)
+	for _, entry := range data.Entries {
+		if entry.Question == nil || entry.Skipped {
+			continue
+		}
+		dimensions[entry.Question.Dimension] = append(dimensions[entry.Question.Dimension], entry)
+	}
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, dimension := range keys {
+		heading(pdf, tr(fmt.Sprintf("Responses - %s", dimension)))
+		for n, entry := range dimensions[dimension] {
+			pdf.SetFont("Helvetica", "", 10)
+			pdf.MultiCell(pageWidth, lineHeight-1, tr(fmt.Sprintf("%d. %s", n+1, entry.Question.QuestionLabel)), "", "L", false)
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.MultiCell(pageWidth, lineHeight-1, tr("    "+answerText(entry)), "", "L", false)
+			pdf.Ln(1)
+		}
+		pdf.Ln(3)
+	}
+
+	// ISO documents
+	heading(pdf, "Supporting ISO Documents")
+	pdf.SetFont("Helvetica", "", 10)
+	if len(data.Assessment.ISODocs) == 0 {
+		pdf.CellFormat(pageWidth, lineHeight, "No document uploaded.", "", 1, "L", false, 0, "")
+	}
+	for _, doc := range data.Assessment.ISODocs {
+		pdf.CellFormat(pageWidth, lineHeight, tr("- "+filepath.Base(doc)), "", 1, "L", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// heading : section title
+func heading(pdf *gofpdf.Fpdf, title string) {
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(pageWidth, 9, title, "B", 1, "L", false, 0, "")
+	pdf.Ln(2)
+}
+
+// answerText : printable answer of an entry
+func answerText(entry *entity.AssessmentEntry) string {
+	if entry.QuestionType == entity.QuestionTypeUpload {
+		files := make([]string, 0, len(entry.Answer.Text))
+		for _, f := range entry.Answer.Text {
+			files = append(files, filepath.Base(f))
+		}
+		if len(files) == 0 {
+			return "No document uploaded"
+		}
+		return strings.Join(files, ", ")
+	}
+	return answer.Text(entry.Question, entry.Answer)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
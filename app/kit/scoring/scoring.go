@@ -0,0 +1,111 @@
+package scoring
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"csi-api/app/entity"
+)
+
+const (
+	defaultWeight = 1.0
+	maxScore      = 100.0
+)
+
+// AnswerScore : return the score (0 - 1) of an entry answer and whether the entry is scorable
+func AnswerScore(entry *entity.AssessmentEntry) (float64, bool) {
+	switch entry.QuestionType {
+	case entity.QuestionTypePsychographic:
+		if entry.Answer.Bool {
+			return 1, true
+		}
+		return 0, true
+	case entity.QuestionTypeUpload:
+		if len(entry.Answer.Text) > 0 {
+			return 1, true
+		}
+		return 0, true
+	case entity.QuestionTypePercentage:
+		if entry.Answer.Number == nil {
+			return 0, true
+		}
+		return math.Min(math.Max(*entry.Answer.Number/maxScore, 0), 1), true
+	}
+	// other answers describe the company or its operation and carry no score
+	return 0, false
+}
+
+// Compute : calculate the weighted score per dimension and the overall score of the entries
+func Compute(entries []*entity.AssessmentEntry, weights map[string]float64) *entity.AssessmentScore {
+	type total struct {
+		score  float64
+		weight float64
+		scored int
+	}
+
+	totals := make(map[string]*total)
+	for _, entry := range entries {
+		if entry.Question == nil || entry.Skipped {
+			continue
+		}
+
+		score, ok := AnswerScore(entry)
+		if !ok {
+			continue
+		}
+
+		weight := entry.Question.Weight
+		if weight <= 0 {
+			weight = defaultWeight
+		}
+
+		t, ok := totals[entry.Question.Dimension]
+		if !ok {
+			t = new(total)
+			totals[entry.Question.Dimension] = t
+		}
+		t.score += score * weight
+		t.weight += weight
+		t.scored++
+	}
+
+	result := &entity.AssessmentScore{
+		Dimensions: []entity.DimensionScore{},
+		ScoredAt:   time.Now().UTC(),
+	}
+
+	var overall, overallWeight float64
+	for dimension, t := range totals {
+		weight := defaultWeight
+		if w, ok := weights[dimension]; ok {
+			weight = w
+		}
+
+		score := round(t.score / t.weight * maxScore)
+		result.Dimensions = append(result.Dimensions, entity.DimensionScore{
+			Dimension: dimension,
+			Score:     score,
+			Weight:    weight,
+			Scored:    t.scored,
+		})
+
+		overall += score * weight
+		overallWeight += weight
+	}
+
+	// keep dimension order stable
+	sort.Slice(result.Dimensions, func(i, j int) bool {
+		return result.Dimensions[i].Dimension < result.Dimensions[j].Dimension
+	})
+
+	if overallWeight > 0 {
+		result.Overall = round(overall / overallWeight)
+	}
+	return result
+}
+
+// round : round to 2 decimal places
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
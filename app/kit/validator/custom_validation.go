@@ -137,7 +137,7 @@ func validateScopes(fl validator.FieldLevel) bool {
 	for _, v := range slice {
 		arr := strings.Split(fmt.Sprintf("%v", v), ",")
 		for _, elem := range arr {
-			if _, exist := constant.UserMapScopes[elem]; !exist {
+			if !random.Contains(constant.UserScopes, entity.Scope(elem)) {
 				return false
 			}
 		}
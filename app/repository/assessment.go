@@ -14,11 +14,15 @@ import (
 
 // FindAssessmentFilter :
 type FindAssessmentFilter struct {
-	Cursor      string
-	SMEID       string
-	SharedWiths []string
-	IDs         []string
-	Status      entity.Status
+	Cursor       string
+	SMEID        string
+	SMEIDs       []string
+	SharedWiths  []string
+	SharedStatus entity.Status
+	SharedAt     time.Time // shares with SharedStatus which have not expired by then
+	IDs          []string
+	Scored       bool
+	Status       entity.Status
 }
 
 // CreateAssessment :
@@ -73,6 +77,22 @@ func (r Repository) FindAssessments(ctx context.Context, filter FindAssessmentFi
 		query["smeID"] = oid
 	}
 
+	if len(filter.SMEIDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.SMEIDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.SMEIDs[i])
+			if err != nil {
+				return assessments, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["smeID"] = bson.M{"$in": oIds}
+	}
+
+	if filter.Scored {
+		query["score"] = bson.M{"$ne": nil}
+	}
+
 	if len(filter.SharedWiths) > 0 {
 		oIds := make([]primitive.ObjectID, 0)
 		for i := 0; i < len(filter.SharedWiths); i++ {
@@ -82,7 +102,15 @@ func (r Repository) FindAssessments(ctx context.Context, filter FindAssessmentFi
 			}
 			oIds = append(oIds, oid)
 		}
-		query["sharedWith.corporateID"] = bson.M{"$in": oIds}
+		if filter.SharedStatus != "" {
+			match := bson.M{"corporateID": bson.M{"$in": oIds}, "status": filter.SharedStatus}
+			if !filter.SharedAt.IsZero() {
+				match["expiresAt"] = bson.M{"$gt": filter.SharedAt}
+			}
+			query["sharedWiths"] = bson.M{"$elemMatch": match}
+		} else {
+			query["sharedWiths.corporateID"] = bson.M{"$in": oIds}
+		}
 	}
 
 	if filter.Status != "" {
@@ -133,3 +161,45 @@ func (r Repository) DeleteAssessmentByID(i *entity.Assessment) (*mongo.UpdateRes
 	i.DeletedAt = time.Now().UTC()
 	return r.UpsertAssessment(i)
 }
+
+// GrantAssessmentShare : replace the share of the corporate, or add it when the assessment has none yet
+func (r Repository) GrantAssessmentShare(ctx context.Context, assessmentID *primitive.ObjectID, share entity.AssessmentShare) error {
+	timeNow := time.Now().UTC()
+	result, err := r.db.Collection(entity.CollectionAssessment).UpdateOne(
+		ctx,
+		bson.M{"_id": assessmentID, "sharedWiths.corporateID": share.CorporateID},
+		bson.M{"$set": bson.M{"sharedWiths.$": share, "updatedAt": timeNow}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// the corporate guard keeps a concurrent grant from adding a second share
+	_, err = r.db.Collection(entity.CollectionAssessment).UpdateOne(
+		ctx,
+		bson.M{"_id": assessmentID, "sharedWiths.corporateID": bson.M{"$ne": share.CorporateID}},
+		bson.M{
+			"$push": bson.M{"sharedWiths": share},
+			"$set":  bson.M{"updatedAt": timeNow},
+		})
+	return err
+}
+
+// RevokeAssessmentShare : end the active share of the corporate
+func (r Repository) RevokeAssessmentShare(ctx context.Context, assessmentID *primitive.ObjectID, corporateID *primitive.ObjectID, revokedBy *primitive.ObjectID) (*mongo.UpdateResult, error) {
+	timeNow := time.Now().UTC()
+	return r.db.Collection(entity.CollectionAssessment).UpdateOne(
+		ctx,
+		bson.M{
+			"_id":         assessmentID,
+			"sharedWiths": bson.M{"$elemMatch": bson.M{"corporateID": corporateID, "status": entity.StatusActive}},
+		},
+		bson.M{"$set": bson.M{
+			"sharedWiths.$.status":    entity.StatusInActive,
+			"sharedWiths.$.revokedBy": revokedBy,
+			"sharedWiths.$.revokedAt": timeNow,
+			"updatedAt":               timeNow,
+		}})
+}
@@ -199,10 +199,15 @@ func (r Repository) BulkDeleteAssessmentEntries(ctx context.Context, AssessmentI
 	return r.db.Collection(entity.CollectionAssessmentEntry).DeleteMany(ctx, query)
 }
 
-// SubmitAssessment :
+// SubmitAssessment : send answered entries to review
 func (r Repository) SubmitAssessment(ctx context.Context, filter SubmitAssessmentFilter) (*mongo.UpdateResult, error) {
+	assessmentID, err := primitive.ObjectIDFromHex(filter.AssessmentID)
+	if err != nil {
+		return nil, err
+	}
+
 	query := bson.M{
-		"assessmentID":  filter.AssessmentID,
+		"assessmentID":  assessmentID,
 		"respondStatus": bson.M{"$eq": entity.ResponseStatusInProgress},
 	}
 	if len(filter.SMEIDs) > 0 {
@@ -219,7 +224,7 @@ func (r Repository) SubmitAssessment(ctx context.Context, filter SubmitAssessmen
 
 	return r.db.Collection(entity.CollectionAssessmentEntry).UpdateMany(ctx, query, bson.M{
 		"$set": bson.M{
-			"respondStatus": entity.ResponseStatusToSubmitted,
+			"respondStatus": entity.ResponseStatusToReview,
 			"submittedAt":   time.Now().UTC(),
 		},
 	}, options.Update())
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindCampaignFilter :
+type FindCampaignFilter struct {
+	Cursor        string
+	IDs           []string
+	CorporateID   string
+	SMEID         string // campaigns the SME takes part in
+	Status        entity.Status
+	DeadlineAfter time.Time
+}
+
+// CampaignParticipantProgress : assessment of a campaign participant and how many of its entries are answered
+type CampaignParticipantProgress struct {
+	AssessmentID *primitive.ObjectID `bson:"_id" json:"assessmentID"`
+	SMEID        *primitive.ObjectID `bson:"smeID" json:"smeID"`
+	CompanyName  string              `bson:"companyName" json:"companyName"`
+	ReviewStatus entity.ReviewStatus `bson:"reviewStatus" json:"reviewStatus"`
+	Overall      *float64            `bson:"overall" json:"overall"`
+	Entries      int                 `bson:"entries" json:"entries"` // entries to answer, skipped ones excluded
+	Answered     int                 `bson:"answered" json:"answered"`
+	FinalizedAt  time.Time           `bson:"finalizedAt" json:"finalizedAt"`
+}
+
+// CreateCampaign :
+func (r Repository) CreateCampaign(ctx context.Context, i entity.Campaign) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionCampaign, i)
+}
+
+// FindCampaignByID :
+func (r Repository) FindCampaignByID(ctx context.Context, id string) (*entity.Campaign, error) {
+	campaign := new(entity.Campaign)
+	err := r.FindByObjectID(entity.CollectionCampaign, id, &campaign)
+	if err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+// FindCampaigns :
+func (r Repository) FindCampaigns(ctx context.Context, filter FindCampaignFilter) ([]*entity.Campaign, string, error) {
+	var campaigns []*entity.Campaign
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if len(filter.IDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.IDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.IDs[i])
+			if err != nil {
+				return campaigns, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["_id"] = bson.M{"$in": oIds}
+	}
+
+	if filter.CorporateID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.CorporateID)
+		if err != nil {
+			return campaigns, "", err
+		}
+		query["corporateID"] = oid
+	}
+
+	if filter.SMEID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.SMEID)
+		if err != nil {
+			return campaigns, "", err
+		}
+		query["participants.smeID"] = oid
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	if !filter.DeadlineAfter.IsZero() {
+		query["deadline"] = bson.M{"$gt": filter.DeadlineAfter}
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionCampaign).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		campaign := new(entity.Campaign)
+		if err := nextCursor.Decode(campaign); err != nil {
+			return nil, "", err
+		}
+
+		campaigns = append(campaigns, campaign)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(campaigns) > int(limit) {
+		return campaigns[:len(campaigns)-1], campaigns[len(campaigns)-1].ID.Hex(), nil
+	}
+	return campaigns, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpdateCampaign : update the settings of a campaign, when remindersSent is not nil the reminders of every
+// participant restart from it, e.g. after the deadline moved
+func (r Repository) UpdateCampaign(ctx context.Context, i *entity.Campaign, remindersSent []int) (*mongo.UpdateResult, error) {
+	set := bson.M{
+		"name":         i.Name,
+		"deadline":     i.Deadline,
+		"reminderDays": i.ReminderDays,
+		"status":       i.Status,
+		"updatedAt":    i.UpdatedAt,
+	}
+	if remindersSent != nil && len(i.Participants) > 0 {
+		set["participants.$[].remindersSent"] = remindersSent
+	}
+
+	return r.db.Collection(entity.CollectionCampaign).UpdateOne(
+		ctx,
+		bson.M{"_id": i.ID},
+		bson.M{"$set": set})
+}
+
+// ClaimCampaignReminder : mark the reminder of the given day as sent to the participant, false when it already was,
+// so only one instance sends it
+func (r Repository) ClaimCampaignReminder(ctx context.Context, campaignID *primitive.ObjectID, smeID *primitive.ObjectID, day int, at time.Time) (bool, error) {
+	result, err := r.db.Collection(entity.CollectionCampaign).UpdateOne(
+		ctx,
+		bson.M{
+			"_id": campaignID,
+			"participants": bson.M{"$elemMatch": bson.M{
+				"smeID":         smeID,
+				"remindersSent": bson.M{"$ne": day},
+			}},
+		},
+		bson.M{
+			"$push": bson.M{"participants.$.remindersSent": day},
+			"$set":  bson.M{"participants.$.lastRemindedAt": at},
+		})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// CampaignProgress : progress of the assessments of a campaign, with the number of entries answered per assessment
+func (r Repository) CampaignProgress(ctx context.Context, campaignID *primitive.ObjectID) ([]*CampaignParticipantProgress, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"campaignID": campaignID, "status": entity.StatusActive}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": entity.CollectionAssessmentEntry,
+			"let":  bson.M{"assessment": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"$expr":         bson.M{"$eq": bson.A{"$assessmentID", "$$assessment"}},
+					"skipped":       bson.M{"$ne": true},
+					"respondStatus": bson.M{"$ne": entity.ResponseStatusDeleted},
+				}},
+				bson.M{"$group": bson.M{
+					"_id":     nil,
+					"entries": bson.M{"$sum": 1},
+					"answered": bson.M{"$sum": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{"$respondStatus", entity.ResponseStatusToStart}}, 0, 1,
+					}}},
+				}},
+			},
+			"as": "progress",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         entity.CollectionSME,
+			"localField":   "smeID",
+			"foreignField": "_id",
+			"as":           "sme",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"smeID":        1,
+			"reviewStatus": 1,
+			"finalizedAt":  1,
+			"overall":      "$score.overall",
+			"companyName":  bson.M{"$arrayElemAt": bson.A{"$sme.companyName", 0}},
+			"entries":      bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$progress.entries", 0}}, 0}},
+			"answered":     bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$progress.answered", 0}}, 0}},
+		}}},
+	}
+
+	cursor, err := r.db.Collection(entity.CollectionAssessment).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	progress := make([]*CampaignParticipantProgress, 0)
+	if err := cursor.All(ctx, &progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// CasbinAdapter : casbin adapter keeping the policy in the casbinRule collection
+type CasbinAdapter struct {
+	r *Repository
+}
+
+// NewCasbinAdapter :
+func NewCasbinAdapter(r *Repository) *CasbinAdapter {
+	return &CasbinAdapter{r: r}
+}
+
+// LoadPolicy : load every stored rule into the model
+func (a *CasbinAdapter) LoadPolicy(m model.Model) error {
+	rules, err := a.r.FindCasbinRules(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		values := []string{rule.PType, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5}
+		for len(values) > 1 && values[len(values)-1] == "" {
+			values = values[:len(values)-1]
+		}
+		persist.LoadPolicyArray(values, m)
+	}
+	return nil
+}
+
+// SavePolicy : replace the stored rules with the rules of the model
+func (a *CasbinAdapter) SavePolicy(m model.Model) error {
+	var rules []entity.CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			for _, rule := range ast.Policy {
+				rules = append(rules, casbinRule(ptype, rule))
+			}
+		}
+	}
+	return a.r.ReplaceCasbinRules(context.Background(), rules)
+}
+
+// AddPolicy :
+func (a *CasbinAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	_, err := a.r.UpsertCasbinRule(context.Background(), casbinRule(ptype, rule))
+	return err
+}
+
+// RemovePolicy :
+func (a *CasbinAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	values := make([]string, 6)
+	copy(values, rule)
+	_, err := a.r.db.Collection(entity.CollectionCasbinRule).DeleteOne(context.Background(), casbinRuleQuery(ptype, values))
+	return err
+}
+
+// RemoveFilteredPolicy :
+func (a *CasbinAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	_, err := a.r.DeleteCasbinRules(context.Background(), ptype, fieldIndex, fieldValues...)
+	return err
+}
+
+// casbinRule :
+func casbinRule(ptype string, rule []string) entity.CasbinRule {
+	values := make([]string, 6)
+	copy(values, rule)
+	return entity.CasbinRule{
+		PType: ptype,
+		V0:    values[0],
+		V1:    values[1],
+		V2:    values[2],
+		V3:    values[3],
+		V4:    values[4],
+		V5:    values[5],
+	}
+}
+
+// PolicyWatcher : casbin watcher polling the policy version, so every instance reloads a policy changed by another one
+type PolicyWatcher struct {
+	r        *Repository
+	mu       sync.Mutex
+	version  int64
+	callback func(string)
+	stop     chan struct{}
+}
+
+// NewPolicyWatcher : start polling the policy version every interval
+func NewPolicyWatcher(r *Repository, interval time.Duration) (*PolicyWatcher, error) {
+	state, err := r.FindPolicyState(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	w := &PolicyWatcher{
+		r:       r,
+		version: state.Version,
+		stop:    make(chan struct{}),
+	}
+	go w.poll(interval)
+	return w, nil
+}
+
+// SetUpdateCallback :
+func (w *PolicyWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update : tell the other instances the policy has changed, this instance already has the change
+func (w *PolicyWatcher) Update() error {
+	version, err := w.r.IncrementPolicyVersion(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if version > w.version {
+		w.version = version
+	}
+	return nil
+}
+
+// Close :
+func (w *PolicyWatcher) Close() {
+	close(w.stop)
+}
+
+// poll :
+func (w *PolicyWatcher) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			// a failed check is retried on the next tick
+			state, err := w.r.FindPolicyState(context.Background())
+			if err != nil {
+				continue
+			}
+
+			w.mu.Lock()
+			changed := state.Version > w.version
+			if changed {
+				w.version = state.Version
+			}
+			callback := w.callback
+			w.mu.Unlock()
+
+			if changed && callback != nil {
+				callback(strconv.FormatInt(state.Version, 10))
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"csi-api/app/entity"
 	"strconv"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -17,7 +18,9 @@ type FindConnectionFilter struct {
 	IDs               []string
 	RequestCompanyID  string
 	ReceivedCompanyID string
+	CompanyID         string // either side of the connection
 	Status            entity.Status
+	Statuses          []entity.Status
 }
 
 // CreateConnection :
@@ -80,10 +83,25 @@ func (r Repository) FindConnections(ctx context.Context, filter FindConnectionFi
 		query["receivedCompanyID"] = oid
 	}
 
+	if filter.CompanyID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.CompanyID)
+		if err != nil {
+			return Connections, "", err
+		}
+		query["$or"] = bson.A{
+			bson.M{"requestCompanyID": oid},
+			bson.M{"receivedCompanyID": oid},
+		}
+	}
+
 	if filter.Status != "" {
 		query["status"] = filter.Status
 	}
 
+	if len(filter.Statuses) > 0 {
+		query["status"] = bson.M{"$in": filter.Statuses}
+	}
+
 	nextCursor, err := r.db.Collection(entity.CollectionConnection).Find(
 		ctx,
 		query,
@@ -121,3 +139,52 @@ func (r Repository) UpsertConnection(i *entity.Connection) (*mongo.UpdateResult,
 		bson.M{"$set": i},
 		options.Update().SetUpsert(true))
 }
+
+// AcceptConnection : activate a pending connection and link the SME with the corporate in one transaction,
+// mongo.ErrNoDocuments when the connection is no longer pending
+func (r Repository) AcceptConnection(ctx context.Context, i *entity.Connection) error {
+	callback := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		result, err := r.db.Collection(entity.CollectionConnection).UpdateOne(
+			sessCtx,
+			bson.M{"_id": i.ID, "status": entity.StatusInvited},
+			bson.M{"$set": bson.M{
+				"status":      entity.StatusActive,
+				"linkDate":    i.LinkDate,
+				"respondedBy": i.RespondedBy,
+				"respondedAt": i.RespondedAt,
+			}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+
+		// replace a link left over from an earlier connection
+		if _, err := r.db.Collection(entity.CollectionSME).UpdateOne(
+			sessCtx,
+			bson.M{"_id": i.ReceivedCompanyID},
+			bson.M{"$pull": bson.M{"linkedWiths": bson.M{"corporateID": i.RequestCompanyID}}}); err != nil {
+			return nil, err
+		}
+		return r.db.Collection(entity.CollectionSME).UpdateOne(
+			sessCtx,
+			bson.M{"_id": i.ReceivedCompanyID},
+			bson.M{
+				"$push": bson.M{"linkedWiths": entity.LinkCorporate{
+					CorporateID: i.RequestCompanyID,
+					LinkDate:    i.LinkDate,
+					Status:      entity.StatusActive,
+				}},
+				"$set": bson.M{"updatedAt": time.Now().UTC()},
+			})
+	}
+
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, callback)
+	return err
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindCorporateFilter :
+type FindCorporateFilter struct {
+	Cursor      string
+	CompanyName string
+	SSMNumbers  []string
+	IDs         []string
+	Status      entity.Status
+}
+
+// CreateCorporate :
+func (r Repository) CreateCorporate(ctx context.Context, i entity.Corporate) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionCorporate, i)
+}
+
+// FindCorporateByID :
+func (r Repository) FindCorporateByID(ctx context.Context, id string) (*entity.Corporate, error) {
+	corporate := new(entity.Corporate)
+	err := r.FindByObjectID(entity.CollectionCorporate, id, &corporate)
+	if err != nil {
+		return nil, err
+	}
+	return corporate, nil
+}
+
+// FindCorporates :
+func (r Repository) FindCorporates(ctx context.Context, filter FindCorporateFilter) ([]*entity.Corporate, string, error) {
+	var corporates []*entity.Corporate
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if len(filter.IDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.IDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.IDs[i])
+			if err != nil {
+				return corporates, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["_id"] = bson.M{"$in": oIds}
+	}
+
+	if filter.CompanyName != "" {
+		query["companyName"] = primitive.Regex{Pattern: filter.CompanyName, Options: "i"}
+	}
+
+	if len(filter.SSMNumbers) > 0 {
+		query["ssmNumber"] = bson.M{"$in": filter.SSMNumbers}
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionCorporate).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		corporate := new(entity.Corporate)
+		if err := nextCursor.Decode(corporate); err != nil {
+			return nil, "", err
+		}
+
+		corporates = append(corporates, corporate)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(corporates) > int(limit) {
+		return corporates[:len(corporates)-1], corporates[len(corporates)-1].ID.Hex(), nil
+	}
+	return corporates, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertCorporate :
+func (r Repository) UpsertCorporate(i *entity.Corporate) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionCorporate).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// DeleteCorporateByID : update status to deleted
+func (r Repository) DeleteCorporateByID(i *entity.Corporate) (*mongo.UpdateResult, error) {
+	i.Status = entity.StatusDeleted
+	i.DeletedAt = time.Now().UTC()
+	return r.UpsertCorporate(i)
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindCorporateUserFilter :
+type FindCorporateUserFilter struct {
+	Cursor    string
+	FirstName string
+	LastName  string
+	CompanyID string
+	IDs       []string
+	Emails    []string
+	Role      entity.UserRole
+	Status    entity.UserStatus
+}
+
+// CreateCorporateUser :
+func (r Repository) CreateCorporateUser(ctx context.Context, i entity.CorporateUser) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionCorporateUser, i)
+}
+
+// FindCorporateUserByID :
+func (r Repository) FindCorporateUserByID(ctx context.Context, id string) (*entity.CorporateUser, error) {
+	user := new(entity.CorporateUser)
+	err := r.FindByObjectID(entity.CollectionCorporateUser, id, &user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindCorporateUserByEmail :
+func (r Repository) FindCorporateUserByEmail(ctx context.Context, email string) (*entity.CorporateUser, error) {
+	user := new(entity.CorporateUser)
+	if err := r.db.Collection(entity.CollectionCorporateUser).FindOne(ctx, bson.M{
+		"email": email,
+	}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindCorporateUsers :
+func (r Repository) FindCorporateUsers(ctx context.Context, filter FindCorporateUserFilter) ([]*entity.CorporateUser, string, error) {
+	var users []*entity.CorporateUser
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 100
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if len(filter.IDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.IDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.IDs[i])
+			if err != nil {
+				return users, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["_id"] = bson.M{"$in": oIds}
+	}
+
+	if len(filter.Emails) > 0 {
+		query["email"] = bson.M{"$in": filter.Emails}
+	}
+
+	if filter.CompanyID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.CompanyID)
+		if err != nil {
+			return users, "", err
+		}
+		query["companyID"] = oid
+	}
+
+	if filter.FirstName != "" {
+		query["firstName"] = primitive.Regex{Pattern: filter.FirstName, Options: "i"}
+	}
+
+	if filter.LastName != "" {
+		query["lastName"] = primitive.Regex{Pattern: filter.LastName, Options: "i"}
+	}
+
+	if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionCorporateUser).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		user := new(entity.CorporateUser)
+		if err := nextCursor.Decode(user); err != nil {
+			return nil, "", err
+		}
+
+		users = append(users, user)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(users) > int(limit) {
+		return users[:len(users)-1], users[len(users)-1].ID.Hex(), nil
+	}
+	return users, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertCorporateUser :
+func (r Repository) UpsertCorporateUser(i *entity.CorporateUser) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionCorporateUser).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// DeleteCorporateUserByID : update status to deleted
+func (r Repository) DeleteCorporateUserByID(i *entity.CorporateUser) (*mongo.UpdateResult, error) {
+	i.Status = entity.UserStatusDeleted
+	i.DeletedAt = time.Now().UTC()
+	return r.UpsertCorporateUser(i)
+}
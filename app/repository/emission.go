@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindEmissionFactorTableFilter :
+type FindEmissionFactorTableFilter struct {
+	Cursor string
+	IDs    []string
+	State  entity.EmissionFactorTableState
+	Status entity.Status
+}
+
+// FindEmissionInventoryFilter :
+type FindEmissionInventoryFilter struct {
+	Cursor string
+	IDs    []string
+	SMEID  string
+	SMEIDs []string
+	Status entity.Status
+}
+
+// CreateEmissionFactorTable :
+func (r Repository) CreateEmissionFactorTable(ctx context.Context, i entity.EmissionFactorTable) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionEmissionFactor, i)
+}
+
+// FindEmissionFactorTableByID :
+func (r Repository) FindEmissionFactorTableByID(ctx context.Context, id string) (*entity.EmissionFactorTable, error) {
+	table := new(entity.EmissionFactorTable)
+	err := r.FindByObjectID(entity.CollectionEmissionFactor, id, &table)
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// FindEmissionFactorTables :
+func (r Repository) FindEmissionFactorTables(ctx context.Context, filter FindEmissionFactorTableFilter) ([]*entity.EmissionFactorTable, string, error) {
+	var tables []*entity.EmissionFactorTable
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if len(filter.IDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.IDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.IDs[i])
+			if err != nil {
+				return tables, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["_id"] = bson.M{"$in": oIds}
+	}
+
+	if filter.State != "" {
+		query["state"] = filter.State
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionEmissionFactor).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		table := new(entity.EmissionFactorTable)
+		if err := nextCursor.Decode(table); err != nil {
+			return nil, "", err
+		}
+
+		tables = append(tables, table)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(tables) > int(limit) {
+		return tables[:len(tables)-1], tables[len(tables)-1].ID.Hex(), nil
+	}
+	return tables, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertEmissionFactorTable :
+func (r Repository) UpsertEmissionFactorTable(i *entity.EmissionFactorTable) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionEmissionFactor).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// DeleteEmissionFactorTableByID : update status to deleted
+func (r Repository) DeleteEmissionFactorTableByID(i *entity.EmissionFactorTable) (*mongo.UpdateResult, error) {
+	i.Status = entity.StatusDeleted
+	i.DeletedAt = time.Now().UTC()
+	return r.UpsertEmissionFactorTable(i)
+}
+
+// CreateEmissionInventory :
+func (r Repository) CreateEmissionInventory(ctx context.Context, i entity.EmissionInventory) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionEmission, i)
+}
+
+// FindEmissionInventoryByID :
+func (r Repository) FindEmissionInventoryByID(ctx context.Context, id string) (*entity.EmissionInventory, error) {
+	inventory := new(entity.EmissionInventory)
+	err := r.FindByObjectID(entity.CollectionEmission, id, &inventory)
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// FindEmissionInventories :
+func (r Repository) FindEmissionInventories(ctx context.Context, filter FindEmissionInventoryFilter) ([]*entity.EmissionInventory, string, error) {
+	var inventories []*entity.EmissionInventory
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if len(filter.IDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.IDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.IDs[i])
+			if err != nil {
+				return inventories, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["_id"] = bson.M{"$in": oIds}
+	}
+
+	if filter.SMEID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.SMEID)
+		if err != nil {
+			return inventories, "", err
+		}
+		query["smeID"] = oid
+	}
+
+	if len(filter.SMEIDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.SMEIDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.SMEIDs[i])
+			if err != nil {
+				return inventories, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["smeID"] = bson.M{"$in": oIds}
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionEmission).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		inventory := new(entity.EmissionInventory)
+		if err := nextCursor.Decode(inventory); err != nil {
+			return nil, "", err
+		}
+
+		inventories = append(inventories, inventory)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(inventories) > int(limit) {
+		return inventories[:len(inventories)-1], inventories[len(inventories)-1].ID.Hex(), nil
+	}
+	return inventories, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertEmissionInventory :
+func (r Repository) UpsertEmissionInventory(i *entity.EmissionInventory) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionEmission).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// DeleteEmissionInventoryByID : update status to deleted
+func (r Repository) DeleteEmissionInventoryByID(i *entity.EmissionInventory) (*mongo.UpdateResult, error) {
+	i.Status = entity.StatusDeleted
+	i.DeletedAt = time.Now().UTC()
+	return r.UpsertEmissionInventory(i)
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindEvidenceFilter :
+type FindEvidenceFilter struct {
+	Cursor            string
+	IDs               []string
+	AssessmentID      string
+	AssessmentEntryID string
+	SMEID             string
+	Status            entity.Status
+}
+
+// CreateEvidence :
+func (r Repository) CreateEvidence(ctx context.Context, i entity.Evidence) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionEvidence, i)
+}
+
+// FindEvidenceByID :
+func (r Repository) FindEvidenceByID(ctx context.Context, id string) (*entity.Evidence, error) {
+	evidence := new(entity.Evidence)
+	err := r.FindByObjectID(entity.CollectionEvidence, id, &evidence)
+	if err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+// FindEvidences :
+func (r Repository) FindEvidences(ctx context.Context, filter FindEvidenceFilter) ([]*entity.Evidence, string, error) {
+	var evidences []*entity.Evidence
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if len(filter.IDs) > 0 {
+		oIds := make([]primitive.ObjectID, 0)
+		for i := 0; i < len(filter.IDs); i++ {
+			oid, err := primitive.ObjectIDFromHex(filter.IDs[i])
+			if err != nil {
+				return evidences, "", err
+			}
+			oIds = append(oIds, oid)
+		}
+		query["_id"] = bson.M{"$in": oIds}
+	}
+
+	if filter.SMEID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.SMEID)
+		if err != nil {
+			return evidences, "", err
+		}
+		query["smeID"] = oid
+	}
+
+	if filter.AssessmentID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.AssessmentID)
+		if err != nil {
+			return evidences, "", err
+		}
+		query["assessmentID"] = oid
+	}
+
+	if filter.AssessmentEntryID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.AssessmentEntryID)
+		if err != nil {
+			return evidences, "", err
+		}
+		query["assessmentEntryID"] = oid
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionEvidence).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		evidence := new(entity.Evidence)
+		if err := nextCursor.Decode(evidence); err != nil {
+			return nil, "", err
+		}
+
+		evidences = append(evidences, evidence)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(evidences) > int(limit) {
+		return evidences[:len(evidences)-1], evidences[len(evidences)-1].ID.Hex(), nil
+	}
+	return evidences, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertEvidence :
+func (r Repository) UpsertEvidence(i *entity.Evidence) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionEvidence).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// DeleteEvidenceByID : update status to deleted
+func (r Repository) DeleteEvidenceByID(i *entity.Evidence) (*mongo.UpdateResult, error) {
+	i.Status = entity.StatusDeleted
+	i.DeletedAt = time.Now().UTC()
+	return r.UpsertEvidence(i)
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindLockoutEventFilter :
+type FindLockoutEventFilter struct {
+	Cursor string
+	Key    string
+	Type   entity.LockoutEventType
+}
+
+// FindLoginThrottleByID :
+func (r Repository) FindLoginThrottleByID(ctx context.Context, id string) (*entity.LoginThrottle, error) {
+	throttle := new(entity.LoginThrottle)
+	if err := r.db.Collection(entity.CollectionLoginThrottle).FindOne(ctx, bson.M{
+		"_id": id,
+	}).Decode(&throttle); err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// FindLockedLoginThrottles : accounts and ip addresses locked at the given time
+func (r Repository) FindLockedLoginThrottles(ctx context.Context, at time.Time) ([]*entity.LoginThrottle, error) {
+	var throttles []*entity.LoginThrottle
+
+	cursor, err := r.db.Collection(entity.CollectionLoginThrottle).Find(
+		ctx,
+		bson.M{"lockedUntil": bson.M{"$gt": at}},
+		options.Find().SetSort(bson.M{"lockedUntil": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		throttle := new(entity.LoginThrottle)
+		if err := cursor.Decode(throttle); err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, throttle)
+	}
+	return throttles, cursor.Err()
+}
+
+// AddLoginFailure : count a failed login, the count starts again when the last failure is older than windowStart
+func (r Repository) AddLoginFailure(ctx context.Context, id string, kind entity.LoginThrottleKind, at time.Time, windowStart time.Time) (*entity.LoginThrottle, error) {
+	throttle := new(entity.LoginThrottle)
+	err := r.db.Collection(entity.CollectionLoginThrottle).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"kind": kind,
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$lastFailureAt", time.Time{}}}, windowStart}},
+				1,
+				bson.M{"$add": bson.A{"$failures", 1}},
+			}},
+			"lastFailureAt": at,
+			"updatedAt":     at,
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(throttle)
+	if err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// LockLoginThrottle :
+func (r Repository) LockLoginThrottle(ctx context.Context, id string, until time.Time) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionLoginThrottle).UpdateOne(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"lockedUntil": until, "updatedAt": time.Now().UTC()}})
+}
+
+// DeleteLoginThrottle : forget the failures of an account or ip address
+func (r Repository) DeleteLoginThrottle(ctx context.Context, id string) (*mongo.DeleteResult, error) {
+	return r.db.Collection(entity.CollectionLoginThrottle).DeleteOne(ctx, bson.M{"_id": id})
+}
+
+// CreateLockoutEvent :
+func (r Repository) CreateLockoutEvent(ctx context.Context, i entity.LockoutEvent) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionLockoutEvent, i)
+}
+
+// FindLockoutEvents :
+func (r Repository) FindLockoutEvents(ctx context.Context, filter FindLockoutEventFilter) ([]*entity.LockoutEvent, string, error) {
+	var events []*entity.LockoutEvent
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if filter.Key != "" {
+		query["key"] = filter.Key
+	}
+
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionLockoutEvent).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		event := new(entity.LockoutEvent)
+		if err := nextCursor.Decode(event); err != nil {
+			return nil, "", err
+		}
+
+		events = append(events, event)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(events) > int(limit) {
+		return events[:len(events)-1], events[len(events)-1].ID.Hex(), nil
+	}
+	return events, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
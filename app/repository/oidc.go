@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOIDCProviderFilter :
+type FindOIDCProviderFilter struct {
+	Cursor      string
+	AccountType entity.AccountType
+	Status      entity.Status
+}
+
+// CreateOIDCProvider :
+func (r Repository) CreateOIDCProvider(ctx context.Context, i entity.OIDCProvider) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionOIDCProvider, i)
+}
+
+// FindOIDCProviderByID :
+func (r Repository) FindOIDCProviderByID(ctx context.Context, id string) (*entity.OIDCProvider, error) {
+	provider := new(entity.OIDCProvider)
+	err := r.FindByObjectID(entity.CollectionOIDCProvider, id, &provider)
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// FindOIDCProviders :
+func (r Repository) FindOIDCProviders(ctx context.Context, filter FindOIDCProviderFilter) ([]*entity.OIDCProvider, string, error) {
+	var providers []*entity.OIDCProvider
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if filter.AccountType != "" {
+		query["accountType"] = filter.AccountType
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionOIDCProvider).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		provider := new(entity.OIDCProvider)
+		if err := nextCursor.Decode(provider); err != nil {
+			return nil, "", err
+		}
+
+		providers = append(providers, provider)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(providers) > int(limit) {
+		return providers[:len(providers)-1], providers[len(providers)-1].ID.Hex(), nil
+	}
+	return providers, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertOIDCProvider :
+func (r Repository) UpsertOIDCProvider(i *entity.OIDCProvider) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionOIDCProvider).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// CreateOIDCLogin :
+func (r Repository) CreateOIDCLogin(ctx context.Context, i entity.OIDCLogin) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionOIDCLogin, i)
+}
+
+// UseOIDCLogin : claim the unused and unexpired login of a state, a state can only be used by one callback
+func (r Repository) UseOIDCLogin(ctx context.Context, stateHash string) (*entity.OIDCLogin, error) {
+	timeNow := time.Now().UTC()
+	login := new(entity.OIDCLogin)
+	err := r.db.Collection(entity.CollectionOIDCLogin).FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"stateHash": stateHash,
+			"usedAt":    time.Time{},
+			"expiresAt": bson.M{"$gt": timeNow},
+		},
+		bson.M{"$set": bson.M{
+			"usedAt":    timeNow,
+			"updatedAt": timeNow,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(login)
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// FindOIDCIdentity : account linked to the subject of a provider
+func (r Repository) FindOIDCIdentity(ctx context.Context, providerID *primitive.ObjectID, subject string) (*entity.OIDCIdentity, error) {
+	identity := new(entity.OIDCIdentity)
+	if err := r.db.Collection(entity.CollectionOIDCIdentity).FindOne(ctx, bson.M{
+		"providerID": providerID,
+		"subject":    subject,
+	}).Decode(&identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// UpsertOIDCIdentity :
+func (r Repository) UpsertOIDCIdentity(i *entity.OIDCIdentity) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionOIDCIdentity).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
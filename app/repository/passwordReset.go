@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreatePasswordReset :
+func (r Repository) CreatePasswordReset(ctx context.Context, i entity.PasswordReset) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionPasswordReset, i)
+}
+
+// FindPasswordResetByTokenHash :
+func (r Repository) FindPasswordResetByTokenHash(ctx context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	reset := new(entity.PasswordReset)
+	if err := r.db.Collection(entity.CollectionPasswordReset).FindOne(ctx, bson.M{
+		"tokenHash": tokenHash,
+	}).Decode(&reset); err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
+
+// CountPasswordResets : number of reset requests of an email since the given time
+func (r Repository) CountPasswordResets(ctx context.Context, email string, since time.Time) (int64, error) {
+	return r.db.Collection(entity.CollectionPasswordReset).CountDocuments(ctx, bson.M{
+		"email":     email,
+		"createdAt": bson.M{"$gte": since},
+	})
+}
+
+// UpsertPasswordReset :
+func (r Repository) UpsertPasswordReset(i *entity.PasswordReset) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionPasswordReset).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// CancelPasswordResets : cancel the active requests of a user
+func (r Repository) CancelPasswordResets(ctx context.Context, userID *primitive.ObjectID) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionPasswordReset).UpdateMany(
+		ctx,
+		bson.M{"userID": userID, "status": entity.PasswordResetStatusActive},
+		bson.M{"$set": bson.M{
+			"status":    entity.PasswordResetStatusCancelled,
+			"updatedAt": time.Now().UTC(),
+		}})
+}
+
+// UsePasswordReset : mark an active request as used, returns false when it was already used or cancelled
+func (r Repository) UsePasswordReset(ctx context.Context, id *primitive.ObjectID) (bool, error) {
+	timeNow := time.Now().UTC()
+	result, err := r.db.Collection(entity.CollectionPasswordReset).UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": entity.PasswordResetStatusActive},
+		bson.M{"$set": bson.M{
+			"status":    entity.PasswordResetStatusUsed,
+			"usedAt":    timeNow,
+			"updatedAt": timeNow,
+		}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
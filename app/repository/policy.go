@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// policyStateID : the policy state is a single document
+const policyStateID = "casbin"
+
+// FindPolicyChangeFilter :
+type FindPolicyChangeFilter struct {
+	Cursor string
+	By     string
+	PType  string
+	Action entity.PolicyChangeAction
+}
+
+// FindCasbinRules : every stored policy and grouping rule
+func (r Repository) FindCasbinRules(ctx context.Context) ([]*entity.CasbinRule, error) {
+	var rules []*entity.CasbinRule
+
+	cursor, err := r.db.Collection(entity.CollectionCasbinRule).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		rule := new(entity.CasbinRule)
+		if err := cursor.Decode(rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, cursor.Err()
+}
+
+// UpsertCasbinRule : store a rule once, adding an existing rule changes nothing
+func (r Repository) UpsertCasbinRule(ctx context.Context, i entity.CasbinRule) (*mongo.UpdateResult, error) {
+	query := casbinRuleQuery(i.PType, []string{i.V0, i.V1, i.V2, i.V3, i.V4, i.V5})
+	return r.db.Collection(entity.CollectionCasbinRule).UpdateOne(
+		ctx,
+		query,
+		bson.M{"$set": query},
+		options.Update().SetUpsert(true))
+}
+
+// DeleteCasbinRules : remove the rules of a type matching the values, from the field at fieldIndex on.
+// An empty value matches any value of its field.
+func (r Repository) DeleteCasbinRules(ctx context.Context, ptype string, fieldIndex int, values ...string) (*mongo.DeleteResult, error) {
+	query := bson.M{"ptype": ptype}
+	for i, v := range values {
+		if v != "" {
+			query["v"+strconv.Itoa(fieldIndex+i)] = v
+		}
+	}
+	return r.db.Collection(entity.CollectionCasbinRule).DeleteMany(ctx, query)
+}
+
+// ReplaceCasbinRules : replace the whole stored policy
+func (r Repository) ReplaceCasbinRules(ctx context.Context, rules []entity.CasbinRule) error {
+	if _, err := r.db.Collection(entity.CollectionCasbinRule).DeleteMany(ctx, bson.M{}); err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		docs = append(docs, rule)
+	}
+	_, err := r.db.Collection(entity.CollectionCasbinRule).InsertMany(ctx, docs)
+	return err
+}
+
+// casbinRuleQuery : a rule matches on its type and every field, unused fields are empty
+func casbinRuleQuery(ptype string, values []string) bson.M {
+	query := bson.M{"ptype": ptype}
+	for i := 0; i < 6; i++ {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		query["v"+strconv.Itoa(i)] = v
+	}
+	return query
+}
+
+// FindPolicyState :
+func (r Repository) FindPolicyState(ctx context.Context) (*entity.PolicyState, error) {
+	state := new(entity.PolicyState)
+	err := r.db.Collection(entity.CollectionPolicyState).FindOne(ctx, bson.M{"_id": policyStateID}).Decode(state)
+	if err == mongo.ErrNoDocuments {
+		return &entity.PolicyState{ID: policyStateID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// IncrementPolicyVersion : mark the stored policy changed, returns the new version
+func (r Repository) IncrementPolicyVersion(ctx context.Context) (int64, error) {
+	state := new(entity.PolicyState)
+	err := r.db.Collection(entity.CollectionPolicyState).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": policyStateID},
+		bson.M{
+			"$inc": bson.M{"version": 1},
+			"$set": bson.M{"updatedAt": time.Now().UTC()},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(state)
+	if err != nil {
+		return 0, err
+	}
+	return state.Version, nil
+}
+
+// AddSeededPolicies : remember default rules which have been imported
+func (r Repository) AddSeededPolicies(ctx context.Context, keys []string) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionPolicyState).UpdateOne(
+		ctx,
+		bson.M{"_id": policyStateID},
+		bson.M{
+			"$addToSet": bson.M{"seeded": bson.M{"$each": keys}},
+			"$set":      bson.M{"updatedAt": time.Now().UTC()},
+		},
+		options.Update().SetUpsert(true))
+}
+
+// AddRetiredPolicies : remember retired default rules which have been removed
+func (r Repository) AddRetiredPolicies(ctx context.Context, keys []string) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionPolicyState).UpdateOne(
+		ctx,
+		bson.M{"_id": policyStateID},
+		bson.M{
+			"$addToSet": bson.M{"retired": bson.M{"$each": keys}},
+			"$set":      bson.M{"updatedAt": time.Now().UTC()},
+		},
+		options.Update().SetUpsert(true))
+}
+
+// CreatePolicyChange :
+func (r Repository) CreatePolicyChange(ctx context.Context, i entity.PolicyChange) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionPolicyChange, i)
+}
+
+// FindPolicyChanges :
+func (r Repository) FindPolicyChanges(ctx context.Context, filter FindPolicyChangeFilter) ([]*entity.PolicyChange, string, error) {
+	var changes []*entity.PolicyChange
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if filter.By != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.By)
+		if err != nil {
+			return changes, "", err
+		}
+		query["by"] = oid
+	}
+
+	if filter.PType != "" {
+		query["ptype"] = filter.PType
+	}
+
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionPolicyChange).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		change := new(entity.PolicyChange)
+		if err := nextCursor.Decode(change); err != nil {
+			return nil, "", err
+		}
+
+		changes = append(changes, change)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(changes) > int(limit) {
+		return changes[:len(changes)-1], changes[len(changes)-1].ID.Hex(), nil
+	}
+	return changes, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PortfolioCoverage : how far the connected SMEs of a corporate are with their assessments
+type PortfolioCoverage struct {
+	Connected  int `bson:"connected" json:"connected"`
+	Assessed   int `bson:"assessed" json:"assessed"`     // a scored assessment is shared with the corporate
+	InProgress int `bson:"inProgress" json:"inProgress"` // answering an assessment
+	NotStarted int `bson:"notStarted" json:"notStarted"`
+}
+
+// PortfolioScoreBucket : number of suppliers whose overall score is in [Min, Min+20), the last bucket includes 100
+type PortfolioScoreBucket struct {
+	Min   float64 `bson:"_id" json:"min"`
+	Count int     `bson:"count" json:"count"`
+}
+
+// PortfolioDimension : scores of a dimension across the suppliers
+type PortfolioDimension struct {
+	Dimension string  `bson:"_id" json:"dimension"`
+	Average   float64 `bson:"average" json:"average"`
+	Min       float64 `bson:"min" json:"min"`
+	Suppliers int     `bson:"suppliers" json:"suppliers"`
+}
+
+// PortfolioScores : distribution of the latest shared scores of the suppliers
+type PortfolioScores struct {
+	Suppliers    int                    `bson:"suppliers" json:"suppliers"`
+	Average      float64                `bson:"average" json:"average"`
+	Distribution []PortfolioScoreBucket `bson:"distribution" json:"distribution"`
+	Dimensions   []PortfolioDimension   `bson:"dimensions" json:"dimensions"` // weakest first
+}
+
+// PortfolioRisk : supplier whose latest shared score is below the risk threshold
+type PortfolioRisk struct {
+	SMEID          *primitive.ObjectID     `bson:"smeID" json:"smeID"`
+	CompanyName    string                  `bson:"companyName" json:"companyName"`
+	AssessmentID   *primitive.ObjectID     `bson:"assessmentID" json:"assessmentID"`
+	Overall        float64                 `bson:"overall" json:"overall"`
+	WeakDimensions []entity.DimensionScore `bson:"weakDimensions" json:"weakDimensions"`
+	ScoredAt       time.Time               `bson:"scoredAt" json:"scoredAt"`
+}
+
+// PortfolioInvitation : invitation the SME has not answered yet
+type PortfolioInvitation struct {
+	ConnectionID *primitive.ObjectID `bson:"_id" json:"connectionID"`
+	SMEID        *primitive.ObjectID `bson:"smeID" json:"smeID"`
+	CompanyName  string              `bson:"companyName" json:"companyName"`
+	InvitedEmail string              `bson:"invitedEmail" json:"invitedEmail"`
+	InvitedAt    time.Time           `bson:"invitedAt" json:"invitedAt"`
+	DaysPending  int                 `bson:"daysPending" json:"daysPending"`
+}
+
+// connectedSMEs : stages matching the active connections of a corporate
+func connectedSMEs(corporateID *primitive.ObjectID) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"requestCompanyID": corporateID, "status": entity.StatusActive}}},
+	}
+}
+
+// latestSharedAssessment : stage looking up, as "latest", the latest scored assessment of the connected SME whose
+// score is shared with the corporate at the given time
+func latestSharedAssessment(corporateID *primitive.ObjectID, at time.Time) bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.M{
+		"from": entity.CollectionAssessment,
+		"let":  bson.M{"sme": "$receivedCompanyID"},
+		"pipeline": bson.A{
+			bson.M{"$match": bson.M{
+				"$expr":  bson.M{"$eq": bson.A{"$smeID", "$$sme"}},
+				"status": entity.StatusActive,
+				"score":  bson.M{"$ne": nil},
+				"sharedWiths": bson.M{"$elemMatch": bson.M{
+					"corporateID": corporateID,
+					"status":      entity.StatusActive,
+					"expiresAt":   bson.M{"$gt": at},
+					"scopes":      entity.ShareScopeScore,
+				}},
+			}},
+			bson.M{"$sort": bson.M{"score.scoredAt": -1}},
+			bson.M{"$limit": 1},
+			bson.M{"$project": bson.M{"smeID": 1, "score": 1}},
+		},
+		"as": "latest",
+	}}}
+}
+
+// PortfolioCoverage : count the connected SMEs of the corporate by assessment progress. SMEs without a shared
+// score are in progress when an entry of one of their open assessments has been answered.
+func (r Repository) PortfolioCoverage(ctx context.Context, corporateID *primitive.ObjectID, at time.Time) (*PortfolioCoverage, error) {
+	pipeline := append(connectedSMEs(corporateID),
+		latestSharedAssessment(corporateID, at),
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from": entity.CollectionAssessment,
+			"let":  bson.M{"sme": "$receivedCompanyID"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"$expr":        bson.M{"$eq": bson.A{"$smeID", "$$sme"}},
+					"status":       entity.StatusActive,
+					"reviewStatus": bson.M{"$ne": entity.ReviewStatusFinalized},
+				}},
+				bson.M{"$lookup": bson.M{
+					"from": entity.CollectionAssessmentEntry,
+					"let":  bson.M{"assessment": "$_id"},
+					"pipeline": bson.A{
+						bson.M{"$match": bson.M{
+							"$expr":         bson.M{"$eq": bson.A{"$assessmentID", "$$assessment"}},
+							"respondStatus": bson.M{"$nin": bson.A{entity.ResponseStatusToStart, entity.ResponseStatusDeleted}},
+						}},
+						bson.M{"$limit": 1},
+						bson.M{"$project": bson.M{"_id": 1}},
+					},
+					"as": "answered",
+				}},
+				bson.M{"$match": bson.M{"answered.0": bson.M{"$exists": true}}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "answered",
+		}}},
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":       nil,
+			"connected": bson.M{"$sum": 1},
+			"assessed": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$size": "$latest"}, 0}}, 1, 0,
+			}}},
+			"inProgress": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$size": "$latest"}, 0}},
+					bson.M{"$gt": bson.A{bson.M{"$size": "$answered"}, 0}},
+				}}, 1, 0,
+			}}},
+		}}},
+	)
+
+	cursor, err := r.db.Collection(entity.CollectionConnection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	coverage := new(PortfolioCoverage)
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(coverage); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	coverage.NotStarted = coverage.Connected - coverage.Assessed - coverage.InProgress
+	return coverage, nil
+}
+
+// PortfolioScores : distribution of the latest shared overall scores in buckets of 20 points and the average
+// score per dimension, weakest first
+func (r Repository) PortfolioScores(ctx context.Context, corporateID *primitive.ObjectID, at time.Time, dimensions int) (*PortfolioScores, error) {
+	pipeline := append(connectedSMEs(corporateID),
+		latestSharedAssessment(corporateID, at),
+		bson.D{{Key: "$unwind", Value: "$latest"}},
+		bson.D{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$latest"}}},
+		bson.D{{Key: "$facet", Value: bson.M{
+			"overall": bson.A{
+				bson.M{"$group": bson.M{"_id": nil, "suppliers": bson.M{"$sum": 1}, "average": bson.M{"$avg": "$score.overall"}}},
+			},
+			"distribution": bson.A{
+				bson.M{"$match": bson.M{"score.overall": bson.M{"$gte": 0, "$lte": 100}}},
+				bson.M{"$bucket": bson.M{
+					"groupBy":    "$score.overall",
+					"boundaries": bson.A{0, 20, 40, 60, 80, 100.000001},
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}},
+			},
+			"dimensions": bson.A{
+				bson.M{"$unwind": "$score.dimensions"},
+				bson.M{"$match": bson.M{"score.dimensions.scored": bson.M{"$gt": 0}}},
+				bson.M{"$group": bson.M{
+					"_id":       "$score.dimensions.dimension",
+					"average":   bson.M{"$avg": "$score.dimensions.score"},
+					"min":       bson.M{"$min": "$score.dimensions.score"},
+					"suppliers": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.D{{Key: "average", Value: 1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": dimensions},
+			},
+		}}},
+	)
+
+	cursor, err := r.db.Collection(entity.CollectionConnection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Overall []struct {
+			Suppliers int     `bson:"suppliers"`
+			Average   float64 `bson:"average"`
+		} `bson:"overall"`
+		Distribution []PortfolioScoreBucket `bson:"distribution"`
+		Dimensions   []PortfolioDimension   `bson:"dimensions"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	// $bucket leaves out the empty buckets
+	scores := &PortfolioScores{
+		Distribution: make([]PortfolioScoreBucket, 0, 5),
+		Dimensions:   result.Dimensions,
+	}
+	for min := 0.0; min < 100; min += 20 {
+		bucket := PortfolioScoreBucket{Min: min}
+		for _, b := range result.Distribution {
+			if b.Min == min {
+				bucket.Count = b.Count
+			}
+		}
+		scores.Distribution = append(scores.Distribution, bucket)
+	}
+	if scores.Dimensions == nil {
+		scores.Dimensions = []PortfolioDimension{}
+	}
+	if len(result.Overall) > 0 {
+		scores.Suppliers = result.Overall[0].Suppliers
+		scores.Average = result.Overall[0].Average
+	}
+	return scores, nil
+}
+
+// PortfolioRisks : suppliers whose latest shared overall score, or the score of one of its dimensions, is below
+// the threshold, lowest overall score first
+func (r Repository) PortfolioRisks(ctx context.Context, corporateID *primitive.ObjectID, at time.Time, threshold float64) ([]*PortfolioRisk, error) {
+	pipeline := append(connectedSMEs(corporateID),
+		latestSharedAssessment(corporateID, at),
+		bson.D{{Key: "$unwind", Value: "$latest"}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"smeID":        "$receivedCompanyID",
+			"assessmentID": "$latest._id",
+			"overall":      "$latest.score.overall",
+			"scoredAt":     "$latest.score.scoredAt",
+			"weakDimensions": bson.M{"$filter": bson.M{
+				"input": "$latest.score.dimensions",
+				"as":    "d",
+				"cond": bson.M{"$and": bson.A{
+					bson.M{"$gt": bson.A{"$$d.scored", 0}},
+					bson.M{"$lt": bson.A{"$$d.score", threshold}},
+				}},
+			}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"overall": bson.M{"$lt": threshold}},
+			bson.M{"weakDimensions.0": bson.M{"$exists": true}},
+		}}}},
+		bson.D{{Key: "$lookup", Value: bson.M{
+			"from":         entity.CollectionSME,
+			"localField":   "smeID",
+			"foreignField": "_id",
+			"as":           "sme",
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.M{"companyName": bson.M{"$arrayElemAt": bson.A{"$sme.companyName", 0}}}}},
+		bson.D{{Key: "$project", Value: bson.M{"sme": 0}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "overall", Value: 1}, {Key: "smeID", Value: 1}}}},
+	)
+
+	cursor, err := r.db.Collection(entity.CollectionConnection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	risks := make([]*PortfolioRisk, 0)
+	if err := cursor.All(ctx, &risks); err != nil {
+		return nil, err
+	}
+	return risks, nil
+}
+
+// PortfolioOverdueInvitations : invitations of the corporate still pending at the cutoff, oldest first
+func (r Repository) PortfolioOverdueInvitations(ctx context.Context, corporateID *primitive.ObjectID, at time.Time, cutoff time.Time) ([]*PortfolioInvitation, error) {
+	// connections created before invitations were recorded only have a link date
+	invitedAt := bson.M{"$max": bson.A{"$invitedAt", "$linkDate"}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"requestCompanyID": corporateID, "status": entity.StatusInvited}}},
+		{{Key: "$addFields", Value: bson.M{"invitedAt": invitedAt}}},
+		{{Key: "$match", Value: bson.M{"invitedAt": bson.M{"$lt": cutoff}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         entity.CollectionSME,
+			"localField":   "receivedCompanyID",
+			"foreignField": "_id",
+			"as":           "sme",
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"smeID":        "$receivedCompanyID",
+			"companyName":  bson.M{"$arrayElemAt": bson.A{"$sme.companyName", 0}},
+			"invitedEmail": 1,
+			"invitedAt":    1,
+			"daysPending": bson.M{"$floor": bson.M{"$divide": bson.A{
+				bson.M{"$subtract": bson.A{at, "$invitedAt"}},
+				int64(24 * time.Hour / time.Millisecond),
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "invitedAt", Value: 1}}}},
+	}
+
+	cursor, err := r.db.Collection(entity.CollectionConnection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invitations := make([]*PortfolioInvitation, 0)
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
@@ -14,10 +14,12 @@ import (
 
 // FindQuestionSetFilter :
 type FindQuestionSetFilter struct {
-	Cursor string
-	Label  string
-	IDs    []string
-	Status entity.Status
+	Cursor     string
+	Label      string
+	RevisionOf string
+	IDs        []string
+	State      entity.QuestionSetState
+	Status     entity.Status
 }
 
 // CreateQuestionSet :
@@ -68,6 +70,18 @@ func (r Repository) FindQuestionSets(ctx context.Context, filter FindQuestionSet
 		query["label"] = primitive.Regex{Pattern: filter.Label, Options: "i"}
 	}
 
+	if filter.RevisionOf != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.RevisionOf)
+		if err != nil {
+			return questionSets, "", err
+		}
+		query["revisionOf"] = oid
+	}
+
+	if filter.State != "" {
+		query["state"] = filter.State
+	}
+
 	if filter.Status != "" {
 		query["status"] = filter.Status
 	}
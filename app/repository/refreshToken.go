@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateRefreshToken :
+func (r Repository) CreateRefreshToken(ctx context.Context, i entity.RefreshToken) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionRefreshToken, i)
+}
+
+// FindRefreshTokenByID :
+func (r Repository) FindRefreshTokenByID(ctx context.Context, id string) (*entity.RefreshToken, error) {
+	token := new(entity.RefreshToken)
+	err := r.FindByObjectID(entity.CollectionRefreshToken, id, &token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// UpsertRefreshToken :
+func (r Repository) UpsertRefreshToken(i *entity.RefreshToken) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionRefreshToken).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// UseRefreshToken : mark an active token as used, returns false when the token was already used or revoked
+func (r Repository) UseRefreshToken(ctx context.Context, id *primitive.ObjectID, replacedBy *primitive.ObjectID) (bool, error) {
+	timeNow := time.Now().UTC()
+	result, err := r.db.Collection(entity.CollectionRefreshToken).UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": entity.RefreshTokenStatusActive},
+		bson.M{"$set": bson.M{
+			"status":     entity.RefreshTokenStatusUsed,
+			"usedAt":     timeNow,
+			"replacedBy": replacedBy,
+			"updatedAt":  timeNow,
+		}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeRefreshTokens : revoke the active tokens of a user, or of one session only when sessionID is given
+func (r Repository) RevokeRefreshTokens(ctx context.Context, userID *primitive.ObjectID, sessionID *primitive.ObjectID) (*mongo.UpdateResult, error) {
+	timeNow := time.Now().UTC()
+	query := bson.M{"userID": userID, "status": entity.RefreshTokenStatusActive}
+	if sessionID != nil {
+		query["sessionID"] = sessionID
+	}
+	return r.db.Collection(entity.CollectionRefreshToken).UpdateMany(
+		ctx,
+		query,
+		bson.M{"$set": bson.M{
+			"status":    entity.RefreshTokenStatusRevoked,
+			"revokedAt": timeNow,
+			"updatedAt": timeNow,
+		}})
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindSessionFilter :
+type FindSessionFilter struct {
+	Cursor string
+	UserID string
+	Status entity.SessionStatus
+}
+
+// CreateSession :
+func (r Repository) CreateSession(ctx context.Context, i entity.Session) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionSession, i)
+}
+
+// FindSessionByID :
+func (r Repository) FindSessionByID(ctx context.Context, id string) (*entity.Session, error) {
+	session := new(entity.Session)
+	err := r.FindByObjectID(entity.CollectionSession, id, &session)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// FindSessions :
+func (r Repository) FindSessions(ctx context.Context, filter FindSessionFilter) ([]*entity.Session, string, error) {
+	var sessions []*entity.Session
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 50
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if filter.UserID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.UserID)
+		if err != nil {
+			return sessions, "", err
+		}
+		query["userID"] = oid
+	}
+
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionSession).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		session := new(entity.Session)
+		if err := nextCursor.Decode(session); err != nil {
+			return nil, "", err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(sessions) > int(limit) {
+		return sessions[:len(sessions)-1], sessions[len(sessions)-1].ID.Hex(), nil
+	}
+	return sessions, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
+
+// UpsertSession :
+func (r Repository) UpsertSession(i *entity.Session) (*mongo.UpdateResult, error) {
+	return r.db.Collection(entity.CollectionSession).UpdateOne(
+		context.Background(),
+		bson.M{"_id": i.ID},
+		bson.M{"$set": i},
+		options.Update().SetUpsert(true))
+}
+
+// RevokeSessions : revoke the active sessions of a user, or one session only when sessionID is given, together
+// with their refresh tokens
+func (r Repository) RevokeSessions(ctx context.Context, userID *primitive.ObjectID, sessionID *primitive.ObjectID, revokedBy *primitive.ObjectID) (*mongo.UpdateResult, error) {
+	timeNow := time.Now().UTC()
+	query := bson.M{"userID": userID, "status": entity.SessionStatusActive}
+	if sessionID != nil {
+		query["_id"] = sessionID
+	}
+
+	result, err := r.db.Collection(entity.CollectionSession).UpdateMany(
+		ctx,
+		query,
+		bson.M{"$set": bson.M{
+			"status":    entity.SessionStatusRevoked,
+			"revokedAt": timeNow,
+			"revokedBy": revokedBy,
+			"updatedAt": timeNow,
+		}})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.RevokeRefreshTokens(ctx, userID, sessionID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
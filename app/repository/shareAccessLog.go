@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"csi-api/app/entity"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindShareAccessLogFilter :
+type FindShareAccessLogFilter struct {
+	Cursor       string
+	AssessmentID string
+	SMEID        string
+	CorporateID  string
+}
+
+// CreateShareAccessLog :
+func (r Repository) CreateShareAccessLog(ctx context.Context, i entity.ShareAccessLog) (*mongo.InsertOneResult, error) {
+	return r.Create(entity.CollectionShareAccessLog, i)
+}
+
+// FindShareAccessLogs :
+func (r Repository) FindShareAccessLogs(ctx context.Context, filter FindShareAccessLogFilter) ([]*entity.ShareAccessLog, string, error) {
+	var logs []*entity.ShareAccessLog
+
+	query := bson.M{}
+	sortQuery := bson.M{}
+
+	var limit int64 = 100
+
+	if filter.Cursor != "" {
+		objectID, err := primitive.ObjectIDFromHex(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query["_id"] = bson.M{"$gte": objectID}
+	}
+
+	if filter.AssessmentID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.AssessmentID)
+		if err != nil {
+			return logs, "", err
+		}
+		query["assessmentID"] = oid
+	}
+
+	if filter.SMEID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.SMEID)
+		if err != nil {
+			return logs, "", err
+		}
+		query["smeID"] = oid
+	}
+
+	if filter.CorporateID != "" {
+		oid, err := primitive.ObjectIDFromHex(filter.CorporateID)
+		if err != nil {
+			return logs, "", err
+		}
+		query["corporateID"] = oid
+	}
+
+	nextCursor, err := r.db.Collection(entity.CollectionShareAccessLog).Find(
+		ctx,
+		query,
+		options.Find().SetLimit(limit+1).SetSort(sortQuery))
+
+	if err != nil {
+		return nil, "", err
+	}
+	defer nextCursor.Close(ctx)
+
+	for nextCursor.Next(ctx) {
+		log := new(entity.ShareAccessLog)
+		if err := nextCursor.Decode(log); err != nil {
+			return nil, "", err
+		}
+
+		logs = append(logs, log)
+	}
+
+	if err := nextCursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(logs) > int(limit) {
+		return logs[:len(logs)-1], logs[len(logs)-1].ID.Hex(), nil
+	}
+	return logs, strconv.FormatInt(nextCursor.ID(), 10), nil
+}
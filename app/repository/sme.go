@@ -14,12 +14,16 @@ import (
 
 // FindSMEFilter :
 type FindSMEFilter struct {
-	Cursor      string
-	CompanyName string
-	SSMNumbers  []string
-	IDs         []string
-	LinkedWiths []string
-	Status      entity.Status
+	Cursor             string
+	CompanyName        string
+	MSIC               string
+	State              string
+	BusinessEntity     entity.BusinessEntity
+	RegisteredInEastMY *bool
+	SSMNumbers         []string
+	IDs                []string
+	LinkedWiths        []string
+	Status             entity.Status
 }
 
 // CreateSME :
@@ -86,6 +90,22 @@ func (r Repository) FindSMEs(ctx context.Context, filter FindSMEFilter) ([]*enti
 		query["ssmNumber"] = bson.M{"$in": filter.SSMNumbers}
 	}
 
+	if filter.MSIC != "" {
+		query["msic"] = filter.MSIC
+	}
+
+	if filter.State != "" {
+		query["state"] = filter.State
+	}
+
+	if filter.BusinessEntity != "" {
+		query["businessEntity"] = filter.BusinessEntity
+	}
+
+	if filter.RegisteredInEastMY != nil {
+		query["registeredInEastMY"] = *filter.RegisteredInEastMY
+	}
+
 	if filter.Status != "" {
 		query["status"] = filter.Status
 	}
@@ -134,3 +154,52 @@ func (r Repository) DeleteSMEByID(i *entity.SME) (*mongo.UpdateResult, error) {
 	i.DeletedAt = time.Now().UTC()
 	return r.UpsertSME(i)
 }
+
+// UnlinkSMECorporate : remove the link of an SME with a corporate, ending their connections and the assessment
+// shares with the corporate in one transaction. The SME is not modified when it is not linked with the corporate.
+func (r Repository) UnlinkSMECorporate(ctx context.Context, smeID *primitive.ObjectID, corporateID *primitive.ObjectID) (*mongo.UpdateResult, error) {
+	callback := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// end the connections between the two as well
+		if _, err := r.db.Collection(entity.CollectionConnection).UpdateMany(
+			sessCtx,
+			bson.M{
+				"requestCompanyID":  corporateID,
+				"receivedCompanyID": smeID,
+				"status":            bson.M{"$in": []entity.Status{entity.StatusInvited, entity.StatusActive}},
+			},
+			bson.M{"$set": bson.M{"status": entity.StatusInActive}}); err != nil {
+			return nil, err
+		}
+		// and the assessment shares, which are for connected corporates only
+		if _, err := r.db.Collection(entity.CollectionAssessment).UpdateMany(
+			sessCtx,
+			bson.M{"smeID": smeID, "sharedWiths": bson.M{"$elemMatch": bson.M{"corporateID": corporateID, "status": entity.StatusActive}}},
+			bson.M{"$set": bson.M{
+				"sharedWiths.$[share].status":    entity.StatusInActive,
+				"sharedWiths.$[share].revokedAt": time.Now().UTC(),
+			}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+				bson.M{"share.corporateID": corporateID, "share.status": entity.StatusActive},
+			}})); err != nil {
+			return nil, err
+		}
+		return r.db.Collection(entity.CollectionSME).UpdateOne(
+			sessCtx,
+			bson.M{"_id": smeID, "linkedWiths.corporateID": corporateID},
+			bson.M{
+				"$pull": bson.M{"linkedWiths": bson.M{"corporateID": corporateID}},
+				"$set":  bson.M{"updatedAt": time.Now().UTC()},
+			})
+	}
+
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	result, err := session.WithTransaction(ctx, callback)
+	if err != nil {
+		return nil, err
+	}
+	return result.(*mongo.UpdateResult), nil
+}
@@ -40,6 +40,10 @@ const (
 	RecordFound          Code = "record_found"
 	AuthenticationError  Code = "authentication_error"
 	InvalidToken         Code = "invalid_token"
+	EmailNotVerified     Code = "email_not_verified"
+	InvalidTwoFactorCode Code = "invalid_two_factor_code"
+	LoginThrottled       Code = "login_throttled"
+	AccountLocked        Code = "account_locked"
 
 	// Process error
 	InvalidRequest               Code = "invalid_request"
@@ -57,8 +61,23 @@ const (
 	StatusInActive               Code = "status_inactive"
 	ExceedUserLimit              Code = "exceed_user_limit"
 	MismatchSME                  Code = "mismatch_sme_id"
+	MismatchCorporate            Code = "mismatch_corporate_id"
 	EmailError                   Code = "email_error"
 	ResourceNotFound             Code = "resource_not_found"
+	AssessmentNotSubmitted       Code = "assessment_not_submitted"
+	AssessmentIncomplete         Code = "assessment_incomplete"
+	InvalidAnswer                Code = "invalid_answer"
+	EmissionFactorMissing        Code = "emission_factor_missing"
+	EmissionTableNotDraft        Code = "emission_factor_table_not_draft"
+	EmissionTableNotPublished    Code = "emission_factor_table_not_published"
+	EntryNotInReview             Code = "entry_not_in_review"
+	AssessmentFinalized          Code = "assessment_finalized"
+	QuestionSetNotDraft          Code = "question_set_not_draft"
+	QuestionSetNotPublished      Code = "question_set_not_published"
+	ConnectionExists             Code = "connection_exists"
+	ConnectionNotPending         Code = "connection_not_pending"
+	CorporateNotConnected        Code = "corporate_not_connected"
+	AssessmentNotShared          Code = "assessment_not_shared"
 
 	// API Key
 	InvalidAPIKey     Code = "invalid_api_key"
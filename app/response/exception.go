@@ -1,6 +1,7 @@
 package response
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"csi-api/app/env"
@@ -14,6 +15,7 @@ type Exception struct {
 	Code    errcode.Code
 	Error   error
 	Message string
+	Details interface{} // optional structured detail, e.g. errors per field
 }
 
 // MarshalJSON :
@@ -27,6 +29,15 @@ func (e Exception) MarshalJSON() ([]byte, error) {
 	bb.WriteString(",")
 	bb.WriteString(`"message":`)
 	bb.WriteString(fmt.Sprintf("%q", fmt.Sprintf("%v", e.Error)))
+	if e.Details != nil {
+		details, err := json.Marshal(e.Details)
+		if err != nil {
+			return nil, err
+		}
+		bb.WriteString(",")
+		bb.WriteString(`"details":`)
+		bb.Write(details)
+	}
 	if !env.IsProduction() {
 		bb.WriteString(",")
 		bb.WriteString(`"debug":`)
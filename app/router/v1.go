@@ -17,18 +17,46 @@ func V1(e *echo.Echo, h *handler.Handler) {
 
 	v1.POST("/vendor/login", h.VendorLogin)
 	v1.POST("/admin/login", h.AdminLogin)
+	v1.POST("/auth/refresh", h.RefreshToken)
+	v1.POST("/auth/logout", h.Logout)
+	v1.POST("/auth/logoutAll", h.LogoutAll)
+	v1.GET("/auth/sessions", h.GetSessions)
+	v1.POST("/auth/password/forgot", h.ForgotPassword)
+	v1.POST("/auth/password/reset", h.ResetPassword)
+	v1.POST("/auth/2fa/challenge/enroll", h.EnrollTwoFactorChallenge)
+	v1.POST("/auth/2fa/challenge/verify", h.VerifyTwoFactorChallenge)
+	v1.POST("/auth/2fa/enroll", h.EnrollTwoFactor)
+	v1.POST("/auth/2fa/activate", h.ActivateTwoFactor)
+	v1.POST("/auth/2fa/recoveryCodes", h.RegenerateRecoveryCodes)
+	v1.DELETE("/auth/2fa", h.DisableTwoFactor)
+	v1.GET("/auth/oidc/providers", h.GetOIDCLoginProviders)
+	v1.POST("/auth/oidc/authorize", h.OIDCAuthorize)
+	v1.POST("/auth/oidc/callback", h.OIDCCallback)
 
 	admin := v1.Group("/admin")
 	admin.POST("", h.CreateAdmin)
 	admin.GET("", h.GetAdminByToken)
 	admin.GET("s", h.GetAdmins)
 	admin.PUT("", h.UpdateAdmin)
-	// admin.GET("/corporateUsers", h.GetCorporateUsers)
+	admin.GET("/sessions", h.GetUserSessions)
+	admin.DELETE("/sessions", h.RevokeUserSessions)
+	admin.DELETE("/2fa", h.ResetTwoFactor)
+	admin.GET("/lockouts", h.GetLockouts)
+	admin.GET("/lockoutEvents", h.GetLockoutEvents)
+	admin.DELETE("/lockout", h.UnlockLogin)
+	admin.GET("/policies", h.GetPolicies)
+	admin.POST("/policy", h.AddPolicy)
+	admin.DELETE("/policy", h.RemovePolicy)
+	admin.GET("/policyChanges", h.GetPolicyChanges)
+	admin.GET("/oidcProviders", h.GetOIDCProviders)
+	admin.POST("/oidcProvider", h.CreateOIDCProvider)
+	admin.PUT("/oidcProvider", h.UpdateOIDCProvider)
+	admin.GET("/corporateUsers", h.GetCorporateUsers)
 	admin.GET("/smeUsers", h.GetSMEUsers)
 	admin.POST("/smeUser", h.CreateSMEUser)
 	admin.PUT("/smeUser", h.UpdateSMEUser)
-	// admin.POST("/corporateUser", h.CreateCorporateUser)
-	// admin.PUT("/corporateUser", h.UpdateCorporateUser)
+	admin.POST("/corporateUser", h.CreateCorporateUser)
+	admin.PUT("/corporateUser", h.UpdateCorporateUser)
 
 	v1.POST("/smeRegister", h.CreateSME)
 	v1.POST("/smeSubscription", h.CreateSubscription)
@@ -43,21 +71,24 @@ func V1(e *echo.Echo, h *handler.Handler) {
 	// SME user
 	v1.POST("/smeUser/login", h.SMEUserLogin)
 	v1.POST("/smeUser/register", h.CreateSMEUser)
+	v1.POST("/smeUser/verifyEmail", h.VerifyEmail)
+	v1.POST("/smeUser/verifyEmail/resend", h.ResendVerificationEmail)
+	v1.POST("/smeUser/invitation/accept", h.AcceptInvitation)
 	// v1.GET("/smeUser", h.GetSMEUserByToken)
 	smeUser := v1.Group("/smeUser")
 	smeUser.POST("", h.CreateSMEUser)
 	smeUser.PUT("", h.UpdateSMEUser)
 	smeUser.GET("", h.GetSMEUserByToken)
+	smeUser.POST("/invite", h.InviteSMEUser)
 	smeUser.GET("s", h.GetSMEUsers)
 
-	// v1.POST("/corporateRegister", h.CreateCorporate)
-	// // Corporate
-	// corporate := v1.Group("/corporate")
-	// corporate.POST("", h.CreateCorporate)
-	// corporate.GET("s", h.GetCorporates)
-	// corporate.PUT("", h.UpdateCorporate)
-	// corporate.DELETE("", h.DeleteCorporate)
-	// corporate.GET("/smeUsers", h.GetSMEUsers)
+	// Corporate
+	corporate := v1.Group("/corporate")
+	corporate.POST("", h.CreateCorporate)
+	corporate.GET("s", h.GetCorporates)
+	corporate.PUT("", h.UpdateCorporate)
+	corporate.DELETE("", h.DeleteCorporate)
+	corporate.DELETE("/sme", h.UnlinkCorporateSME)
 
 	// subscription
 	subscription := v1.Group("/subscription")
@@ -67,14 +98,12 @@ func V1(e *echo.Echo, h *handler.Handler) {
 	subscription.DELETE("", h.DeleteSubscription)
 
 	// Corporate user
-	// v1.POST("/corporateUser/login", h.CorporateUserLogin)
-	// v1.POST("/corporateUser/register", h.CreateCorporateUser)
-	// // v1.GET("/corporateUser", h.GetCorporateUserByToken)
-	// corporateUser := v1.Group("/corporateUser")
-	// corporateUser.POST("", h.CreateCorporateUser)
-	// corporateUser.PUT("", h.UpdateCorporateUser)
-	// corporateUser.GET("", h.GetCorporateUserByToken)
-	// corporateUser.GET("s", h.GetCorporateUsers)
+	v1.POST("/corporateUser/login", h.CorporateUserLogin)
+	corporateUser := v1.Group("/corporateUser")
+	corporateUser.POST("", h.CreateCorporateUser)
+	corporateUser.PUT("", h.UpdateCorporateUser)
+	corporateUser.GET("", h.GetCorporateUserByToken)
+	corporateUser.GET("s", h.GetCorporateUsers)
 
 	// Learning resource
 	learningResource := v1.Group("/learningResource")
@@ -96,6 +125,10 @@ func V1(e *echo.Echo, h *handler.Handler) {
 	questionSet.PUT("", h.UpdateQuestionSet)
 	questionSet.GET("s", h.GetQuestionSets)
 	questionSet.DELETE("", h.DeleteQuestionSet)
+	questionSet.PUT("/publish", h.PublishQuestionSet)
+	questionSet.PUT("/retire", h.RetireQuestionSet)
+	questionSet.POST("/revision", h.CreateQuestionSetRevision)
+	questionSet.GET("/diff", h.DiffQuestionSets)
 
 	// Question
 	question := v1.Group("/question")
@@ -110,16 +143,64 @@ func V1(e *echo.Echo, h *handler.Handler) {
 	assessment.PUT("", h.UpdateAssessment)
 	assessment.GET("s", h.GetAssessments)
 	assessment.DELETE("", h.DeleteAssessment)
+	assessment.POST("/share", h.ShareAssessment)
+	assessment.DELETE("/share", h.RevokeAssessmentShare)
+	assessment.GET("/accessLogs", h.GetShareAccessLogs)
+
+	// Shared assessment
+	sharedAssessment := v1.Group("/sharedAssessment")
+	sharedAssessment.GET("", h.GetSharedAssessment)
+	sharedAssessment.GET("s", h.GetSharedAssessments)
+	sharedAssessment.GET("/evidence/download", h.DownloadSharedEvidence)
 
 	// Assessment Entry
 	v1.GET("/assessmentEntries", h.GetAssessmentEntries)
 	assessmentEntry := v1.Group("/assessmentEntry")
 	assessmentEntry.PUT("/responses", h.SubmitResponse)
 	assessmentEntry.PUT("/submit", h.SubmitAssessment)
+	assessmentEntry.PUT("/review", h.ReviewAssessmentEntries)
+	assessmentEntry.POST("/evidence", h.UploadEvidences)
+	assessmentEntry.GET("/evidences", h.GetEvidences)
+	assessmentEntry.GET("/evidence/download", h.DownloadEvidence)
+	assessmentEntry.DELETE("/evidence", h.DeleteEvidence)
+
+	// Emission Factor Table
+	emissionFactorTable := v1.Group("/emissionFactorTable")
+	emissionFactorTable.POST("", h.CreateEmissionFactorTable)
+	emissionFactorTable.PUT("", h.UpdateEmissionFactorTable)
+	emissionFactorTable.GET("s", h.GetEmissionFactorTables)
+	emissionFactorTable.DELETE("", h.DeleteEmissionFactorTable)
+	emissionFactorTable.PUT("/publish", h.PublishEmissionFactorTable)
+	emissionFactorTable.PUT("/retire", h.RetireEmissionFactorTable)
+
+	// Emission
+	emission := v1.Group("/emission")
+	emission.POST("", h.CreateEmission)
+	emission.PUT("", h.UpdateEmission)
+	emission.GET("s", h.GetEmissions)
+	emission.DELETE("", h.DeleteEmission)
+
+	// Analytics
+	analytics := v1.Group("/analytics")
+	analytics.GET("/benchmark", h.GetBenchmark)
+	analytics.GET("/trend", h.GetTrend)
+	analytics.GET("/portfolio/summary", h.GetPortfolioSummary)
+	analytics.GET("/portfolio/scores", h.GetPortfolioScores)
+	analytics.GET("/portfolio/risks", h.GetPortfolioRisks)
+	analytics.GET("/portfolio/overdueInvitations", h.GetPortfolioOverdueInvitations)
 
 	// Connection
 	connection := v1.Group("/connection")
 	connection.POST("", h.CreateConnection)
 	connection.PUT("", h.UpdateConnection)
+	connection.PUT("/accept", h.AcceptConnection)
+	connection.PUT("/decline", h.DeclineConnection)
 	connection.GET("s", h.GetConnections)
+
+	// Campaign
+	campaign := v1.Group("/campaign")
+	campaign.POST("", h.CreateCampaign)
+	campaign.PUT("", h.UpdateCampaign)
+	campaign.GET("/progress", h.GetCampaignProgress)
+	campaign.GET("s", h.GetCampaigns)
 }
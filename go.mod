@@ -71,6 +71,7 @@ require (
 	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d // indirect
 )
 
-require github.com/reedom/echo-middleware-casbin v1.3.0
-
-require github.com/casbin/casbin/v2 v2.40.6
+require (
+	github.com/casbin/casbin/v2 v2.40.6
+	github.com/jung-kurt/gofpdf v1.16.2
+)